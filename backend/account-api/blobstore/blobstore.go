@@ -0,0 +1,46 @@
+// Package blobstore keeps binary objects such as avatars out of Cassandra.
+// Objects are addressed by a slash-separated key and never modified; a new
+// version gets a new key.
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Store names accepted in AVATAR_STORE
+const (
+	StoreLocal = "local"
+)
+
+// ErrNotFound is returned for keys that do not exist
+var ErrNotFound = errors.New("blob not found")
+
+// ErrInvalidKey is returned for keys that are empty or try to escape the store
+var ErrInvalidKey = errors.New("invalid blob key")
+
+// Store is a place to put blobs
+type Store interface {
+	// Put writes the blob under key, replacing any existing one
+	Put(ctx context.Context, key string, data io.Reader) error
+	// Open reads the blob stored under key
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the blob; deleting a missing key is not an error
+	Delete(ctx context.Context, key string) error
+}
+
+// New returns the store selected by name. dir is where the local store keeps
+// its files.
+func New(name, dir string) (Store, error) {
+	switch name {
+	case StoreLocal:
+		return NewLocalStore(dir)
+	default:
+		return nil, fmt.Errorf("unknown blob store %q", name)
+	}
+}
+
+// Avatars is the store for profile pictures, selected at startup
+var Avatars Store
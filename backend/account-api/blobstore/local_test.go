@@ -0,0 +1,88 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalStorePath(t *testing.T) {
+	dir := t.TempDir()
+	store := &LocalStore{Dir: dir}
+
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"user-1/avatar.png", filepath.Join(dir, "user-1", "avatar.png")},
+		{"avatar.png", filepath.Join(dir, "avatar.png")},
+		{"a/b/c.webp", filepath.Join(dir, "a", "b", "c.webp")},
+		{"user-1/..png", filepath.Join(dir, "user-1", "..png")},
+	}
+	for _, tt := range tests {
+		got, err := store.path(tt.key)
+		if err != nil {
+			t.Errorf("path(%q): %v", tt.key, err)
+		} else if got != tt.want {
+			t.Errorf("path(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestLocalStorePathRejectsTraversal(t *testing.T) {
+	store := &LocalStore{Dir: t.TempDir()}
+
+	for _, key := range []string{
+		"",
+		"..",
+		"../secret",
+		"user-1/../../secret",
+		"user-1/..",
+		".",
+		"./avatar.png",
+		"/etc/passwd",
+		"user-1//avatar.png",
+		"user-1/",
+		`..\secret`,
+		`user-1\..\..\secret`,
+		`user-1\avatar.png`,
+	} {
+		if _, err := store.path(key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("path(%q): err = %v, want ErrInvalidKey", key, err)
+		}
+	}
+}
+
+func TestLocalStoreRoundTrip(t *testing.T) {
+	store, err := NewLocalStore(filepath.Join(t.TempDir(), "avatars"))
+	if err != nil {
+		t.Fatalf("NewLocalStore: %v", err)
+	}
+	ctx := context.Background()
+
+	if err := store.Put(ctx, "user-1/a.png", strings.NewReader("image")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	blob, err := store.Open(ctx, "user-1/a.png")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	data, _ := io.ReadAll(blob)
+	blob.Close()
+	if string(data) != "image" {
+		t.Fatalf("read %q, want %q", data, "image")
+	}
+
+	if err := store.Delete(ctx, "user-1/a.png"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Open(ctx, "user-1/a.png"); err != ErrNotFound {
+		t.Fatalf("Open after Delete: err = %v, want ErrNotFound", err)
+	}
+	if err := store.Put(ctx, "../escape.png", strings.NewReader("image")); !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("Put outside the directory: err = %v, want ErrInvalidKey", err)
+	}
+}
@@ -0,0 +1,24 @@
+package caching
+
+import (
+	"testing"
+
+	"account-api/config"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+// setupRedis points config.RedisClient at an in-memory Redis for the test
+func setupRedis(t *testing.T) *miniredis.Miniredis {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	previous := config.RedisClient
+	config.RedisClient = client
+	t.Cleanup(func() {
+		client.Close()
+		config.RedisClient = previous
+	})
+	return server
+}
@@ -0,0 +1,40 @@
+package caching
+
+import (
+	"time"
+)
+
+var (
+	// AccountStatusLimit allows a waiting sign-up page to poll its own account
+	AccountStatusLimit = RateLimit{Requests: 20, Window: time.Minute}
+	// IPStatusLimit keeps a single address from checking many accounts
+	IPStatusLimit = RateLimit{Requests: 60, Window: time.Minute}
+
+	// ResendCooldownLimit is one confirmation code resend per account a minute
+	ResendCooldownLimit = RateLimit{Requests: 1, Window: time.Minute}
+	// ResendHourlyLimit caps how many codes an account can be sent in an hour
+	ResendHourlyLimit = RateLimit{Requests: 5, Window: time.Hour}
+	// IPResendLimit keeps a single address from sending codes to many accounts
+	IPResendLimit = RateLimit{Requests: 20, Window: time.Hour}
+)
+
+// AllowConfirmationStatus counts a confirmation status check of the account
+// from the IP. It returns how long until another check is allowed, or 0 if
+// this one is.
+func AllowConfirmationStatus(email, ip string) (time.Duration, error) {
+	return allowRequest("confirm-status",
+		rateDimension{"account", email, AccountStatusLimit},
+		rateDimension{"ip", ip, IPStatusLimit},
+	)
+}
+
+// AllowConfirmationResend counts a request to resend the account's
+// confirmation code from the IP. It returns how long until another resend is
+// allowed, or 0 if this one is.
+func AllowConfirmationResend(email, ip string) (time.Duration, error) {
+	return allowRequest("confirm-resend",
+		rateDimension{"cooldown", email, ResendCooldownLimit},
+		rateDimension{"account", email, ResendHourlyLimit},
+		rateDimension{"ip", ip, IPResendLimit},
+	)
+}
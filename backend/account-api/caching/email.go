@@ -0,0 +1,63 @@
+package caching
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"account-api/config"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ErrNoPendingEmailChange is returned when there is no email change awaiting verification
+var ErrNoPendingEmailChange = errors.New("no pending email change")
+
+// PendingEmailChange holds what is needed to finish an email change once the
+// user enters the code sent to the new address. No provider credentials are
+// kept; verifying the address takes the user's password again.
+type PendingEmailChange struct {
+	NewEmail string `json:"new_email"`
+}
+
+func pendingEmailKey(userID string) string {
+	return "email-change:" + userID
+}
+
+// StorePendingEmailChange records an email change until it can no longer be verified
+func StorePendingEmailChange(userID string, change PendingEmailChange, ttl time.Duration) error {
+	data, err := json.Marshal(change)
+	if err != nil {
+		log.Printf("Failed to marshal pending email change: %v", err)
+		return err
+	}
+	if err := config.RedisClient.Set(config.RedisCtx, pendingEmailKey(userID), data, ttl).Err(); err != nil {
+		log.Printf("Failed to store pending email change for user %s: %v", userID, err)
+		return err
+	}
+	return nil
+}
+
+// GetPendingEmailChange retrieves the user's pending email change
+func GetPendingEmailChange(userID string) (*PendingEmailChange, error) {
+	data, err := config.RedisClient.Get(config.RedisCtx, pendingEmailKey(userID)).Result()
+	if err == redis.Nil {
+		return nil, ErrNoPendingEmailChange
+	} else if err != nil {
+		log.Printf("Failed to retrieve pending email change for user %s: %v", userID, err)
+		return nil, err
+	}
+
+	var change PendingEmailChange
+	if err := json.Unmarshal([]byte(data), &change); err != nil {
+		log.Printf("Failed to unmarshal pending email change: %v", err)
+		return nil, err
+	}
+	return &change, nil
+}
+
+// ClearPendingEmailChange removes the user's pending email change
+func ClearPendingEmailChange(userID string) error {
+	return config.RedisClient.Del(config.RedisCtx, pendingEmailKey(userID)).Err()
+}
@@ -0,0 +1,45 @@
+package caching
+
+import (
+	"time"
+
+	"account-api/config"
+	"shared/lockout"
+)
+
+// Login lockouts live in shared/lockout, so auth-api-v3 enforces the same
+// ones against the same counts
+type LoginLimits = lockout.Limits
+
+var (
+	// AccountLoginLimits protects a single account from password guessing
+	AccountLoginLimits = lockout.AccountLimits
+	// IPLoginLimits is looser, since many users can share an address behind NAT
+	IPLoginLimits = lockout.IPLimits
+)
+
+func loginLockout() *lockout.Store {
+	return lockout.NewStore(config.RedisClient)
+}
+
+// LoginBlocked returns how long logins for the account or from the IP are
+// still blocked, or 0 if they are allowed
+func LoginBlocked(email, ip string) (time.Duration, error) {
+	return loginLockout().Blocked(config.RedisCtx, email, ip)
+}
+
+// RecordLoginFailure counts a failed login against the account and the IP
+// and returns how long logins are now blocked
+func RecordLoginFailure(email, ip string) (time.Duration, error) {
+	return loginLockout().RecordFailure(config.RedisCtx, email, ip)
+}
+
+// ClearLoginFailures resets the account's count after a successful login
+func ClearLoginFailures(email string) error {
+	return loginLockout().ClearFailures(config.RedisCtx, email)
+}
+
+// UnlockLogin lifts any lockout of the account or the IP; either may be empty
+func UnlockLogin(email, ip string) error {
+	return loginLockout().Unlock(config.RedisCtx, email, ip)
+}
@@ -0,0 +1,68 @@
+package caching
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"account-api/config"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// MFAChallengeLifetime matches how long the identity provider accepts a challenge session
+const MFAChallengeLifetime = 3 * time.Minute
+
+// ErrMFAChallengeNotFound is returned for unknown or expired MFA challenges
+var ErrMFAChallengeNotFound = errors.New("MFA challenge not found")
+
+// MFAChallenge is a login waiting for its second factor. The client only sees
+// the random challenge ID; the provider's challenge session stays server-side.
+type MFAChallenge struct {
+	Email            string `json:"email"`
+	Username         string `json:"username"`
+	ChallengeSession string `json:"challenge_session"`
+	DeviceName       string `json:"device_name"`
+}
+
+func mfaChallengeKey(challengeID string) string {
+	return "mfa-challenge:" + challengeID
+}
+
+// StoreMFAChallenge keeps a pending MFA login for MFAChallengeLifetime
+func StoreMFAChallenge(challengeID string, challenge MFAChallenge) error {
+	data, err := json.Marshal(challenge)
+	if err != nil {
+		log.Printf("Failed to marshal MFA challenge: %v", err)
+		return err
+	}
+	if err := config.RedisClient.Set(config.RedisCtx, mfaChallengeKey(challengeID), data, MFAChallengeLifetime).Err(); err != nil {
+		log.Printf("Failed to store MFA challenge: %v", err)
+		return err
+	}
+	return nil
+}
+
+// GetMFAChallenge retrieves a pending MFA login
+func GetMFAChallenge(challengeID string) (*MFAChallenge, error) {
+	data, err := config.RedisClient.Get(config.RedisCtx, mfaChallengeKey(challengeID)).Result()
+	if err == redis.Nil {
+		return nil, ErrMFAChallengeNotFound
+	} else if err != nil {
+		log.Printf("Failed to retrieve MFA challenge: %v", err)
+		return nil, err
+	}
+
+	var challenge MFAChallenge
+	if err := json.Unmarshal([]byte(data), &challenge); err != nil {
+		log.Printf("Failed to unmarshal MFA challenge: %v", err)
+		return nil, err
+	}
+	return &challenge, nil
+}
+
+// DeleteMFAChallenge removes a pending MFA login once it has been completed
+func DeleteMFAChallenge(challengeID string) error {
+	return config.RedisClient.Del(config.RedisCtx, mfaChallengeKey(challengeID)).Err()
+}
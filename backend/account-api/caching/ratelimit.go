@@ -0,0 +1,61 @@
+package caching
+
+import (
+	"log"
+	"time"
+
+	"account-api/config"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RateLimit is how many requests are allowed per window
+type RateLimit struct {
+	Requests int64
+	Window   time.Duration
+}
+
+// rateDimension is one thing a request is counted against, such as the
+// account it is for or the address it came from
+type rateDimension struct {
+	name  string
+	value string
+	limit RateLimit
+}
+
+func rateLimitKey(feature, dimension, value string) string {
+	return feature + ":" + dimension + ":" + value
+}
+
+// allowRequest counts a request against every dimension. It returns how long
+// until another request is allowed, or 0 if this one is.
+func allowRequest(feature string, dimensions ...rateDimension) (time.Duration, error) {
+	var retryAfter time.Duration
+	for _, dimension := range dimensions {
+		key := rateLimitKey(feature, dimension.name, dimension.value)
+		var count *redis.IntCmd
+		var ttl *redis.DurationCmd
+		_, err := config.RedisClient.TxPipelined(config.RedisCtx, func(pipe redis.Pipeliner) error {
+			count = pipe.Incr(config.RedisCtx, key)
+			ttl = pipe.PTTL(config.RedisCtx, key)
+			return nil
+		})
+		if err != nil {
+			log.Printf("Failed to count %s request: %v", feature, err)
+			return 0, err
+		}
+
+		// The window starts at the first request; PTTL is negative until it is set
+		if ttl.Val() < 0 {
+			if err := config.RedisClient.PExpire(config.RedisCtx, key, dimension.limit.Window).Err(); err != nil {
+				log.Printf("Failed to start %s window: %v", feature, err)
+				return 0, err
+			}
+			ttl.SetVal(dimension.limit.Window)
+		}
+		if count.Val() > dimension.limit.Requests && ttl.Val() > retryAfter {
+			retryAfter = ttl.Val()
+		}
+	}
+	return retryAfter, nil
+}
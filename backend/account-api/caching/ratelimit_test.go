@@ -0,0 +1,165 @@
+package caching
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestConfirmationStatusLimitsAccount(t *testing.T) {
+	server := setupRedis(t)
+
+	for i := int64(0); i < AccountStatusLimit.Requests; i++ {
+		// Spread over addresses, so only the account limit is in play
+		retryAfter, err := AllowConfirmationStatus("user@example.com", "198.51.100."+strconv.FormatInt(i, 10))
+		if err != nil {
+			t.Fatalf("AllowConfirmationStatus: %v", err)
+		}
+		if retryAfter != 0 {
+			t.Fatalf("check %d blocked for %s", i+1, retryAfter)
+		}
+	}
+	retryAfter, err := AllowConfirmationStatus("user@example.com", "203.0.113.1")
+	if err != nil {
+		t.Fatalf("AllowConfirmationStatus: %v", err)
+	}
+	if retryAfter <= 0 || retryAfter > AccountStatusLimit.Window {
+		t.Fatalf("check over the account limit: retryAfter = %s", retryAfter)
+	}
+
+	// Other accounts are unaffected, and the account recovers with the window
+	if retryAfter, _ := AllowConfirmationStatus("other@example.com", "203.0.113.1"); retryAfter != 0 {
+		t.Fatalf("another account blocked for %s", retryAfter)
+	}
+	server.FastForward(AccountStatusLimit.Window)
+	if retryAfter, _ := AllowConfirmationStatus("user@example.com", "203.0.113.1"); retryAfter != 0 {
+		t.Fatalf("account still blocked for %s after the window", retryAfter)
+	}
+}
+
+func TestConfirmationStatusLimitsIP(t *testing.T) {
+	setupRedis(t)
+
+	for i := int64(0); i < IPStatusLimit.Requests; i++ {
+		retryAfter, err := AllowConfirmationStatus("user"+strconv.FormatInt(i, 10)+"@example.com", "203.0.113.1")
+		if err != nil {
+			t.Fatalf("AllowConfirmationStatus: %v", err)
+		}
+		if retryAfter != 0 {
+			t.Fatalf("check %d blocked for %s", i+1, retryAfter)
+		}
+	}
+	if retryAfter, _ := AllowConfirmationStatus("new@example.com", "203.0.113.1"); retryAfter <= 0 {
+		t.Fatal("address checking many accounts was not limited")
+	}
+	if retryAfter, _ := AllowConfirmationStatus("new@example.com", "203.0.113.2"); retryAfter != 0 {
+		t.Fatalf("another address blocked for %s", retryAfter)
+	}
+}
+
+func TestConfirmationResendCooldown(t *testing.T) {
+	server := setupRedis(t)
+
+	if retryAfter, err := AllowConfirmationResend("user@example.com", "203.0.113.1"); err != nil || retryAfter != 0 {
+		t.Fatalf("first resend: retryAfter = %s, err = %v", retryAfter, err)
+	}
+	retryAfter, err := AllowConfirmationResend("user@example.com", "203.0.113.1")
+	if err != nil {
+		t.Fatalf("AllowConfirmationResend: %v", err)
+	}
+	if retryAfter <= 0 || retryAfter > ResendCooldownLimit.Window {
+		t.Fatalf("resend within the cooldown: retryAfter = %s", retryAfter)
+	}
+	if retryAfter, _ := AllowConfirmationResend("other@example.com", "203.0.113.1"); retryAfter != 0 {
+		t.Fatalf("another account blocked for %s", retryAfter)
+	}
+
+	server.FastForward(ResendCooldownLimit.Window)
+	if retryAfter, _ := AllowConfirmationResend("user@example.com", "203.0.113.1"); retryAfter != 0 {
+		t.Fatalf("resend after the cooldown blocked for %s", retryAfter)
+	}
+}
+
+func TestConfirmationResendHourlyCap(t *testing.T) {
+	server := setupRedis(t)
+
+	for i := int64(0); i < ResendHourlyLimit.Requests; i++ {
+		retryAfter, err := AllowConfirmationResend("user@example.com", "203.0.113.1")
+		if err != nil {
+			t.Fatalf("AllowConfirmationResend: %v", err)
+		}
+		if retryAfter != 0 {
+			t.Fatalf("resend %d blocked for %s", i+1, retryAfter)
+		}
+		server.FastForward(ResendCooldownLimit.Window)
+	}
+	retryAfter, _ := AllowConfirmationResend("user@example.com", "203.0.113.1")
+	if retryAfter <= ResendCooldownLimit.Window || retryAfter > ResendHourlyLimit.Window {
+		t.Fatalf("resend over the hourly cap: retryAfter = %s, want the rest of the hour", retryAfter)
+	}
+}
+
+func TestConfirmationResendLimitsIP(t *testing.T) {
+	setupRedis(t)
+
+	for i := int64(0); i < IPResendLimit.Requests; i++ {
+		retryAfter, err := AllowConfirmationResend("user"+strconv.FormatInt(i, 10)+"@example.com", "203.0.113.1")
+		if err != nil {
+			t.Fatalf("AllowConfirmationResend: %v", err)
+		}
+		if retryAfter != 0 {
+			t.Fatalf("resend %d blocked for %s", i+1, retryAfter)
+		}
+	}
+	if retryAfter, _ := AllowConfirmationResend("new@example.com", "203.0.113.1"); retryAfter <= 0 {
+		t.Fatal("address resending to many accounts was not limited")
+	}
+}
+
+func TestUserSearchLimits(t *testing.T) {
+	server := setupRedis(t)
+
+	for i := int64(0); i < UserSearchLimit.Requests; i++ {
+		retryAfter, err := AllowUserSearch("user-1", "198.51.100."+strconv.FormatInt(i, 10))
+		if err != nil {
+			t.Fatalf("AllowUserSearch: %v", err)
+		}
+		if retryAfter != 0 {
+			t.Fatalf("search %d blocked for %s", i+1, retryAfter)
+		}
+	}
+	retryAfter, err := AllowUserSearch("user-1", "203.0.113.1")
+	if err != nil {
+		t.Fatalf("AllowUserSearch: %v", err)
+	}
+	if retryAfter <= 0 || retryAfter > UserSearchLimit.Window {
+		t.Fatalf("search over the user limit: retryAfter = %s", retryAfter)
+	}
+	if retryAfter, _ := AllowUserSearch("user-2", "203.0.113.1"); retryAfter != 0 {
+		t.Fatalf("another user blocked for %s", retryAfter)
+	}
+	server.FastForward(UserSearchLimit.Window)
+	if retryAfter, _ := AllowUserSearch("user-1", "203.0.113.1"); retryAfter != 0 {
+		t.Fatalf("user still blocked for %s after the window", retryAfter)
+	}
+}
+
+func TestUserSearchLimitsIP(t *testing.T) {
+	setupRedis(t)
+
+	// Many users behind one address get more room than a single user
+	for i := int64(0); i < IPSearchLimit.Requests; i++ {
+		retryAfter, err := AllowUserSearch("user-"+strconv.FormatInt(i, 10), "203.0.113.1")
+		if err != nil {
+			t.Fatalf("AllowUserSearch: %v", err)
+		}
+		if retryAfter != 0 {
+			t.Fatalf("search %d blocked for %s", i+1, retryAfter)
+		}
+	}
+	if retryAfter, _ := AllowUserSearch("new-user", "203.0.113.1"); retryAfter <= 0 {
+		t.Fatal("address searching as many users was not limited")
+	}
+	if retryAfter, _ := AllowUserSearch("new-user", "203.0.113.2"); retryAfter != 0 {
+		t.Fatalf("another address blocked for %s", retryAfter)
+	}
+}
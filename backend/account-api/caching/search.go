@@ -0,0 +1,21 @@
+package caching
+
+import (
+	"time"
+)
+
+var (
+	// UserSearchLimit keeps a single account from walking the directory
+	UserSearchLimit = RateLimit{Requests: 30, Window: time.Minute}
+	// IPSearchLimit is looser, since many users can share an address behind NAT
+	IPSearchLimit = RateLimit{Requests: 120, Window: time.Minute}
+)
+
+// AllowUserSearch counts a directory search by the user from the IP. It
+// returns how long until another search is allowed, or 0 if this one is.
+func AllowUserSearch(userID, ip string) (time.Duration, error) {
+	return allowRequest("user-search",
+		rateDimension{"user", userID, UserSearchLimit},
+		rateDimension{"ip", ip, IPSearchLimit},
+	)
+}
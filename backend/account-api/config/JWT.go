@@ -3,15 +3,60 @@ package config
 import (
 	"log"
 	"os"
+
+	sharedconfig "shared/config"
+	"shared/token"
+
+	"github.com/golang-jwt/jwt/v4"
 )
 
 var (
-	JWTSecretKey string
+	// Tokens is the lifetime policy for access tokens and sessions
+	Tokens = token.DefaultPolicy()
+	// JWT holds the iss and aud claims access tokens carry, and the clock skew
+	// allowed when verifying them
+	JWT sharedconfig.JWT
+	// Keys signs access tokens and is published at /.well-known/jwks.json
+	Keys *token.KeyRing
+	// Issuer mints access tokens and Verifier checks the ones sent back to us
+	Issuer   *token.Issuer
+	Verifier *token.Verifier
 )
 
 func InitConfig() {
-	JWTSecretKey = os.Getenv("JWT_SECRET_KEY")
-	if JWTSecretKey == "" {
-		log.Fatal("JWT_SECRET_KEY is not set in the environment")
+	var err error
+	JWT, err = sharedconfig.LoadJWT()
+	if err != nil {
+		log.Fatalf("Invalid JWT configuration: %v", err)
+	}
+
+	Tokens, err = token.LoadPolicy()
+	if err != nil {
+		log.Fatalf("Invalid token policy: %v", err)
+	}
+	log.Printf("Token policy: access %s, refresh %s, idle timeout %s",
+		Tokens.AccessTokenLifetime, Tokens.RefreshTokenLifetime, Tokens.IdleTimeout)
+
+	// JWT_PRIVATE_KEY signs new tokens; JWT_RETIRED_PUBLIC_KEYS are rotated-out
+	// keys, still published until the tokens they signed expire. Only DEV_MODE
+	// may run without a key.
+	Keys, err = token.LoadKeyRing(os.Getenv("JWT_PRIVATE_KEY"), os.Getenv("JWT_RETIRED_PUBLIC_KEYS"), sharedconfig.DevMode())
+	if err != nil {
+		log.Fatalf("Failed to load JWT signing keys: %v", err)
+	}
+	Issuer = &token.Issuer{Keys: Keys, Issuer: JWT.Issuer, Audience: JWT.Audience}
+	Verifier = &token.Verifier{
+		Keyfunc:   Keys.Keyfunc,
+		Algorithm: jwt.SigningMethodRS256.Alg(),
+		Issuer:    JWT.Issuer,
+		Audience:  JWT.Audience,
+		ClockSkew: JWT.ClockSkew,
+	}
+
+	LoadIdentityConfig()
+	LoadAdminConfig()
+	LoadAvatarConfig()
+	if err := LoadProxyConfig(); err != nil {
+		log.Fatalf("Invalid proxy configuration: %v", err)
 	}
 }
@@ -0,0 +1,17 @@
+package config
+
+import (
+	"log"
+	"os"
+)
+
+// AdminAPIToken authorizes the /admin endpoints. They are disabled when it is unset.
+var AdminAPIToken string
+
+// LoadAdminConfig reads ADMIN_API_TOKEN from the environment
+func LoadAdminConfig() {
+	AdminAPIToken = os.Getenv("ADMIN_API_TOKEN")
+	if AdminAPIToken == "" {
+		log.Println("ADMIN_API_TOKEN is not set, admin endpoints are disabled")
+	}
+}
@@ -0,0 +1,24 @@
+package config
+
+import (
+	"log"
+
+	sharedconfig "shared/config"
+)
+
+var (
+	// AvatarStore selects where avatar images are kept: "local"
+	AvatarStore string
+	// AvatarStoreDir is the directory the local store writes to
+	AvatarStoreDir string
+	// AvatarBaseURL is prefixed to avatar keys to form the URLs clients load them from
+	AvatarBaseURL string
+)
+
+// LoadAvatarConfig reads the avatar storage settings from the environment
+func LoadAvatarConfig() {
+	AvatarStore = sharedconfig.EnvOrDefault("AVATAR_STORE", "local")
+	AvatarStoreDir = sharedconfig.EnvOrDefault("AVATAR_STORE_DIR", "/var/lib/account-api/avatars")
+	AvatarBaseURL = sharedconfig.EnvOrDefault("AVATAR_BASE_URL", "/avatars")
+	log.Printf("Avatar store: %s", AvatarStore)
+}
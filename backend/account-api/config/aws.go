@@ -3,10 +3,10 @@ package config
 import (
 	"context"
 	"log"
-	"os"
+
+	sharedconfig "shared/config"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider"
 )
 
@@ -21,35 +21,17 @@ var (
 
 // InitAWS initializes the AWS configuration and services
 func InitAWS() {
-	var err error
-
-	// Explicitly set the AWS Region
-	region := os.Getenv("AWS_REGION")
-	if region == "" {
-		log.Fatalf("AWS_REGION environment variable is not set")
-	}
-
-	// Load AWS configuration with the specified region
-	AWSConfig, err = config.LoadDefaultConfig(context.TODO(),
-		config.WithRegion(region), // Ensure the region is explicitly set
-	)
+	cognito, err := sharedconfig.LoadCognito(context.TODO())
 	if err != nil {
-		log.Fatalf("Failed to load AWS configuration: %v", err)
+		log.Fatalf("Failed to initialize Cognito: %v", err)
 	}
 
-	// Initialize Cognito client
-	CognitoClient = cognitoidentityprovider.NewFromConfig(AWSConfig)
-
-	// Load Cognito details from environment variables
-	UserPoolID = os.Getenv("COGNITO_USER_POOL_ID")
-	AwsRegion = os.Getenv("AWS_REGION")
-	AppClientID = os.Getenv("COGNITO_APP_CLIENT_ID")
-	AppClientSecret = os.Getenv("COGNITO_APP_CLIENT_SECRET")
-
-	// Validate environment variables
-	if UserPoolID == "" || AppClientID == "" || AppClientSecret == "" {
-		log.Fatalf("Cognito environment variables are not set. Please set COGNITO_USER_POOL_ID, COGNITO_APP_CLIENT_ID, and COGNITO_APP_CLIENT_SECRET")
-	}
+	AWSConfig = cognito.AWSConfig
+	CognitoClient = cognito.Client
+	UserPoolID = cognito.UserPoolID
+	AwsRegion = cognito.Region
+	AppClientID = cognito.AppClientID
+	AppClientSecret = cognito.AppClientSecret
 
 	log.Println("AWS configuration initialized successfully")
 	log.Printf("Using Cognito User Pool ID: %s", UserPoolID)
@@ -0,0 +1,18 @@
+//go:build dev
+
+package config
+
+import (
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+// devRedis starts an in-process Redis for DEV_MODE. It is only compiled into
+// builds made with -tags dev, so release images never carry it.
+func devRedis() (*redis.Client, string, error) {
+	server, err := miniredis.Run()
+	if err != nil {
+		return nil, "", err
+	}
+	return redis.NewClient(&redis.Options{Addr: server.Addr()}), server.Addr(), nil
+}
@@ -0,0 +1,14 @@
+//go:build !dev
+
+package config
+
+import (
+	"errors"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// devRedis is not available outside builds made with -tags dev
+func devRedis() (*redis.Client, string, error) {
+	return nil, "", errors.New("the in-memory Redis needs a build with -tags dev; set AUTH_REDIS_HOST instead")
+}
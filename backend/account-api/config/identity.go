@@ -0,0 +1,42 @@
+package config
+
+import (
+	"log"
+	"os"
+
+	sharedconfig "shared/config"
+)
+
+var (
+	// IdentityProvider selects the account backend: "cognito" or "local"
+	IdentityProvider string
+	// LocalIdentityStore is where the local provider keeps users: "cassandra" or "memory"
+	LocalIdentityStore string
+	// LocalIdentityCodeFile is where the local provider writes the codes it
+	// would otherwise email. Only honoured with DEV_MODE=true.
+	LocalIdentityCodeFile string
+	// DevMode lets the service run without Redis, Cassandra or a JWT signing
+	// key and deliver local identity codes to a file, see sharedconfig.DevMode
+	DevMode bool
+)
+
+// LoadIdentityConfig reads the identity provider settings from the environment
+func LoadIdentityConfig() {
+	IdentityProvider = os.Getenv("IDENTITY_PROVIDER")
+	if IdentityProvider == "" {
+		IdentityProvider = "cognito"
+	}
+	LocalIdentityStore = os.Getenv("LOCAL_IDENTITY_STORE")
+	if LocalIdentityStore == "" {
+		LocalIdentityStore = "cassandra"
+	}
+	DevMode = sharedconfig.DevMode()
+	LocalIdentityCodeFile = os.Getenv("LOCAL_IDENTITY_CODE_FILE")
+	if LocalIdentityCodeFile != "" && !DevMode {
+		log.Fatal("LOCAL_IDENTITY_CODE_FILE is only allowed with DEV_MODE=true")
+	}
+	log.Printf("Identity provider: %s", IdentityProvider)
+	if DevMode {
+		log.Println("DEV_MODE is on: do not run this configuration in production")
+	}
+}
@@ -0,0 +1,37 @@
+package config
+
+import (
+	"log"
+	"net"
+
+	sharedconfig "shared/config"
+)
+
+// TrustedProxies are the networks of the proxies in front of account-api.
+// X-Forwarded-For entries they append are believed; everything to the left of
+// the last untrusted hop may have been sent by the client and is ignored.
+var TrustedProxies []*net.IPNet
+
+// LoadProxyConfig reads TRUSTED_PROXIES, a comma-separated list of CIDRs.
+// When it is unset only the connection's own address is used.
+func LoadProxyConfig() error {
+	var err error
+	TrustedProxies, err = sharedconfig.TrustedProxiesFromEnv()
+	if err != nil {
+		return err
+	}
+	if len(TrustedProxies) == 0 {
+		log.Println("TRUSTED_PROXIES is not set, X-Forwarded-For is ignored")
+	}
+	return nil
+}
+
+// IsTrustedProxy reports whether ip belongs to one of the TrustedProxies
+func IsTrustedProxy(ip net.IP) bool {
+	for _, network := range TrustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -2,29 +2,42 @@ package config
 
 import (
 	"context"
-	"github.com/go-redis/redis/v8"
 	"log"
 	"os"
+
+	sharedconfig "shared/config"
+	"shared/session"
+
+	"github.com/go-redis/redis/v8"
 )
 
 var RedisClient *redis.Client
 var RedisCtx = context.Background()
 
-func InitRedis() {
-	// Load Redis configuration from environment variables
-	redisAddr := os.Getenv("AUTH_REDIS_HOST") + ":" + os.Getenv("AUTH_REDIS_PORT")
-	redisPassword := os.Getenv("AUTH_REDIS_PASSWORD")
-
-	RedisClient = redis.NewClient(&redis.Options{
-		Addr:     redisAddr,     // Redis server address
-		Password: redisPassword, // Redis password
-		DB:       0,             // Use default DB
-	})
+// Sessions stores the login sessions in the auth Redis
+var Sessions *session.Store
 
-	// Test Redis connection
-	_, err := RedisClient.Ping(RedisCtx).Result()
-	if err != nil {
-		log.Fatalf("Failed to connect to Redis: %v", err)
+// InitRedis connects to the auth Redis. In DEV_MODE without AUTH_REDIS_HOST,
+// builds made with -tags dev start an in-process Redis instead, which loses
+// everything on restart.
+func InitRedis() {
+	if DevMode && os.Getenv("AUTH_REDIS_HOST") == "" {
+		client, addr, err := devRedis()
+		if err != nil {
+			log.Fatalf("Failed to start in-memory Redis: %v", err)
+		}
+		log.Printf("DEV_MODE: AUTH_REDIS_HOST is not set, using an in-memory Redis at %s", addr)
+		RedisClient = client
+	} else {
+		var err error
+		RedisClient, err = sharedconfig.RedisFromEnv(RedisCtx, "AUTH")
+		if err != nil {
+			log.Fatalf("Failed to connect to Redis: %v", err)
+		}
+		log.Println("Connected to Redis")
 	}
-	log.Println("Connected to Redis")
+
+	// account-api lists sessions with the time they were last used
+	Sessions = session.NewStore(RedisClient, Tokens)
+	Sessions.TrackLastSeen = true
 }
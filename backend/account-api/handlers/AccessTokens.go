@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"shared/auth"
+	"shared/logging"
+	"shared/pat"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// defaultAccessTokenDays is the lifetime of a token created without expires_in_days
+	defaultAccessTokenDays = 30
+	// maxAccessTokenNameLength keeps token names to a sensible label
+	maxAccessTokenNameLength = 100
+)
+
+// CreatedAccessTokenResponse is the only time the token itself is shown
+type CreatedAccessTokenResponse struct {
+	AccessToken string `json:"token"`
+	*pat.Token
+}
+
+// CreateAccessToken creates a named, scoped personal access token for scripts
+func CreateAccessToken(w http.ResponseWriter, r *http.Request) {
+	session := RetrieveSession(r)
+	if session == nil {
+		http.Error(w, "Cassandra session not available", http.StatusInternalServerError)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		logging.Printf(r.Context(), "User ID not found in context")
+		return
+	}
+
+	var request struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		logging.Printf(r.Context(), "Error decoding request payload: %v", err)
+		return
+	}
+	request.Name = strings.TrimSpace(request.Name)
+	if request.Name == "" || len(request.Name) > maxAccessTokenNameLength {
+		http.Error(w, "Token name is required and must be at most 100 characters", http.StatusBadRequest)
+		return
+	}
+	if request.ExpiresInDays == 0 {
+		request.ExpiresInDays = defaultAccessTokenDays
+	}
+	lifetime := time.Duration(request.ExpiresInDays) * 24 * time.Hour
+	if request.ExpiresInDays < 0 || lifetime > pat.MaxLifetime {
+		http.Error(w, "expires_in_days must be between 1 and 365", http.StatusBadRequest)
+		return
+	}
+
+	token, details, err := pat.NewStore(session).Create(r.Context(), userID, request.Name, request.Scopes, lifetime)
+	if errors.Is(err, pat.ErrInvalidScope) {
+		http.Error(w, "Scopes must be one or more of: "+strings.Join(pat.Scopes, ", "), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to create token", http.StatusInternalServerError)
+		logging.Errorf(r.Context(), "Error creating access token for user %s: %v", userID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(CreatedAccessTokenResponse{AccessToken: token, Token: details})
+}
+
+// ListAccessTokens returns the user's personal access tokens, without the tokens themselves
+func ListAccessTokens(w http.ResponseWriter, r *http.Request) {
+	session := RetrieveSession(r)
+	if session == nil {
+		http.Error(w, "Cassandra session not available", http.StatusInternalServerError)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		logging.Printf(r.Context(), "User ID not found in context")
+		return
+	}
+
+	tokens, err := pat.NewStore(session).List(r.Context(), userID)
+	if err != nil {
+		http.Error(w, "Failed to list tokens", http.StatusInternalServerError)
+		logging.Errorf(r.Context(), "Error listing access tokens for user %s: %v", userID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// RevokeAccessToken deletes one of the user's personal access tokens
+func RevokeAccessToken(w http.ResponseWriter, r *http.Request) {
+	session := RetrieveSession(r)
+	if session == nil {
+		http.Error(w, "Cassandra session not available", http.StatusInternalServerError)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		logging.Printf(r.Context(), "User ID not found in context")
+		return
+	}
+	tokenID := mux.Vars(r)["token_id"]
+
+	err := pat.NewStore(session).Revoke(r.Context(), userID, tokenID)
+	if err == pat.ErrNotFound {
+		http.Error(w, "Token not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to revoke token", http.StatusInternalServerError)
+		logging.Errorf(r.Context(), "Error revoking access token %s for user %s: %v", tokenID, userID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Token revoked successfully",
+	})
+}
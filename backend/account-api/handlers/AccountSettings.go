@@ -0,0 +1,324 @@
+package handlers
+
+import (
+	"account-api/caching"
+	"account-api/config"
+	"account-api/identity"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"shared/auth"
+	"shared/logging"
+	"shared/pat"
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// ChangePassword changes the user's password after verifying the current one
+// with the identity provider. All other sessions and every personal access
+// token are revoked; the caller stays logged in.
+func ChangePassword(w http.ResponseWriter, r *http.Request) {
+	session := RetrieveSession(r)
+	if session == nil {
+		http.Error(w, "Cassandra session not available", http.StatusInternalServerError)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		logging.Printf(r.Context(), "User ID not found in context")
+		return
+	}
+	sessionID, _ := auth.SessionIDFromContext(r.Context())
+
+	var request struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+		MFACode         string `json:"mfa_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		logging.Printf(r.Context(), "Error decoding request payload: %v", err)
+		return
+	}
+	if request.CurrentPassword == "" || request.NewPassword == "" {
+		http.Error(w, "Missing required fields: current_password or new_password", http.StatusBadRequest)
+		return
+	}
+
+	accessToken, _, ok := reauthenticate(w, r, session, userID, request.CurrentPassword, request.MFACode)
+	if !ok {
+		return
+	}
+
+	err := identity.Provider.ChangePassword(r.Context(), accessToken, request.CurrentPassword, request.NewPassword)
+	if err != nil {
+		if errors.Is(err, identity.ErrInvalidPassword) {
+			http.Error(w, "New password does not meet the password requirements", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Failed to change password", http.StatusInternalServerError)
+		logging.Errorf(r.Context(), "Identity provider ChangePassword failed for user %s: %v", userID, err)
+		return
+	}
+
+	if err := pat.RevokeCredentials(r.Context(), config.Sessions, pat.NewStore(session), userID, sessionID); err != nil {
+		message := "Password was changed but access tokens could not be revoked"
+		if errors.Is(err, pat.ErrSessionsNotRevoked) {
+			message = "Password was changed but other sessions could not be revoked"
+		}
+		http.Error(w, message, http.StatusInternalServerError)
+		logging.Errorf(r.Context(), "Error revoking credentials of user %s after password change: %v", userID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Password changed successfully. Other sessions have been logged out and access tokens revoked.",
+	})
+}
+
+// emailChangeLifetime is how long a started email change can be verified,
+// matching how long the identity provider's verification codes last
+const emailChangeLifetime = 24 * time.Hour
+
+// ChangeEmail starts an email change. The identity provider sends a
+// verification code to the new address, and the change is completed by VerifyEmailChange.
+func ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	session := RetrieveSession(r)
+	if session == nil {
+		http.Error(w, "Cassandra session not available", http.StatusInternalServerError)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		logging.Printf(r.Context(), "User ID not found in context")
+		return
+	}
+
+	var request struct {
+		NewEmail string `json:"new_email"`
+		Password string `json:"password"`
+		MFACode  string `json:"mfa_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		logging.Printf(r.Context(), "Error decoding request payload: %v", err)
+		return
+	}
+	newEmail := strings.TrimSpace(request.NewEmail)
+	if newEmail == "" || request.Password == "" {
+		http.Error(w, "Missing required fields: new_email or password", http.StatusBadRequest)
+		return
+	}
+	if !strings.Contains(newEmail, "@") {
+		http.Error(w, "Invalid email address", http.StatusBadRequest)
+		return
+	}
+
+	existingID, err := lookupUserIDByEmail(session, newEmail)
+	if err == nil && existingID != userID {
+		http.Error(w, "Email address is already in use", http.StatusConflict)
+		return
+	} else if err == nil {
+		http.Error(w, "Email address is unchanged", http.StatusBadRequest)
+		return
+	} else if err != gocql.ErrNotFound {
+		http.Error(w, "Failed to change email", http.StatusInternalServerError)
+		logging.Errorf(r.Context(), "Error looking up email for user %s: %v", userID, err)
+		return
+	}
+
+	accessToken, _, ok := reauthenticate(w, r, session, userID, request.Password, request.MFACode)
+	if !ok {
+		return
+	}
+
+	err = identity.Provider.UpdateEmail(r.Context(), accessToken, newEmail)
+	if err != nil {
+		if errors.Is(err, identity.ErrAliasExists) {
+			http.Error(w, "Email address is already in use", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Failed to change email", http.StatusInternalServerError)
+		logging.Errorf(r.Context(), "Identity provider UpdateEmail failed for user %s: %v", userID, err)
+		return
+	}
+
+	err = caching.StorePendingEmailChange(userID, caching.PendingEmailChange{
+		NewEmail: newEmail,
+	}, emailChangeLifetime)
+	if err != nil {
+		http.Error(w, "Failed to change email", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "A verification code has been sent to the new email address.",
+	})
+}
+
+// VerifyEmailChange completes an email change with the code sent to the new
+// address, updates the users table and revokes the user's other sessions and
+// access tokens. The password is asked for again, since the provider access
+// token needed to verify the address is never kept between requests.
+func VerifyEmailChange(w http.ResponseWriter, r *http.Request) {
+	session := RetrieveSession(r)
+	if session == nil {
+		http.Error(w, "Cassandra session not available", http.StatusInternalServerError)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		logging.Printf(r.Context(), "User ID not found in context")
+		return
+	}
+	sessionID, _ := auth.SessionIDFromContext(r.Context())
+
+	var request struct {
+		Code     string `json:"code"`
+		Password string `json:"password"`
+		MFACode  string `json:"mfa_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		logging.Printf(r.Context(), "Error decoding request payload: %v", err)
+		return
+	}
+	if request.Code == "" || request.Password == "" {
+		http.Error(w, "Missing required fields: code or password", http.StatusBadRequest)
+		return
+	}
+
+	change, err := caching.GetPendingEmailChange(userID)
+	if err == caching.ErrNoPendingEmailChange {
+		http.Error(w, "No email change is pending, or it has expired", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to verify email", http.StatusInternalServerError)
+		return
+	}
+
+	accessToken, _, ok := reauthenticate(w, r, session, userID, request.Password, request.MFACode)
+	if !ok {
+		return
+	}
+
+	err = identity.Provider.VerifyEmail(r.Context(), accessToken, request.Code)
+	if err != nil {
+		logging.Printf(r.Context(), "Identity provider VerifyEmail failed for user %s: %v", userID, err)
+		if errors.Is(err, identity.ErrLimitExceeded) {
+			http.Error(w, "Too many attempts, please request a new code", http.StatusTooManyRequests)
+			return
+		}
+		http.Error(w, "Invalid or expired verification code", http.StatusBadRequest)
+		return
+	}
+
+	oldEmail, err := lookupEmail(session, userID)
+	if err != nil && err != gocql.ErrNotFound {
+		http.Error(w, "Failed to update email", http.StatusInternalServerError)
+		logging.Errorf(r.Context(), "Error fetching email for user %s: %v", userID, err)
+		return
+	}
+
+	// Register stores the email as the username as well
+	batch := session.NewBatch(gocql.LoggedBatch)
+	batch.Query(`UPDATE users SET username = ?, email = ? WHERE user_id = ?`,
+		change.NewEmail, change.NewEmail, userID)
+	if oldEmail != "" {
+		batch.Query(`DELETE FROM users_by_email WHERE email = ?`, normalizeEmail(oldEmail))
+	}
+	batch.Query(`INSERT INTO users_by_email (email, user_id) VALUES (?, ?)`,
+		normalizeEmail(change.NewEmail), userID)
+	if err := session.ExecuteBatch(batch); err != nil {
+		http.Error(w, "Failed to update email", http.StatusInternalServerError)
+		logging.Errorf(r.Context(), "Error updating email for user %s: %v", userID, err)
+		return
+	}
+
+	if err := caching.ClearPendingEmailChange(userID); err != nil {
+		logging.Printf(r.Context(), "Error clearing pending email change for user %s: %v", userID, err)
+	}
+	if err := pat.RevokeCredentials(r.Context(), config.Sessions, pat.NewStore(session), userID, sessionID); err != nil {
+		message := "Email was changed but access tokens could not be revoked"
+		if errors.Is(err, pat.ErrSessionsNotRevoked) {
+			message = "Email was changed but other sessions could not be revoked"
+		}
+		http.Error(w, message, http.StatusInternalServerError)
+		logging.Errorf(r.Context(), "Error revoking credentials of user %s after email change: %v", userID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Email changed successfully",
+		"email":   change.NewEmail,
+	})
+}
+
+// lookupEmail returns the email stored for a user
+func lookupEmail(session *gocql.Session, userID string) (string, error) {
+	var email string
+	err := session.Query(`SELECT email FROM users WHERE user_id = ?`, userID).Scan(&email)
+	return email, err
+}
+
+// reauthenticate verifies the user's password with the identity provider, plus
+// their TOTP code when MFA is enabled, and returns a provider access token for
+// calls that act on the user's own account. Wrong passwords and codes count
+// towards the same lockout as failed logins, so a stolen session cannot be
+// used to guess the password. It writes the error response itself and
+// reports whether the caller should continue.
+func reauthenticate(w http.ResponseWriter, r *http.Request, session *gocql.Session, userID, password, mfaCode string) (string, time.Duration, bool) {
+	email, err := lookupEmail(session, userID)
+	if err != nil {
+		http.Error(w, "Failed to verify password", http.StatusInternalServerError)
+		logging.Errorf(r.Context(), "Error fetching email for user %s: %v", userID, err)
+		return "", 0, false
+	}
+
+	lockoutEmail, ip := normalizeEmail(email), clientIP(r)
+	if !allowLoginAttempt(w, r, lockoutEmail, ip) {
+		return "", 0, false
+	}
+
+	result, err := identity.Provider.Authenticate(r.Context(), email, password)
+	if err != nil {
+		if errors.Is(err, identity.ErrLimitExceeded) {
+			http.Error(w, "Too many attempts, please try again later", http.StatusTooManyRequests)
+			return "", 0, false
+		}
+		if errors.Is(err, identity.ErrNotAuthorized) {
+			recordLoginFailure(r.Context(), lockoutEmail, ip)
+		}
+		http.Error(w, "Current password is incorrect", http.StatusUnauthorized)
+		return "", 0, false
+	}
+
+	if result.Challenge != nil {
+		if mfaCode == "" {
+			http.Error(w, "MFA code is required", http.StatusUnauthorized)
+			return "", 0, false
+		}
+		result, err = identity.Provider.RespondToMFAChallenge(r.Context(), result.Challenge, mfaCode)
+		if err != nil {
+			if errors.Is(err, identity.ErrCodeMismatch) || errors.Is(err, identity.ErrNotAuthorized) {
+				recordLoginFailure(r.Context(), lockoutEmail, ip)
+			}
+			http.Error(w, "Invalid MFA code", http.StatusUnauthorized)
+			return "", 0, false
+		}
+	}
+
+	if err := caching.ClearLoginFailures(lockoutEmail); err != nil {
+		logging.Printf(r.Context(), "Error clearing login failures for %s: %v", lockoutEmail, err)
+	}
+	return result.AccessToken, result.ExpiresIn, true
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"shared/logging"
+
+	"account-api/caching"
+	"account-api/config"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// AdminMiddleware only lets through requests bearing ADMIN_API_TOKEN
+func AdminMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if config.AdminAPIToken == "" {
+			http.NotFound(w, r)
+			return
+		}
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(config.AdminAPIToken)) != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			logging.Printf(r.Context(), "Rejected admin request to %s from %s", r.URL.Path, clientIP(r))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// UnlockLogin lifts a login lockout of an account, an IP address or both
+func UnlockLogin(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Email string `json:"email"`
+		IP    string `json:"ip"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		logging.Printf(r.Context(), "Error decoding request payload: %v", err)
+		return
+	}
+	if request.Email == "" && request.IP == "" {
+		http.Error(w, "Missing required field: email or ip", http.StatusBadRequest)
+		return
+	}
+
+	email, ip := normalizeEmail(request.Email), strings.TrimSpace(request.IP)
+	if err := caching.UnlockLogin(email, ip); err != nil {
+		http.Error(w, "Failed to unlock", http.StatusInternalServerError)
+		return
+	}
+	logging.Printf(r.Context(), "Admin unlocked logins for account %q and IP %q", email, ip)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Login unlocked successfully",
+	})
+}
+
+// BackfillUserLookups writes the users_by_email row of every user in the users
+// table, and the users_by_display_name row of every discoverable one with a
+// display name. Accounts created before a lookup table existed have no rows
+// in it: password resets and recovery logins need the email lookup, and name
+// search the display name one. Rows are rewritten with the same values, so the
+// backfill can safely be run more than once.
+func BackfillUserLookups(w http.ResponseWriter, r *http.Request) {
+	session := RetrieveSession(r)
+	if session == nil {
+		http.Error(w, "Cassandra session not available", http.StatusInternalServerError)
+		return
+	}
+
+	iter := session.Query(`SELECT user_id, email, display_name, discoverable FROM users`).
+		WithContext(r.Context()).PageSize(500).Iter()
+	var userID, email, displayName string
+	var discoverable bool
+	emails, displayNames := 0, 0
+	for iter.Scan(&userID, &email, &displayName, &discoverable) {
+		if email != "" {
+			err := session.Query(`INSERT INTO users_by_email (email, user_id) VALUES (?, ?)`,
+				normalizeEmail(email), userID).WithContext(r.Context()).Exec()
+			if err != nil {
+				iter.Close()
+				http.Error(w, "Failed to backfill user lookups", http.StatusInternalServerError)
+				logging.Errorf(r.Context(), "Error backfilling email lookup for user %s: %v", userID, err)
+				return
+			}
+			emails++
+		}
+
+		if key := displayNameKey(displayName); discoverable && key != "" {
+			err := session.Query(`INSERT INTO users_by_display_name (name_prefix, name_key, user_id) VALUES (?, ?, ?)`,
+				displayNamePrefix(key), key, userID).WithContext(r.Context()).Exec()
+			if err != nil {
+				iter.Close()
+				http.Error(w, "Failed to backfill user lookups", http.StatusInternalServerError)
+				logging.Errorf(r.Context(), "Error backfilling display name lookup for user %s: %v", userID, err)
+				return
+			}
+			displayNames++
+		}
+	}
+	if err := iter.Close(); err != nil {
+		http.Error(w, "Failed to backfill user lookups", http.StatusInternalServerError)
+		logging.Errorf(r.Context(), "Error scanning users for backfill: %v", err)
+		return
+	}
+	logging.Printf(r.Context(), "Admin backfilled email lookups for %d users and display name lookups for %d", emails, displayNames)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{
+		"emails":        emails,
+		"display_names": displayNames,
+	})
+}
@@ -1,51 +1,54 @@
 package handlers
 
 import (
-	"account-api/config"
-	"context"
+	"shared/logging"
+
+	"account-api/caching"
+	"account-api/identity"
 	"encoding/json"
-	"log"
+	"errors"
 	"net/http"
-
-	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider"
 )
 
-// ConfirmSignUp handles user account confirmation using the confirmation code
+// ConfirmSignUp handles user account confirmation using the confirmation code.
+// It accepts both {username, code} and the {email, confirmation_code} shape
+// the frontend sends; the username is the account's email.
 func ConfirmSignUp() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var request struct {
-			Username string `json:"username"`
-			Code     string `json:"code"`
+			Username         string `json:"username"`
+			Email            string `json:"email"`
+			Code             string `json:"code"`
+			ConfirmationCode string `json:"confirmation_code"`
 		}
 
 		// Parse the request body
 		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 			http.Error(w, "Invalid request payload", http.StatusBadRequest)
-			log.Printf("Failed to decode request: %v", err)
+			logging.Printf(r.Context(), "Failed to decode request: %v", err)
 			return
 		}
+		if request.Username == "" {
+			request.Username = request.Email
+		}
+		if request.Code == "" {
+			request.Code = request.ConfirmationCode
+		}
 
 		// Validate the input
 		if request.Username == "" || request.Code == "" {
 			http.Error(w, "Missing required fields: username or code", http.StatusBadRequest)
-			log.Println("Missing username or confirmation code in the request payload")
+			logging.Printf(r.Context(), "Missing username or confirmation code in the request payload")
 			return
 		}
 
-		// Generate SECRET_HASH
-		secretHash := GenerateSecretHash(config.AppClientID, config.AppClientSecret, request.Username)
-
-		// Call Cognito ConfirmSignUp API
-		input := &cognitoidentityprovider.ConfirmSignUpInput{
-			ClientId:         &config.AppClientID,
-			SecretHash:       &secretHash, // Include SECRET_HASH here
-			Username:         &request.Username,
-			ConfirmationCode: &request.Code,
-		}
-
-		_, err := config.CognitoClient.ConfirmSignUp(context.TODO(), input)
+		err := identity.Provider.ConfirmSignUp(r.Context(), request.Username, request.Code)
 		if err != nil {
-			log.Printf("Failed to confirm sign up for user '%s': %v", request.Username, err)
+			logging.Printf(r.Context(), "Failed to confirm sign up for user '%s': %v", request.Username, err)
+			if errors.Is(err, identity.ErrLimitExceeded) {
+				http.Error(w, "Too many attempts, please request a new code", http.StatusTooManyRequests)
+				return
+			}
 			http.Error(w, "Failed to confirm user account. Please check the code and try again.", http.StatusBadRequest)
 			return
 		}
@@ -57,3 +60,89 @@ func ConfirmSignUp() http.HandlerFunc {
 		})
 	}
 }
+
+// ResendConfirmationCode sends a new confirmation code for an unconfirmed account.
+// Resends are rate limited per account, one a minute and a few an hour, and
+// per IP.
+func ResendConfirmationCode(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		logging.Printf(r.Context(), "Failed to decode request: %v", err)
+		return
+	}
+	if request.Email == "" {
+		http.Error(w, "Missing required field: email", http.StatusBadRequest)
+		return
+	}
+
+	retryAfter, err := caching.AllowConfirmationResend(normalizeEmail(request.Email), clientIP(r))
+	if err != nil {
+		http.Error(w, "Failed to resend confirmation code", http.StatusInternalServerError)
+		return
+	}
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", formatSeconds(retryAfter))
+		http.Error(w, "Too many requests, please wait before requesting another code", http.StatusTooManyRequests)
+		return
+	}
+
+	err = identity.Provider.ResendConfirmationCode(r.Context(), request.Email)
+	if err != nil {
+		if errors.Is(err, identity.ErrLimitExceeded) {
+			http.Error(w, "Too many requests, please wait before requesting another code", http.StatusTooManyRequests)
+			return
+		}
+		logging.Printf(r.Context(), "Identity provider ResendConfirmationCode failed: %v", err)
+		http.Error(w, "Failed to resend confirmation code", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "A new confirmation code has been sent.",
+	})
+}
+
+// ConfirmationStatus tells the UI whether an account still needs to be
+// confirmed. Unknown emails are reported as pending, the same as a sign-up
+// awaiting its code, but a confirmed account does show that its email is
+// registered, as signing up with it again would. Checks are rate limited per
+// account and per IP to keep the endpoint from being used to walk emails.
+func ConfirmationStatus(w http.ResponseWriter, r *http.Request) {
+	email := r.URL.Query().Get("email")
+	if email == "" {
+		http.Error(w, "Missing required query parameter: email", http.StatusBadRequest)
+		return
+	}
+
+	retryAfter, err := caching.AllowConfirmationStatus(normalizeEmail(email), clientIP(r))
+	if err != nil {
+		http.Error(w, "Failed to fetch account status", http.StatusInternalServerError)
+		return
+	}
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", formatSeconds(retryAfter))
+		http.Error(w, "Too many requests, please try again later", http.StatusTooManyRequests)
+		return
+	}
+
+	confirmed, err := identity.Provider.IsConfirmed(r.Context(), email)
+	if err != nil && !errors.Is(err, identity.ErrUserNotFound) {
+		http.Error(w, "Failed to fetch account status", http.StatusInternalServerError)
+		logging.Errorf(r.Context(), "Identity provider IsConfirmed failed: %v", err)
+		return
+	}
+
+	status := "confirmed"
+	if !confirmed {
+		status = "pending_confirmation"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": status,
+	})
+}
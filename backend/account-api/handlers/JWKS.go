@@ -0,0 +1,16 @@
+package handlers
+
+import (
+	"account-api/config"
+	"encoding/json"
+	"net/http"
+)
+
+// JWKS publishes the public keys access tokens can be verified with
+func JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	// Short enough that a rotation is picked up quickly; verifiers also
+	// refetch when they see an unknown kid
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(config.Keys.KeySet())
+}
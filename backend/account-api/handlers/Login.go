@@ -1,75 +1,161 @@
 package handlers
 
 import (
-	"account-api/auth"
 	"account-api/caching"
-	"account-api/models"
+	"account-api/config"
+	"account-api/identity"
+	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"github.com/gocql/gocql"
 	"net/http"
+	"shared/logging"
+	"shared/models"
 	"time"
 )
 
 // Login handles user login using Cognito authentication and JWT generation
 func Login(w http.ResponseWriter, r *http.Request) {
-	var account models.Account
+	// The device name is optional and labels the session in the sessions list
+	var request struct {
+		models.Account
+		DeviceName string `json:"device_name"`
+	}
 	// Decode the incoming request body into the account struct
-	if err := json.NewDecoder(r.Body).Decode(&account); err != nil {
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		http.Error(w, "Invalid request payload", http.StatusBadRequest)
-		log.Printf("Error decoding request payload: %v", err)
+		logging.Printf(r.Context(), "Error decoding request payload: %v", err)
 		return
 	}
+	account := request.Account
 
 	// Ensure email and password are provided
 	if account.Email == "" || account.Password == "" {
 		http.Error(w, "Missing required fields: email or password", http.StatusBadRequest)
-		log.Println("Missing email or password")
+		logging.Printf(r.Context(), "Missing email or password")
 		return
 	}
 
 	// Use the Email as the Username for Cognito Authentication
 	account.Username = account.Email // Now treating Email as Username
 
-	// Step 1: Authenticate with Cognito using Email (now as Username)
-	authOutput, err := auth.CognitoAuthenticate(account.Username, account.Password)
+	// Refuse attempts while the account or this address is locked out
+	email, ip := normalizeEmail(account.Email), clientIP(r)
+	if !allowLoginAttempt(w, r, email, ip) {
+		return
+	}
+
+	// Step 1: Authenticate with the identity provider using Email (now as Username)
+	result, err := identity.Provider.Authenticate(r.Context(), account.Username, account.Password)
 	if err != nil {
+		if errors.Is(err, identity.ErrLimitExceeded) {
+			http.Error(w, "Too many login attempts, please try again later", http.StatusTooManyRequests)
+			return
+		}
+		if errors.Is(err, identity.ErrNotAuthorized) || errors.Is(err, identity.ErrUserNotFound) {
+			recordLoginFailure(r.Context(), email, ip)
+		}
 		http.Error(w, "Authentication failed", http.StatusUnauthorized)
-		log.Printf("Authentication failed for user %s: %v", account.Email, err)
+		logging.Printf(r.Context(), "Authentication failed for user %s: %v", account.Email, err)
 		return
 	}
 
-	// Step 2: Extract the user ID from the Cognito ID token
-	idToken := authOutput.AuthenticationResult.IdToken
-	userID, err := auth.ExtractSubFromIDToken(*idToken)
+	// Step 2: If the account has MFA enabled, the provider answers with a
+	// challenge instead of tokens; hand the client a challenge token for /login/mfa
+	if result.Challenge != nil {
+		startMFAChallenge(w, r, account.Email, result.Challenge, request.DeviceName)
+		return
+	}
+
+	// Step 3: Start the session and issue tokens
+	if err := caching.ClearLoginFailures(email); err != nil {
+		logging.Printf(r.Context(), "Error clearing login failures for %s: %v", email, err)
+	}
+	completeLogin(w, r, result.UserID, request.DeviceName)
+}
+
+// allowLoginAttempt answers 429 with Retry-After and returns false while
+// logins for the account or from the IP are blocked after repeated failures
+func allowLoginAttempt(w http.ResponseWriter, r *http.Request, email, ip string) bool {
+	retryAfter, err := caching.LoginBlocked(email, ip)
 	if err != nil {
-		http.Error(w, "Failed to extract user ID from token", http.StatusInternalServerError)
-		log.Printf("Error extracting user ID from ID token: %v", err)
+		http.Error(w, "Failed to log in", http.StatusInternalServerError)
+		return false
+	}
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", formatSeconds(retryAfter))
+		http.Error(w, "Too many failed login attempts, please try again later", http.StatusTooManyRequests)
+		logging.Printf(r.Context(), "Login blocked for %s from %s for another %s", email, ip, retryAfter)
+		return false
+	}
+	return true
+}
+
+// recordLoginFailure counts a wrong password or MFA code towards the lockout
+func recordLoginFailure(ctx context.Context, email, ip string) {
+	if _, err := caching.RecordLoginFailure(email, ip); err != nil {
+		logging.Printf(ctx, "Error recording login failure for %s: %v", email, err)
+	}
+}
+
+// completeLogin starts a session for an authenticated user and responds with
+// its tokens. It is shared by password login and the MFA step.
+func completeLogin(w http.ResponseWriter, r *http.Request, userID, deviceName string) {
+	// Start a session for this device
+	now := time.Now()
+	expiresAt := config.Tokens.SessionExpiry(now)
+	userAgent := r.UserAgent()
+	if deviceName == "" {
+		deviceName = describeDevice(userAgent)
+	}
+	session := &caching.Session{
+		SessionID: gocql.MustRandomUUID().String(),
+		UserID:    userID,
+		Device:    deviceName,
+		UserAgent: userAgent,
+		IPAddress: clientIP(r),
+		CreatedAt: now.Unix(),
+		ExpiresAt: expiresAt.Unix(),
+		LastSeen:  now.Unix(),
+	}
+	if err := config.Sessions.Create(r.Context(), session); err != nil {
+		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		logging.Errorf(r.Context(), "Error creating session for user %s: %v", userID, err)
 		return
 	}
 
-	// Step 3: Generate a JWT for the authenticated user
-	jwtToken, err := auth.GenerateJWT(userID)
+	// Issue an access token and the first refresh token of the session
+	jwtToken, accessExpiresAt, err := issueAccessToken(session)
 	if err != nil {
 		http.Error(w, "Failed to generate JWT", http.StatusInternalServerError)
-		log.Printf("Error generating JWT for user %s: %v", userID, err)
+		logging.Errorf(r.Context(), "Error generating JWT for user %s: %v", userID, err)
 		return
 	}
-
-	// Step 4: Store the generated JWT in Redis (as an account cache)
-	expiresIn := time.Now().Add(24 * time.Hour).Unix() // Token expiry time (24 hours)
-	err = caching.StoreToken(userID, jwtToken, expiresIn)
+	refreshToken, err := config.Sessions.IssueRefreshToken(r.Context(), session)
 	if err != nil {
-		http.Error(w, "Failed to store JWT in Redis", http.StatusInternalServerError)
-		log.Printf("Error storing JWT in Redis for user %s: %v", userID, err)
+		http.Error(w, "Failed to generate refresh token", http.StatusInternalServerError)
+		logging.Errorf(r.Context(), "Error issuing refresh token for user %s: %v", userID, err)
 		return
 	}
 
-	// Step 5: Respond with the login success message and token data
-	response := map[string]interface{}{
-		"message":   "Login successful",
-		"user_id":   userID,
-		"jwt_token": jwtToken,
+	// Respond with the login success message and token data
+	response := models.TokenResponse{
+		Message:      "Login successful",
+		UserID:       userID,
+		JWTToken:     jwtToken,
+		ExpiresAt:    accessExpiresAt.Unix(),
+		ExpiresIn:    int64(time.Until(accessExpiresAt).Seconds()),
+		RefreshToken: refreshToken,
+		SessionID:    session.SessionID,
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
+
+// issueAccessToken generates a short-lived JWT for the session
+func issueAccessToken(session *caching.Session) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := config.Tokens.AccessExpiry(now, time.Unix(session.ExpiresAt, 0))
+	jwtToken, err := config.Issuer.Issue(session.UserID, session.SessionID, now, expiresAt)
+	return jwtToken, expiresAt, err
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"account-api/caching"
+	"account-api/config"
+	"shared/auth"
+	"shared/logging"
+	"shared/pat"
+)
+
+// Logout revokes the session the request was made with
+func Logout(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		logging.Printf(r.Context(), "User ID not found in context")
+		return
+	}
+	sessionID, ok := auth.SessionIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		logging.Printf(r.Context(), "Session ID not found in context")
+		return
+	}
+
+	if err := config.Sessions.Revoke(r.Context(), userID, sessionID); err != nil && err != caching.ErrSessionNotFound {
+		http.Error(w, "Failed to log out", http.StatusInternalServerError)
+		logging.Errorf(r.Context(), "Error revoking session %s for user %s: %v", sessionID, userID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Logged out successfully",
+	})
+}
+
+// LogoutAll revokes every session and personal access token belonging to the
+// user, logging them out on all devices and scripts
+func LogoutAll(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		logging.Printf(r.Context(), "User ID not found in context")
+		return
+	}
+
+	// Without Cassandra the sessions are still revoked; only the access
+	// tokens are left in place
+	var tokens *pat.Store
+	if session := RetrieveSession(r); session != nil {
+		tokens = pat.NewStore(session)
+	}
+	if err := pat.RevokeCredentials(r.Context(), config.Sessions, tokens, userID, ""); err != nil {
+		message := "Logged out of all sessions but access tokens could not be revoked"
+		if errors.Is(err, pat.ErrSessionsNotRevoked) {
+			message = "Failed to log out"
+		}
+		http.Error(w, message, http.StatusInternalServerError)
+		logging.Errorf(r.Context(), "Error revoking credentials of user %s: %v", userID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Logged out of all sessions successfully",
+	})
+}
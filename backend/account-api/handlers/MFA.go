@@ -0,0 +1,512 @@
+package handlers
+
+import (
+	"account-api/caching"
+	"account-api/identity"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"shared/auth"
+	"shared/logging"
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+const (
+	// mfaIssuer is the account name authenticator apps show for the TOTP entry
+	mfaIssuer = "Canvis Collab"
+	// recoveryCodeCount is how many recovery codes are issued at a time
+	recoveryCodeCount = 10
+)
+
+// startMFAChallenge stores a login that the identity provider answered with
+// an MFA challenge and responds with the challenge token to send to LoginMFA
+func startMFAChallenge(w http.ResponseWriter, r *http.Request, email string, challenge *identity.Challenge, deviceName string) {
+	challengeID, err := randomToken()
+	if err != nil {
+		http.Error(w, "Failed to start MFA challenge", http.StatusInternalServerError)
+		logging.Errorf(r.Context(), "Error generating MFA challenge ID: %v", err)
+		return
+	}
+
+	err = caching.StoreMFAChallenge(challengeID, caching.MFAChallenge{
+		Email:            email,
+		Username:         challenge.Username,
+		ChallengeSession: challenge.Session,
+		DeviceName:       deviceName,
+	})
+	if err != nil {
+		http.Error(w, "Failed to start MFA challenge", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":      "MFA code required",
+		"mfa_required": true,
+		"challenge":    challenge.Name,
+		"mfa_token":    challengeID,
+		"expires_in":   int64(caching.MFAChallengeLifetime.Seconds()),
+	})
+}
+
+// LoginMFA completes a login that required MFA. It takes the mfa_token from
+// Login and either the TOTP code, or a recovery code together with the
+// password. Using a recovery code disables MFA so the user can enroll again.
+func LoginMFA(w http.ResponseWriter, r *http.Request) {
+	session := RetrieveSession(r)
+	if session == nil {
+		http.Error(w, "Cassandra session not available", http.StatusInternalServerError)
+		return
+	}
+
+	var request struct {
+		MFAToken     string `json:"mfa_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+		Password     string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		logging.Printf(r.Context(), "Error decoding request payload: %v", err)
+		return
+	}
+	if request.MFAToken == "" || (request.Code == "" && request.RecoveryCode == "") {
+		http.Error(w, "Missing required fields: mfa_token and code or recovery_code", http.StatusBadRequest)
+		return
+	}
+
+	challenge, err := caching.GetMFAChallenge(request.MFAToken)
+	if err == caching.ErrMFAChallengeNotFound {
+		http.Error(w, "MFA challenge expired, please log in again", http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to complete login", http.StatusInternalServerError)
+		return
+	}
+
+	// Wrong codes count towards the same lockout as wrong passwords
+	email, ip := normalizeEmail(challenge.Email), clientIP(r)
+	if !allowLoginAttempt(w, r, email, ip) {
+		return
+	}
+
+	if request.RecoveryCode != "" {
+		loginWithRecoveryCode(w, r, session, request.MFAToken, challenge, request.RecoveryCode, request.Password)
+		return
+	}
+
+	result, err := identity.Provider.RespondToMFAChallenge(r.Context(), &identity.Challenge{
+		Name:     identity.ChallengeSoftwareTokenMFA,
+		Username: challenge.Username,
+		Session:  challenge.ChallengeSession,
+	}, request.Code)
+	if err != nil {
+		if errors.Is(err, identity.ErrCodeMismatch) || errors.Is(err, identity.ErrNotAuthorized) {
+			recordLoginFailure(r.Context(), email, ip)
+		}
+		http.Error(w, "Invalid MFA code", http.StatusUnauthorized)
+		return
+	}
+
+	if err := caching.DeleteMFAChallenge(request.MFAToken); err != nil {
+		logging.Printf(r.Context(), "Error deleting completed MFA challenge: %v", err)
+	}
+	if err := caching.ClearLoginFailures(email); err != nil {
+		logging.Printf(r.Context(), "Error clearing login failures for %s: %v", email, err)
+	}
+	completeLogin(w, r, result.UserID, challenge.DeviceName)
+}
+
+// loginWithRecoveryCode finishes an MFA login with a recovery code. The
+// provider cannot complete the challenge without a TOTP code, so MFA is turned
+// off through its admin API and the password is checked again to get tokens.
+func loginWithRecoveryCode(w http.ResponseWriter, r *http.Request, session *gocql.Session, challengeID string, challenge *caching.MFAChallenge, recoveryCode, password string) {
+	if password == "" {
+		http.Error(w, "Missing required field: password", http.StatusBadRequest)
+		return
+	}
+
+	// Check the password before touching any state; with MFA still on, a
+	// correct password is answered by another challenge
+	email, ip := normalizeEmail(challenge.Email), clientIP(r)
+	if _, err := identity.Provider.Authenticate(r.Context(), challenge.Email, password); err != nil {
+		if errors.Is(err, identity.ErrNotAuthorized) {
+			recordLoginFailure(r.Context(), email, ip)
+		}
+		http.Error(w, "Authentication failed", http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := resolveUserID(r.Context(), session, challenge.Email)
+	if err != nil {
+		http.Error(w, "Invalid recovery code", http.StatusUnauthorized)
+		logging.Printf(r.Context(), "Error looking up user for recovery login: %v", err)
+		return
+	}
+
+	used, err := consumeRecoveryCode(session, userID, recoveryCode)
+	if err != nil {
+		http.Error(w, "Failed to complete login", http.StatusInternalServerError)
+		logging.Errorf(r.Context(), "Error consuming recovery code for user %s: %v", userID, err)
+		return
+	}
+	if !used {
+		recordLoginFailure(r.Context(), email, ip)
+		http.Error(w, "Invalid recovery code", http.StatusUnauthorized)
+		return
+	}
+
+	if err := identity.Provider.AdminDisableSoftwareTokenMFA(r.Context(), challenge.Username); err != nil {
+		http.Error(w, "Failed to complete login", http.StatusInternalServerError)
+		logging.Errorf(r.Context(), "Identity provider AdminDisableSoftwareTokenMFA failed for user %s: %v", userID, err)
+		return
+	}
+	if err := deleteRecoveryCodes(session, userID); err != nil {
+		logging.Printf(r.Context(), "Error deleting recovery codes for user %s: %v", userID, err)
+	}
+	logging.Printf(r.Context(), "MFA disabled for user %s after recovery code login", userID)
+
+	result, err := identity.Provider.Authenticate(r.Context(), challenge.Email, password)
+	if err != nil || result.Challenge != nil {
+		http.Error(w, "Authentication failed", http.StatusUnauthorized)
+		return
+	}
+
+	if err := caching.DeleteMFAChallenge(challengeID); err != nil {
+		logging.Printf(r.Context(), "Error deleting completed MFA challenge: %v", err)
+	}
+	if err := caching.ClearLoginFailures(email); err != nil {
+		logging.Printf(r.Context(), "Error clearing login failures for %s: %v", email, err)
+	}
+	completeLogin(w, r, result.UserID, challenge.DeviceName)
+}
+
+// MFAStatus reports whether TOTP MFA is enabled and how many recovery codes are left
+func MFAStatus(w http.ResponseWriter, r *http.Request) {
+	session := RetrieveSession(r)
+	if session == nil {
+		http.Error(w, "Cassandra session not available", http.StatusInternalServerError)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		logging.Printf(r.Context(), "User ID not found in context")
+		return
+	}
+
+	email, err := lookupEmail(session, userID)
+	if err != nil {
+		http.Error(w, "Failed to fetch MFA status", http.StatusInternalServerError)
+		logging.Errorf(r.Context(), "Error fetching email for user %s: %v", userID, err)
+		return
+	}
+
+	enabled, err := identity.Provider.MFAEnabled(r.Context(), email)
+	if err != nil {
+		http.Error(w, "Failed to fetch MFA status", http.StatusInternalServerError)
+		logging.Errorf(r.Context(), "Identity provider MFAEnabled failed for user %s: %v", userID, err)
+		return
+	}
+
+	var remaining int
+	err = session.Query(`SELECT COUNT(*) FROM mfa_recovery_codes WHERE user_id = ?`, userID).Scan(&remaining)
+	if err != nil {
+		http.Error(w, "Failed to fetch MFA status", http.StatusInternalServerError)
+		logging.Errorf(r.Context(), "Error counting recovery codes for user %s: %v", userID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"enabled":                  enabled,
+		"recovery_codes_remaining": remaining,
+	})
+}
+
+// SetupMFA starts TOTP enrollment and returns the secret for the authenticator
+// app. Nothing is kept between requests; VerifyMFA asks for the password again.
+func SetupMFA(w http.ResponseWriter, r *http.Request) {
+	session := RetrieveSession(r)
+	if session == nil {
+		http.Error(w, "Cassandra session not available", http.StatusInternalServerError)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		logging.Printf(r.Context(), "User ID not found in context")
+		return
+	}
+
+	var request struct {
+		Password string `json:"password"`
+		MFACode  string `json:"mfa_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		logging.Printf(r.Context(), "Error decoding request payload: %v", err)
+		return
+	}
+	if request.Password == "" {
+		http.Error(w, "Missing required field: password", http.StatusBadRequest)
+		return
+	}
+
+	accessToken, _, ok := reauthenticate(w, r, session, userID, request.Password, request.MFACode)
+	if !ok {
+		return
+	}
+
+	secret, err := identity.Provider.AssociateSoftwareToken(r.Context(), accessToken)
+	if err != nil {
+		http.Error(w, "Failed to start MFA setup", http.StatusInternalServerError)
+		logging.Errorf(r.Context(), "Identity provider AssociateSoftwareToken failed for user %s: %v", userID, err)
+		return
+	}
+
+	email, _ := lookupEmail(session, userID)
+	otpauthURI := (&url.URL{
+		Scheme: "otpauth",
+		Host:   "totp",
+		Path:   "/" + mfaIssuer + ":" + email,
+		RawQuery: url.Values{
+			"secret": {secret},
+			"issuer": {mfaIssuer},
+		}.Encode(),
+	}).String()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message":     "Add the secret to your authenticator app, then verify a code to enable MFA",
+		"secret_code": secret,
+		"otpauth_uri": otpauthURI,
+	})
+}
+
+// VerifyMFA finishes TOTP enrollment with a code from the authenticator app,
+// enables MFA and returns a fresh set of recovery codes. The codes are only
+// shown this once. The password is asked for again, as in VerifyEmailChange,
+// to get a provider access token for the enrollment.
+func VerifyMFA(w http.ResponseWriter, r *http.Request) {
+	session := RetrieveSession(r)
+	if session == nil {
+		http.Error(w, "Cassandra session not available", http.StatusInternalServerError)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		logging.Printf(r.Context(), "User ID not found in context")
+		return
+	}
+
+	var request struct {
+		Code       string `json:"code"`
+		DeviceName string `json:"device_name"`
+		Password   string `json:"password"`
+		MFACode    string `json:"mfa_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		logging.Printf(r.Context(), "Error decoding request payload: %v", err)
+		return
+	}
+	if request.Code == "" || request.Password == "" {
+		http.Error(w, "Missing required fields: code or password", http.StatusBadRequest)
+		return
+	}
+
+	accessToken, _, ok := reauthenticate(w, r, session, userID, request.Password, request.MFACode)
+	if !ok {
+		return
+	}
+
+	err := identity.Provider.VerifySoftwareToken(r.Context(), accessToken, request.Code, request.DeviceName)
+	if err != nil {
+		http.Error(w, "Invalid MFA code", http.StatusBadRequest)
+		logging.Printf(r.Context(), "Identity provider VerifySoftwareToken failed for user %s: %v", userID, err)
+		return
+	}
+
+	if err := identity.Provider.SetSoftwareTokenMFA(r.Context(), accessToken, true); err != nil {
+		http.Error(w, "Failed to enable MFA", http.StatusInternalServerError)
+		logging.Errorf(r.Context(), "Identity provider SetSoftwareTokenMFA failed for user %s: %v", userID, err)
+		return
+	}
+
+	codes, err := replaceRecoveryCodes(session, userID)
+	if err != nil {
+		http.Error(w, "MFA was enabled but recovery codes could not be generated", http.StatusInternalServerError)
+		logging.Errorf(r.Context(), "Error generating recovery codes for user %s: %v", userID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":        "MFA enabled. Store these recovery codes somewhere safe; they will not be shown again.",
+		"recovery_codes": codes,
+	})
+}
+
+// DisableMFA turns off TOTP MFA after checking the password and a current code
+func DisableMFA(w http.ResponseWriter, r *http.Request) {
+	session := RetrieveSession(r)
+	if session == nil {
+		http.Error(w, "Cassandra session not available", http.StatusInternalServerError)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		logging.Printf(r.Context(), "User ID not found in context")
+		return
+	}
+
+	var request struct {
+		Password string `json:"password"`
+		MFACode  string `json:"mfa_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		logging.Printf(r.Context(), "Error decoding request payload: %v", err)
+		return
+	}
+	if request.Password == "" {
+		http.Error(w, "Missing required field: password", http.StatusBadRequest)
+		return
+	}
+
+	accessToken, _, ok := reauthenticate(w, r, session, userID, request.Password, request.MFACode)
+	if !ok {
+		return
+	}
+
+	if err := identity.Provider.SetSoftwareTokenMFA(r.Context(), accessToken, false); err != nil {
+		http.Error(w, "Failed to disable MFA", http.StatusInternalServerError)
+		logging.Errorf(r.Context(), "Identity provider SetSoftwareTokenMFA failed for user %s: %v", userID, err)
+		return
+	}
+
+	if err := deleteRecoveryCodes(session, userID); err != nil {
+		logging.Printf(r.Context(), "Error deleting recovery codes for user %s: %v", userID, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "MFA disabled",
+	})
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes with a new set
+func RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	session := RetrieveSession(r)
+	if session == nil {
+		http.Error(w, "Cassandra session not available", http.StatusInternalServerError)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		logging.Printf(r.Context(), "User ID not found in context")
+		return
+	}
+
+	var request struct {
+		Password string `json:"password"`
+		MFACode  string `json:"mfa_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		logging.Printf(r.Context(), "Error decoding request payload: %v", err)
+		return
+	}
+	if request.Password == "" || request.MFACode == "" {
+		http.Error(w, "Missing required fields: password or mfa_code", http.StatusBadRequest)
+		return
+	}
+
+	if _, _, ok := reauthenticate(w, r, session, userID, request.Password, request.MFACode); !ok {
+		return
+	}
+
+	codes, err := replaceRecoveryCodes(session, userID)
+	if err != nil {
+		http.Error(w, "Failed to generate recovery codes", http.StatusInternalServerError)
+		logging.Errorf(r.Context(), "Error generating recovery codes for user %s: %v", userID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":        "Recovery codes regenerated. Previous codes no longer work.",
+		"recovery_codes": codes,
+	})
+}
+
+// randomToken returns an unguessable URL-safe token
+func randomToken() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return strings.TrimRight(base32.StdEncoding.EncodeToString(raw), "="), nil
+}
+
+// hashRecoveryCode normalizes a recovery code as typed by the user and hashes it
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// replaceRecoveryCodes deletes the user's recovery codes and stores a new set,
+// returning the plaintext codes
+func replaceRecoveryCodes(session *gocql.Session, userID string) ([]string, error) {
+	if err := deleteRecoveryCodes(session, userID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	codes := make([]string, 0, recoveryCodeCount)
+	batch := session.NewBatch(gocql.LoggedBatch)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw := make([]byte, 7)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		encoded := strings.ToLower(base32.StdEncoding.EncodeToString(raw))[:10]
+		code := encoded[:5] + "-" + encoded[5:]
+		codes = append(codes, code)
+		batch.Query(`INSERT INTO mfa_recovery_codes (user_id, code_hash, created_at) VALUES (?, ?, ?)`,
+			userID, hashRecoveryCode(code), now)
+	}
+	if err := session.ExecuteBatch(batch); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// consumeRecoveryCode deletes a matching recovery code, reporting whether one
+// existed. The conditional delete makes each code usable only once.
+func consumeRecoveryCode(session *gocql.Session, userID, code string) (bool, error) {
+	applied, err := session.Query(`DELETE FROM mfa_recovery_codes WHERE user_id = ? AND code_hash = ? IF EXISTS`,
+		userID, hashRecoveryCode(code)).ScanCAS()
+	if err != nil && !errors.Is(err, gocql.ErrNotFound) {
+		return false, err
+	}
+	return applied, nil
+}
+
+// deleteRecoveryCodes removes all of the user's recovery codes
+func deleteRecoveryCodes(session *gocql.Session, userID string) error {
+	return session.Query(`DELETE FROM mfa_recovery_codes WHERE user_id = ?`, userID).Exec()
+}
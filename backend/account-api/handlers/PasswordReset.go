@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"account-api/config"
+	"account-api/identity"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"shared/logging"
+	"shared/pat"
+)
+
+// ForgotPassword sends a password reset code to the user's email through the identity provider.
+// The response is the same whether or not the email is registered, so the
+// endpoint cannot be used to probe for accounts.
+func ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		logging.Printf(r.Context(), "Error decoding request payload: %v", err)
+		return
+	}
+	if request.Email == "" {
+		http.Error(w, "Missing required field: email", http.StatusBadRequest)
+		return
+	}
+
+	// The email is the username
+	if err := identity.Provider.ForgotPassword(r.Context(), request.Email); err != nil {
+		// Logged for operators only; the caller gets the generic response
+		logging.Printf(r.Context(), "Identity provider ForgotPassword failed: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "If an account exists for this email, a password reset code has been sent.",
+	})
+}
+
+// ResetPassword sets a new password using the code sent by ForgotPassword and
+// revokes all of the user's existing sessions and personal access tokens
+func ResetPassword(w http.ResponseWriter, r *http.Request) {
+	session := RetrieveSession(r)
+	if session == nil {
+		http.Error(w, "Cassandra session not available", http.StatusInternalServerError)
+		return
+	}
+
+	var request struct {
+		Email       string `json:"email"`
+		Code        string `json:"code"`
+		NewPassword string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		logging.Printf(r.Context(), "Error decoding request payload: %v", err)
+		return
+	}
+	if request.Email == "" || request.Code == "" || request.NewPassword == "" {
+		http.Error(w, "Missing required fields: email, code or new_password", http.StatusBadRequest)
+		return
+	}
+
+	err := identity.Provider.ConfirmForgotPassword(r.Context(), request.Email, request.Code, request.NewPassword)
+	if err != nil {
+		logging.Printf(r.Context(), "Identity provider ConfirmForgotPassword failed: %v", err)
+		switch {
+		case errors.Is(err, identity.ErrInvalidPassword):
+			http.Error(w, "New password does not meet the password requirements", http.StatusBadRequest)
+		case errors.Is(err, identity.ErrLimitExceeded):
+			http.Error(w, "Too many attempts, please try again later", http.StatusTooManyRequests)
+		default:
+			// Unknown users get the same answer as a wrong code
+			http.Error(w, "Invalid or expired reset code", http.StatusBadRequest)
+		}
+		return
+	}
+
+	// Existing sessions and access tokens may belong to whoever knew the old password
+	userID, err := resolveUserID(r.Context(), session, request.Email)
+	if err != nil {
+		http.Error(w, "Password was reset but existing sessions could not be revoked", http.StatusInternalServerError)
+		logging.Errorf(r.Context(), "Error looking up user for password reset: %v", err)
+		return
+	}
+	if err := pat.RevokeCredentials(r.Context(), config.Sessions, pat.NewStore(session), userID, ""); err != nil {
+		message := "Password was reset but existing access tokens could not be revoked"
+		if errors.Is(err, pat.ErrSessionsNotRevoked) {
+			message = "Password was reset but existing sessions could not be revoked"
+		}
+		http.Error(w, message, http.StatusInternalServerError)
+		logging.Errorf(r.Context(), "Error revoking credentials of user %s after password reset: %v", userID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Password reset successfully. Please log in with your new password.",
+	})
+}
@@ -0,0 +1,439 @@
+package handlers
+
+import (
+	"account-api/blobstore"
+	"account-api/config"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"shared/auth"
+	"shared/logging"
+	"shared/models"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gocql/gocql"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// maxDisplayNameLength is counted in characters
+	maxDisplayNameLength = 50
+	// maxAvatarSize is the largest avatar upload accepted, in bytes
+	maxAvatarSize = 2 << 20
+	// maxLookupUserIDs caps a single /users/lookup request
+	maxLookupUserIDs = 100
+)
+
+var (
+	// defaultPreferences apply until the user sets their own
+	defaultPreferences = models.Preferences{DefaultBrush: "pen", DefaultColor: "#000000", Theme: "system"}
+	brushes            = map[string]bool{"pen": true, "pencil": true, "marker": true, "highlighter": true}
+	themes             = map[string]bool{"light": true, "dark": true, "system": true}
+	hexColor           = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+	// avatarTypes are the image types accepted as avatars, with their file extension
+	avatarTypes = map[string]string{"image/png": ".png", "image/jpeg": ".jpg", "image/gif": ".gif", "image/webp": ".webp"}
+)
+
+var errUserNotFound = errors.New("user not found")
+
+// avatarURL is where clients load the avatar stored under key
+func avatarURL(key string) string {
+	if key == "" {
+		return ""
+	}
+	return strings.TrimSuffix(config.AvatarBaseURL, "/") + "/" + key
+}
+
+// loadProfile reads the user's row, filling in defaults for unset fields
+func loadProfile(session *gocql.Session, userID string) (*models.Profile, string, error) {
+	profile := &models.Profile{UserID: userID, Timezone: "UTC"}
+	var avatarKey, brush, color, theme string
+	err := session.Query(`SELECT email, display_name, avatar_key, timezone, default_brush, default_color, theme, discoverable
+		FROM users WHERE user_id = ?`, userID).Scan(
+		&profile.Email, &profile.DisplayName, &avatarKey, &profile.Timezone, &brush, &color, &theme, &profile.Discoverable)
+	if err == gocql.ErrNotFound {
+		return nil, "", errUserNotFound
+	} else if err != nil {
+		return nil, "", err
+	}
+
+	if profile.Timezone == "" {
+		profile.Timezone = "UTC"
+	}
+	profile.AvatarURL = avatarURL(avatarKey)
+	profile.Preferences = defaultPreferences
+	if brush != "" {
+		profile.Preferences.DefaultBrush = brush
+	}
+	if color != "" {
+		profile.Preferences.DefaultColor = color
+	}
+	if theme != "" {
+		profile.Preferences.Theme = theme
+	}
+	return profile, avatarKey, nil
+}
+
+// GetMe returns the caller's profile
+func GetMe(w http.ResponseWriter, r *http.Request) {
+	session := RetrieveSession(r)
+	if session == nil {
+		http.Error(w, "Cassandra session not available", http.StatusInternalServerError)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		logging.Printf(r.Context(), "User ID not found in context")
+		return
+	}
+
+	profile, _, err := loadProfile(session, userID)
+	if err == errUserNotFound {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to load profile", http.StatusInternalServerError)
+		logging.Errorf(r.Context(), "Error loading profile of user %s: %v", userID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profile)
+}
+
+// profileUpdate is the body of a PATCH /me. Fields left out are not changed.
+type profileUpdate struct {
+	DisplayName  *string `json:"display_name"`
+	Timezone     *string `json:"timezone"`
+	Discoverable *bool   `json:"discoverable"`
+	Preferences  *struct {
+		DefaultBrush *string `json:"default_brush"`
+		DefaultColor *string `json:"default_color"`
+		Theme        *string `json:"theme"`
+	} `json:"preferences"`
+}
+
+// changes validates the update and returns the users columns to set, as
+// "column = ?", with their values. The error is the message for the client.
+func (u *profileUpdate) changes() ([]string, []interface{}, error) {
+	var columns []string
+	var values []interface{}
+	set := func(column string, value interface{}) {
+		columns = append(columns, column+" = ?")
+		values = append(values, value)
+	}
+
+	if u.DisplayName != nil {
+		displayName := strings.TrimSpace(*u.DisplayName)
+		if displayName == "" || utf8.RuneCountInString(displayName) > maxDisplayNameLength {
+			return nil, nil, errors.New("Display name must be between 1 and 50 characters")
+		}
+		set("display_name", displayName)
+	}
+	if u.Timezone != nil {
+		if _, err := time.LoadLocation(*u.Timezone); err != nil || *u.Timezone == "" {
+			return nil, nil, errors.New("Timezone must be an IANA name such as Europe/London")
+		}
+		set("timezone", *u.Timezone)
+	}
+	if u.Discoverable != nil {
+		set("discoverable", *u.Discoverable)
+	}
+	if prefs := u.Preferences; prefs != nil {
+		if prefs.DefaultBrush != nil {
+			if !brushes[*prefs.DefaultBrush] {
+				return nil, nil, errors.New("Default brush must be one of pen, pencil, marker or highlighter")
+			}
+			set("default_brush", *prefs.DefaultBrush)
+		}
+		if prefs.DefaultColor != nil {
+			if !hexColor.MatchString(*prefs.DefaultColor) {
+				return nil, nil, errors.New("Default color must be a hex color such as #1a2b3c")
+			}
+			set("default_color", strings.ToLower(*prefs.DefaultColor))
+		}
+		if prefs.Theme != nil {
+			if !themes[*prefs.Theme] {
+				return nil, nil, errors.New("Theme must be one of light, dark or system")
+			}
+			set("theme", *prefs.Theme)
+		}
+	}
+	if len(columns) == 0 {
+		return nil, nil, errors.New("No fields to update")
+	}
+	return columns, values, nil
+}
+
+// UpdateMe changes the caller's display name, timezone, preferences or
+// discoverability. Only the fields present in the request are changed.
+func UpdateMe(w http.ResponseWriter, r *http.Request) {
+	session := RetrieveSession(r)
+	if session == nil {
+		http.Error(w, "Cassandra session not available", http.StatusInternalServerError)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		logging.Printf(r.Context(), "User ID not found in context")
+		return
+	}
+
+	var request profileUpdate
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		logging.Printf(r.Context(), "Error decoding request payload: %v", err)
+		return
+	}
+	columns, values, err := request.changes()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The old name and discoverability are needed to keep the search index in step
+	before, _, err := loadProfile(session, userID)
+	if err == errUserNotFound {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to update profile", http.StatusInternalServerError)
+		logging.Errorf(r.Context(), "Error loading profile of user %s: %v", userID, err)
+		return
+	}
+
+	// Lightweight transaction so a PATCH for a deleted user cannot recreate the row
+	values = append(values, userID)
+	applied, err := session.Query(`UPDATE users SET `+strings.Join(columns, ", ")+` WHERE user_id = ? IF EXISTS`,
+		values...).MapScanCAS(map[string]interface{}{})
+	if err != nil {
+		http.Error(w, "Failed to update profile", http.StatusInternalServerError)
+		logging.Errorf(r.Context(), "Error updating profile of user %s: %v", userID, err)
+		return
+	}
+	if !applied {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	after := *before
+	if request.DisplayName != nil {
+		after.DisplayName = strings.TrimSpace(*request.DisplayName)
+	}
+	if request.Discoverable != nil {
+		after.Discoverable = *request.Discoverable
+	}
+	if err := updateDisplayNameIndex(session, before, &after); err != nil {
+		// The profile itself was saved; searches stay stale until the next update
+		logging.Printf(r.Context(), "Error updating display name index for user %s: %v", userID, err)
+	}
+
+	GetMe(w, r)
+}
+
+// UploadAvatar replaces the caller's avatar with the image in the "avatar"
+// field of a multipart form
+func UploadAvatar(w http.ResponseWriter, r *http.Request) {
+	session := RetrieveSession(r)
+	if session == nil {
+		http.Error(w, "Cassandra session not available", http.StatusInternalServerError)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		logging.Printf(r.Context(), "User ID not found in context")
+		return
+	}
+
+	// Leave room for the multipart framing around the image
+	r.Body = http.MaxBytesReader(w, r.Body, maxAvatarSize+64<<10)
+	file, _, err := r.FormFile("avatar")
+	if err != nil {
+		http.Error(w, "Avatar must be an image of at most 2 MB in the avatar form field", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxAvatarSize+1))
+	if err != nil || len(data) > maxAvatarSize {
+		http.Error(w, "Avatar must be an image of at most 2 MB in the avatar form field", http.StatusBadRequest)
+		return
+	}
+	// The type is sniffed from the content; the client's claim is not trusted
+	extension, ok := avatarTypes[http.DetectContentType(data)]
+	if !ok {
+		http.Error(w, "Avatar must be a PNG, JPEG, GIF or WebP image", http.StatusBadRequest)
+		return
+	}
+
+	_, oldKey, err := loadProfile(session, userID)
+	if err == errUserNotFound {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to update avatar", http.StatusInternalServerError)
+		logging.Errorf(r.Context(), "Error loading profile of user %s: %v", userID, err)
+		return
+	}
+
+	// Every upload gets a new key, so avatar URLs can be cached forever
+	key := userID + "/" + gocql.MustRandomUUID().String() + extension
+	if err := blobstore.Avatars.Put(r.Context(), key, bytes.NewReader(data)); err != nil {
+		http.Error(w, "Failed to store avatar", http.StatusInternalServerError)
+		logging.Errorf(r.Context(), "Error storing avatar for user %s: %v", userID, err)
+		return
+	}
+	// Lightweight transaction, as in UpdateMe, so a deleted user is not recreated
+	applied, err := session.Query(`UPDATE users SET avatar_key = ? WHERE user_id = ? IF EXISTS`,
+		key, userID).MapScanCAS(map[string]interface{}{})
+	if err != nil || !applied {
+		blobstore.Avatars.Delete(r.Context(), key)
+	}
+	if err != nil {
+		http.Error(w, "Failed to update avatar", http.StatusInternalServerError)
+		logging.Errorf(r.Context(), "Error saving avatar of user %s: %v", userID, err)
+		return
+	}
+	if !applied {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if oldKey != "" {
+		if err := blobstore.Avatars.Delete(r.Context(), oldKey); err != nil {
+			logging.Printf(r.Context(), "Error deleting old avatar %s: %v", oldKey, err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message":    "Avatar updated successfully",
+		"avatar_url": avatarURL(key),
+	})
+}
+
+// DeleteAvatar removes the caller's avatar
+func DeleteAvatar(w http.ResponseWriter, r *http.Request) {
+	session := RetrieveSession(r)
+	if session == nil {
+		http.Error(w, "Cassandra session not available", http.StatusInternalServerError)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		logging.Printf(r.Context(), "User ID not found in context")
+		return
+	}
+
+	_, key, err := loadProfile(session, userID)
+	if err == errUserNotFound {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to delete avatar", http.StatusInternalServerError)
+		logging.Errorf(r.Context(), "Error loading profile of user %s: %v", userID, err)
+		return
+	}
+	if key != "" {
+		if err := session.Query(`DELETE avatar_key FROM users WHERE user_id = ?`, userID).Exec(); err != nil {
+			http.Error(w, "Failed to delete avatar", http.StatusInternalServerError)
+			logging.Errorf(r.Context(), "Error clearing avatar of user %s: %v", userID, err)
+			return
+		}
+		if err := blobstore.Avatars.Delete(r.Context(), key); err != nil {
+			logging.Printf(r.Context(), "Error deleting avatar %s: %v", key, err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Avatar deleted successfully",
+	})
+}
+
+// GetAvatar serves an avatar image. Avatars are public, like display names.
+func GetAvatar(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	key := vars["user_id"] + "/" + vars["file"]
+
+	blob, err := blobstore.Avatars.Open(r.Context(), key)
+	if errors.Is(err, blobstore.ErrNotFound) || errors.Is(err, blobstore.ErrInvalidKey) {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to load avatar", http.StatusInternalServerError)
+		logging.Errorf(r.Context(), "Error opening avatar %s: %v", key, err)
+		return
+	}
+	defer blob.Close()
+
+	w.Header().Set("Content-Type", mime.TypeByExtension(path.Ext(key)))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	io.Copy(w, blob)
+}
+
+// LookupUsers resolves a batch of user IDs to public profiles, for showing
+// collaborators by name. Unknown IDs are left out of the response.
+func LookupUsers(w http.ResponseWriter, r *http.Request) {
+	session := RetrieveSession(r)
+	if session == nil {
+		http.Error(w, "Cassandra session not available", http.StatusInternalServerError)
+		return
+	}
+
+	var request struct {
+		UserIDs []string `json:"user_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		logging.Printf(r.Context(), "Error decoding request payload: %v", err)
+		return
+	}
+	if len(request.UserIDs) == 0 || len(request.UserIDs) > maxLookupUserIDs {
+		http.Error(w, "user_ids must contain between 1 and 100 IDs", http.StatusBadRequest)
+		return
+	}
+
+	users, err := publicProfiles(session, request.UserIDs)
+	if err != nil {
+		http.Error(w, "Failed to look up users", http.StatusInternalServerError)
+		logging.Errorf(r.Context(), "Error looking up users: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"users": users,
+	})
+}
+
+// publicProfiles reads the public fields of the given users, leaving out
+// those that do not exist
+func publicProfiles(session *gocql.Session, userIDs []string) ([]models.PublicProfile, error) {
+	users := []models.PublicProfile{}
+	if len(userIDs) == 0 {
+		return users, nil
+	}
+	iter := session.Query(`SELECT user_id, display_name, avatar_key FROM users WHERE user_id IN ?`,
+		userIDs).Iter()
+	var userID, displayName, avatarKey string
+	for iter.Scan(&userID, &displayName, &avatarKey) {
+		users = append(users, models.PublicProfile{
+			UserID:      userID,
+			DisplayName: displayName,
+			AvatarURL:   avatarURL(avatarKey),
+		})
+	}
+	return users, iter.Close()
+}
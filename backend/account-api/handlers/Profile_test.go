@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"shared/models"
+)
+
+func TestProfileUpdateChanges(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		columns string
+		values  []interface{}
+		wantErr string
+	}{
+		{"display name trimmed", `{"display_name": "  Ada  "}`, "display_name = ?", []interface{}{"Ada"}, ""},
+		{"display name of 50 characters", `{"display_name": "` + strings.Repeat("é", 50) + `"}`, "display_name = ?", []interface{}{strings.Repeat("é", 50)}, ""},
+		{"display name too long", `{"display_name": "` + strings.Repeat("a", 51) + `"}`, "", nil, "Display name"},
+		{"display name blank", `{"display_name": "   "}`, "", nil, "Display name"},
+		{"timezone", `{"timezone": "Europe/London"}`, "timezone = ?", []interface{}{"Europe/London"}, ""},
+		{"unknown timezone", `{"timezone": "Mars/Olympus"}`, "", nil, "Timezone"},
+		{"empty timezone", `{"timezone": ""}`, "", nil, "Timezone"},
+		{"discoverable", `{"discoverable": false}`, "discoverable = ?", []interface{}{false}, ""},
+		{"brush", `{"preferences": {"default_brush": "marker"}}`, "default_brush = ?", []interface{}{"marker"}, ""},
+		{"unknown brush", `{"preferences": {"default_brush": "crayon"}}`, "", nil, "Default brush"},
+		{"color lowercased", `{"preferences": {"default_color": "#1A2B3C"}}`, "default_color = ?", []interface{}{"#1a2b3c"}, ""},
+		{"short color", `{"preferences": {"default_color": "#fff"}}`, "", nil, "Default color"},
+		{"theme", `{"preferences": {"theme": "dark"}}`, "theme = ?", []interface{}{"dark"}, ""},
+		{"unknown theme", `{"preferences": {"theme": "sepia"}}`, "", nil, "Theme"},
+		{"several fields", `{"display_name": "Ada", "discoverable": true, "preferences": {"theme": "light"}}`,
+			"display_name = ?, discoverable = ?, theme = ?", []interface{}{"Ada", true, "light"}, ""},
+		{"one bad field rejects all", `{"display_name": "Ada", "preferences": {"theme": "sepia"}}`, "", nil, "Theme"},
+		{"nothing to change", `{}`, "", nil, "No fields to update"},
+		{"empty preferences", `{"preferences": {}}`, "", nil, "No fields to update"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var update profileUpdate
+			if err := json.Unmarshal([]byte(tt.body), &update); err != nil {
+				t.Fatalf("decoding %s: %v", tt.body, err)
+			}
+			columns, values, err := update.changes()
+			if tt.wantErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want one starting %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("changes: %v", err)
+			}
+			if got := strings.Join(columns, ", "); got != tt.columns {
+				t.Errorf("columns = %q, want %q", got, tt.columns)
+			}
+			if len(values) != len(tt.values) {
+				t.Fatalf("values = %v, want %v", values, tt.values)
+			}
+			for i := range values {
+				if values[i] != tt.values[i] {
+					t.Errorf("value %d = %v, want %v", i, values[i], tt.values[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDisplayNameIndexChange(t *testing.T) {
+	profile := func(name string, discoverable bool) *models.Profile {
+		return &models.Profile{UserID: "user-1", DisplayName: name, Discoverable: discoverable}
+	}
+	tests := []struct {
+		name           string
+		before, after  *models.Profile
+		oldKey, newKey string
+	}{
+		{"rename", profile("Ada", true), profile("Grace", true), "ada", "grace"},
+		{"first name", profile("", true), profile("Ada", true), "", "ada"},
+		{"becomes discoverable", profile("Ada", false), profile("Ada", true), "", "ada"},
+		{"stops being discoverable", profile("Ada", true), profile("Ada", false), "ada", ""},
+		{"case only", profile("Ada", true), profile("ADA", true), "", ""},
+		{"unchanged", profile("Ada", true), profile("Ada", true), "", ""},
+		{"rename while hidden", profile("Ada", false), profile("Grace", false), "", ""},
+		{"hidden and renamed", profile("Ada", true), profile("Grace", false), "ada", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oldKey, newKey := displayNameIndexChange(tt.before, tt.after)
+			if oldKey != tt.oldKey || newKey != tt.newKey {
+				t.Fatalf("change = (%q, %q), want (%q, %q)", oldKey, newKey, tt.oldKey, tt.newKey)
+			}
+		})
+	}
+}
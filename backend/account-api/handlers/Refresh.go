@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"account-api/config"
+	"shared/logging"
+	"shared/models"
+	"shared/session"
+)
+
+// Refresh exchanges a refresh token for a new access token. The refresh token
+// is rotated on every use; the old one stops working and presenting it again
+// revokes the session.
+func Refresh(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		logging.Printf(r.Context(), "Error decoding request payload: %v", err)
+		return
+	}
+	if request.RefreshToken == "" {
+		http.Error(w, "Missing required field: refresh_token", http.StatusBadRequest)
+		return
+	}
+
+	sess, refreshToken, err := config.Sessions.RotateRefreshToken(r.Context(), request.RefreshToken)
+	if err == session.ErrRefreshTokenInvalid || err == session.ErrRefreshTokenReused {
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to refresh token", http.StatusInternalServerError)
+		logging.Errorf(r.Context(), "Error rotating refresh token: %v", err)
+		return
+	}
+
+	jwtToken, expiresAt, err := issueAccessToken(sess)
+	if err != nil {
+		http.Error(w, "Failed to generate JWT", http.StatusInternalServerError)
+		logging.Errorf(r.Context(), "Error generating JWT for user %s: %v", sess.UserID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.TokenResponse{
+		Message:      "Token refreshed",
+		UserID:       sess.UserID,
+		JWTToken:     jwtToken,
+		ExpiresAt:    expiresAt.Unix(),
+		ExpiresIn:    int64(time.Until(expiresAt).Seconds()),
+		RefreshToken: refreshToken,
+		SessionID:    sess.SessionID,
+	})
+}
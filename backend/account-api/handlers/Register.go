@@ -1,17 +1,16 @@
 package handlers
 
 import (
-	"account-api/config"
-	"account-api/models"
+	"account-api/identity"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
+	"shared/logging"
+	"shared/models"
+	"strings"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider"
-	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider/types"
 	"github.com/gocql/gocql"
 )
 
@@ -19,7 +18,7 @@ import (
 func RetrieveSession(r *http.Request) *gocql.Session {
 	session, ok := r.Context().Value("session").(*gocql.Session)
 	if !ok {
-		log.Println("Failed to retrieve Cassandra session from context")
+		logging.Printf(r.Context(), "Failed to retrieve Cassandra session from context")
 		return nil
 	}
 	return session
@@ -34,12 +33,12 @@ func Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Println("Register endpoint invoked")
+	logging.Printf(r.Context(), "Register endpoint invoked")
 
 	var account models.Account
 	// Decode the incoming request body into the account struct
 	if err := json.NewDecoder(r.Body).Decode(&account); err != nil {
-		log.Printf("Failed to decode request: %v", err)
+		logging.Printf(r.Context(), "Failed to decode request: %v", err)
 		http.Error(w, "Invalid request payload", http.StatusBadRequest)
 		return
 	}
@@ -47,45 +46,31 @@ func Register(w http.ResponseWriter, r *http.Request) {
 	// Set the Username to be the email
 	account.Username = account.Email // Set Username to Email
 
-	// Generate SECRET_HASH for Cognito
-	secretHash := GenerateSecretHash(
-		config.AppClientID,
-		config.AppClientSecret,
-		account.Username, // Now using Email as Username
-	)
-
-	// Prepare the Cognito SignUp request
-	signUpInput := &cognitoidentityprovider.SignUpInput{
-		ClientId:   &config.AppClientID,
-		SecretHash: &secretHash,
-		Username:   &account.Username, // Using Email as the Username
-		Password:   &account.Password,
-		UserAttributes: []types.AttributeType{
-			{Name: aws.String("email"), Value: &account.Email},
-		},
-	}
-
-	// Perform the SignUp
-	output, err := config.CognitoClient.SignUp(context.TODO(), signUpInput)
-	if err != nil {
-		log.Printf("Cognito signup failed: %v", err)
+	// Register with the identity provider; its user ID is used everywhere else
+	userID, err := identity.Provider.SignUp(r.Context(), account.Email, account.Password)
+	if errors.Is(err, identity.ErrUserExists) {
+		http.Error(w, "User already exists", http.StatusConflict)
+		return
+	} else if errors.Is(err, identity.ErrInvalidPassword) {
+		http.Error(w, "Password does not meet the password requirements", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		logging.Errorf(r.Context(), "Identity provider signup failed: %v", err)
 		http.Error(w, fmt.Sprintf("Failed to register user: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("Cognito signup successful: %v", output)
-
-	// Use the Cognito `sub` as the user_id
-	userID := *output.UserSub // Directly use the `sub` as UUID
-
-	log.Printf("Using Cognito sub as user ID: %s", userID)
+	logging.Printf(r.Context(), "Registered user with ID: %s", userID)
 
-	// Insert user details into Cassandra
-	err = session.Query(
-		`INSERT INTO users (user_id, username, email) VALUES (?, ?, ?)`,
-		userID, account.Username, account.Email).Exec()
+	// Insert user details into Cassandra, along with the email lookup row
+	batch := session.NewBatch(gocql.LoggedBatch)
+	batch.Query(`INSERT INTO users (user_id, username, email) VALUES (?, ?, ?)`,
+		userID, account.Username, account.Email)
+	batch.Query(`INSERT INTO users_by_email (email, user_id) VALUES (?, ?)`,
+		normalizeEmail(account.Email), userID)
+	err = session.ExecuteBatch(batch)
 	if err != nil {
-		log.Printf("Failed to insert user: %v", err)
+		logging.Errorf(r.Context(), "Failed to insert user: %v", err)
 		http.Error(w, "Failed to store user", http.StatusInternalServerError)
 		return
 	}
@@ -96,3 +81,38 @@ func Register(w http.ResponseWriter, r *http.Request) {
 		"message": "User registered successfully",
 	})
 }
+
+// normalizeEmail is the form emails are stored in users_by_email
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// lookupUserIDByEmail finds the user ID registered with an email address
+func lookupUserIDByEmail(session *gocql.Session, email string) (string, error) {
+	var userID string
+	err := session.Query(`SELECT user_id FROM users_by_email WHERE email = ?`,
+		normalizeEmail(email)).Scan(&userID)
+	return userID, err
+}
+
+// resolveUserID finds the user ID of an account by email. Accounts registered
+// before users_by_email existed may have no row there, so a miss falls back
+// to the identity provider and records the answer for next time.
+func resolveUserID(ctx context.Context, session *gocql.Session, email string) (string, error) {
+	userID, err := lookupUserIDByEmail(session, email)
+	if err != gocql.ErrNotFound {
+		return userID, err
+	}
+
+	userID, err = identity.Provider.UserID(ctx, email)
+	if err != nil {
+		return "", err
+	}
+	err = session.Query(`INSERT INTO users_by_email (email, user_id) VALUES (?, ?)`,
+		normalizeEmail(email), userID).WithContext(ctx).Exec()
+	if err != nil {
+		// The lookup worked, only the shortcut for next time is missing
+		logging.Printf(ctx, "Failed to record email lookup for user %s: %v", userID, err)
+	}
+	return userID, nil
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"account-api/caching"
+	"account-api/config"
+	"shared/auth"
+	"shared/logging"
+
+	"github.com/gorilla/mux"
+)
+
+// SessionResponse describes an active session, flagging the one making the request
+type SessionResponse struct {
+	caching.Session
+	Current bool `json:"current"`
+}
+
+// ListSessions returns the user's active sessions across all devices
+func ListSessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		logging.Printf(r.Context(), "User ID not found in context")
+		return
+	}
+	currentID, _ := auth.SessionIDFromContext(r.Context())
+
+	sessions, err := config.Sessions.List(r.Context(), userID)
+	if err != nil {
+		http.Error(w, "Failed to list sessions", http.StatusInternalServerError)
+		logging.Errorf(r.Context(), "Error listing sessions for user %s: %v", userID, err)
+		return
+	}
+
+	response := make([]SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, SessionResponse{
+			Session: session,
+			Current: session.SessionID == currentID,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// RevokeSession logs out one of the user's sessions, e.g. a lost device
+func RevokeSession(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		logging.Printf(r.Context(), "User ID not found in context")
+		return
+	}
+	sessionID := mux.Vars(r)["session_id"]
+
+	err := config.Sessions.Revoke(r.Context(), userID, sessionID)
+	if err == caching.ErrSessionNotFound {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to revoke session", http.StatusInternalServerError)
+		logging.Errorf(r.Context(), "Error revoking session %s for user %s: %v", sessionID, userID, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
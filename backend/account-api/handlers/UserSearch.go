@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"account-api/caching"
+	"encoding/json"
+	"net/http"
+	"shared/auth"
+	"shared/logging"
+	"shared/models"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gocql/gocql"
+)
+
+const (
+	// namePrefixLength is how many characters of a display name partition
+	// users_by_display_name, and so the shortest name search accepted
+	namePrefixLength = 2
+	// maxSearchResults caps the users returned by a single search
+	maxSearchResults = 20
+)
+
+// displayNameKey is the form display names are matched in
+func displayNameKey(displayName string) string {
+	return strings.ToLower(strings.TrimSpace(displayName))
+}
+
+// displayNamePrefix is the users_by_display_name partition a key falls in
+func displayNamePrefix(key string) string {
+	end := 0
+	for i := 0; i < namePrefixLength && end < len(key); i++ {
+		_, size := utf8.DecodeRuneInString(key[end:])
+		end += size
+	}
+	return key[:end]
+}
+
+// displayNameIndexChange returns the users_by_display_name key to remove and
+// the one to add when a profile changes from before to after, "" for none.
+// Only discoverable users with a display name are indexed.
+func displayNameIndexChange(before, after *models.Profile) (oldKey, newKey string) {
+	if before.Discoverable {
+		oldKey = displayNameKey(before.DisplayName)
+	}
+	if after.Discoverable {
+		newKey = displayNameKey(after.DisplayName)
+	}
+	if oldKey == newKey {
+		return "", ""
+	}
+	return oldKey, newKey
+}
+
+// updateDisplayNameIndex moves the user's entry in users_by_display_name from
+// their old profile to their new one
+func updateDisplayNameIndex(session *gocql.Session, before, after *models.Profile) error {
+	oldKey, newKey := displayNameIndexChange(before, after)
+	if oldKey == "" && newKey == "" {
+		return nil
+	}
+
+	batch := session.NewBatch(gocql.LoggedBatch)
+	if oldKey != "" {
+		batch.Query(`DELETE FROM users_by_display_name WHERE name_prefix = ? AND name_key = ? AND user_id = ?`,
+			displayNamePrefix(oldKey), oldKey, after.UserID)
+	}
+	if newKey != "" {
+		batch.Query(`INSERT INTO users_by_display_name (name_prefix, name_key, user_id) VALUES (?, ?, ?)`,
+			displayNamePrefix(newKey), newKey, after.UserID)
+	}
+	return session.ExecuteBatch(batch)
+}
+
+// searchByEmail returns the user with the email, if any. Users who are not
+// discoverable are returned by ID only, enough to share a canvas with them.
+func searchByEmail(session *gocql.Session, email string) ([]models.PublicProfile, error) {
+	users := []models.PublicProfile{}
+	matchID, err := lookupUserIDByEmail(session, email)
+	if err == gocql.ErrNotFound {
+		return users, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var displayName, avatarKey string
+	var discoverable bool
+	err = session.Query(`SELECT display_name, avatar_key, discoverable FROM users WHERE user_id = ?`,
+		matchID).Scan(&displayName, &avatarKey, &discoverable)
+	if err == gocql.ErrNotFound {
+		return users, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	user := models.PublicProfile{UserID: matchID}
+	if discoverable {
+		user.DisplayName = displayName
+		user.AvatarURL = avatarURL(avatarKey)
+	}
+	return append(users, user), nil
+}
+
+// SearchUsers finds users to share a canvas with, either by exact email
+// (?email=) or by display name prefix (?q=). Name search only finds users who
+// have made themselves discoverable. An email match finds anyone, since the
+// caller already has to know the address, but only the user ID is returned
+// for users who are not discoverable. Searches are rate limited so the
+// directory cannot be walked.
+func SearchUsers(w http.ResponseWriter, r *http.Request) {
+	session := RetrieveSession(r)
+	if session == nil {
+		http.Error(w, "Cassandra session not available", http.StatusInternalServerError)
+		return
+	}
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		logging.Printf(r.Context(), "User ID not found in context")
+		return
+	}
+
+	email := normalizeEmail(r.URL.Query().Get("email"))
+	query := displayNameKey(r.URL.Query().Get("q"))
+	if (email == "") == (query == "") {
+		http.Error(w, "Provide either email or q", http.StatusBadRequest)
+		return
+	}
+	if query != "" && utf8.RuneCountInString(query) < namePrefixLength {
+		http.Error(w, "q must be at least 2 characters", http.StatusBadRequest)
+		return
+	}
+
+	retryAfter, err := caching.AllowUserSearch(userID, clientIP(r))
+	if err != nil {
+		http.Error(w, "Failed to search users", http.StatusInternalServerError)
+		return
+	}
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", formatSeconds(retryAfter))
+		http.Error(w, "Too many searches, please try again later", http.StatusTooManyRequests)
+		logging.Printf(r.Context(), "User search rate limited for user %s", userID)
+		return
+	}
+
+	if email != "" {
+		users, err := searchByEmail(session, email)
+		if err != nil {
+			http.Error(w, "Failed to search users", http.StatusInternalServerError)
+			logging.Errorf(r.Context(), "Error searching users by email: %v", err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"users": users,
+		})
+		return
+	}
+
+	var userIDs []string
+	// Every name starting with query sorts between query and query followed
+	// by the highest code point
+	iter := session.Query(`SELECT user_id FROM users_by_display_name
+		WHERE name_prefix = ? AND name_key >= ? AND name_key < ? LIMIT ?`,
+		displayNamePrefix(query), query, query+"\U0010FFFF", maxSearchResults).Iter()
+	var matchID string
+	for iter.Scan(&matchID) {
+		userIDs = append(userIDs, matchID)
+	}
+	if err := iter.Close(); err != nil {
+		http.Error(w, "Failed to search users", http.StatusInternalServerError)
+		logging.Errorf(r.Context(), "Error searching users by display name: %v", err)
+		return
+	}
+
+	users, err := publicProfiles(session, userIDs)
+	if err != nil {
+		http.Error(w, "Failed to search users", http.StatusInternalServerError)
+		logging.Errorf(r.Context(), "Error loading search results: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"users": users,
+	})
+}
@@ -1,30 +1,77 @@
 package handlers
 
 import (
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/base64"
-	"log"
+	"account-api/config"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
-// GenerateSecretHash generates the Cognito SECRET_HASH for authentication
-func GenerateSecretHash(clientID, clientSecret, username string) string {
-	log.Printf("Generating SECRET_HASH for username: %s", username)
+// clientIP returns the address the request came from. X-Forwarded-For is
+// read right to left, starting from the connection's address, and only for as
+// long as the hops are trusted proxies: the first untrusted address is the
+// client. Entries further left are whatever the client sent and are ignored,
+// so they cannot be used to dodge per-IP limits.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
 
-	h := hmac.New(sha256.New, []byte(clientSecret))
-	h.Write([]byte(username + clientID))
-	secretHash := base64.StdEncoding.EncodeToString(h.Sum(nil))
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(host)
+		if ip == nil || !config.IsTrustedProxy(ip) {
+			break
+		}
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			break
+		}
+		host = hop
+	}
+	return host
+}
+
+// describeDevice builds a short label such as "Chrome on macOS" from a User-Agent
+func describeDevice(userAgent string) string {
+	browser := "Unknown browser"
+	switch {
+	case strings.Contains(userAgent, "Edg/"):
+		browser = "Edge"
+	case strings.Contains(userAgent, "Firefox/"):
+		browser = "Firefox"
+	case strings.Contains(userAgent, "Chrome/"):
+		browser = "Chrome"
+	case strings.Contains(userAgent, "Safari/"):
+		browser = "Safari"
+	}
+
+	platform := "unknown device"
+	switch {
+	case strings.Contains(userAgent, "iPhone"), strings.Contains(userAgent, "iPad"):
+		platform = "iOS"
+	case strings.Contains(userAgent, "Android"):
+		platform = "Android"
+	case strings.Contains(userAgent, "Windows"):
+		platform = "Windows"
+	case strings.Contains(userAgent, "Mac OS X"):
+		platform = "macOS"
+	case strings.Contains(userAgent, "Linux"):
+		platform = "Linux"
+	}
 
-	log.Printf("Generated SECRET_HASH successfully")
-	return secretHash
+	return browser + " on " + platform
 }
 
-// LoggingMiddleware logs all HTTP requests
-func LoggingMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("Request: %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
-		next.ServeHTTP(w, r)
-		log.Printf("Request completed: %s %s", r.Method, r.URL.Path)
-	})
+// formatSeconds renders a wait as whole seconds for a Retry-After header
+func formatSeconds(d time.Duration) string {
+	seconds := int(math.Ceil(d.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	return strconv.Itoa(seconds)
 }
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"net"
+	"net/http/httptest"
+	"testing"
+
+	"account-api/config"
+)
+
+func TestClientIP(t *testing.T) {
+	_, cluster, _ := net.ParseCIDR("10.0.0.0/8")
+	config.TrustedProxies = []*net.IPNet{cluster}
+	t.Cleanup(func() { config.TrustedProxies = nil })
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		want       string
+	}{
+		{"direct connection", "203.0.113.5:4000", "", "203.0.113.5"},
+		{"untrusted peer cannot forward", "203.0.113.5:4000", "198.51.100.1", "203.0.113.5"},
+		{"through one proxy", "10.0.0.2:4000", "203.0.113.5", "203.0.113.5"},
+		{"through two proxies", "10.0.0.2:4000", "203.0.113.5, 10.0.0.9", "203.0.113.5"},
+		{"spoofed first entry is ignored", "10.0.0.2:4000", "1.2.3.4, 203.0.113.5, 10.0.0.9", "203.0.113.5"},
+		{"spoofed trusted entry is ignored", "10.0.0.2:4000", "10.9.9.9, 203.0.113.5", "203.0.113.5"},
+		{"trusted peer without header", "10.0.0.2:4000", "", "10.0.0.2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/login", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if got := clientIP(r); got != tt.want {
+				t.Errorf("clientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,332 @@
+package identity
+
+import (
+	"account-api/config"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	sharedconfig "shared/config"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider"
+	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider/types"
+)
+
+// CognitoProvider is the IdentityProvider backed by the Cognito user pool
+// configured by config.InitAWS
+type CognitoProvider struct{}
+
+// NewCognitoProvider returns the Cognito provider. config.InitAWS must have run.
+func NewCognitoProvider() *CognitoProvider {
+	return &CognitoProvider{}
+}
+
+func secretHash(username string) *string {
+	hash := sharedconfig.CognitoSecretHash(config.AppClientID, config.AppClientSecret, username)
+	return &hash
+}
+
+// mapCognitoError wraps Cognito exceptions in the provider-independent errors
+func mapCognitoError(err error) error {
+	var (
+		userNotFound     *types.UserNotFoundException
+		usernameExists   *types.UsernameExistsException
+		notAuthorized    *types.NotAuthorizedException
+		userNotConfirmed *types.UserNotConfirmedException
+		codeMismatch     *types.CodeMismatchException
+		expiredCode      *types.ExpiredCodeException
+		invalidPassword  *types.InvalidPasswordException
+		limitExceeded    *types.LimitExceededException
+		tooManyRequests  *types.TooManyRequestsException
+		aliasExists      *types.AliasExistsException
+		invalidTotp      *types.EnableSoftwareTokenMFAException
+	)
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &userNotFound):
+		return fmt.Errorf("%w: %v", ErrUserNotFound, err)
+	case errors.As(err, &usernameExists):
+		return fmt.Errorf("%w: %v", ErrUserExists, err)
+	case errors.As(err, &notAuthorized):
+		return fmt.Errorf("%w: %v", ErrNotAuthorized, err)
+	case errors.As(err, &userNotConfirmed):
+		return fmt.Errorf("%w: %v", ErrUserNotConfirmed, err)
+	case errors.As(err, &codeMismatch), errors.As(err, &expiredCode), errors.As(err, &invalidTotp):
+		return fmt.Errorf("%w: %v", ErrCodeMismatch, err)
+	case errors.As(err, &invalidPassword):
+		return fmt.Errorf("%w: %v", ErrInvalidPassword, err)
+	case errors.As(err, &limitExceeded), errors.As(err, &tooManyRequests):
+		return fmt.Errorf("%w: %v", ErrLimitExceeded, err)
+	case errors.As(err, &aliasExists):
+		return fmt.Errorf("%w: %v", ErrAliasExists, err)
+	default:
+		return err
+	}
+}
+
+// SignUp registers the user and returns their Cognito sub as the user ID
+func (p *CognitoProvider) SignUp(ctx context.Context, email, password string) (string, error) {
+	output, err := config.CognitoClient.SignUp(ctx, &cognitoidentityprovider.SignUpInput{
+		ClientId:   &config.AppClientID,
+		SecretHash: secretHash(email),
+		Username:   &email,
+		Password:   &password,
+		UserAttributes: []types.AttributeType{
+			{Name: aws.String("email"), Value: &email},
+		},
+	})
+	if err != nil {
+		return "", mapCognitoError(err)
+	}
+	return aws.ToString(output.UserSub), nil
+}
+
+// ConfirmSignUp confirms the account with the code Cognito emailed
+func (p *CognitoProvider) ConfirmSignUp(ctx context.Context, username, code string) error {
+	_, err := config.CognitoClient.ConfirmSignUp(ctx, &cognitoidentityprovider.ConfirmSignUpInput{
+		ClientId:         &config.AppClientID,
+		SecretHash:       secretHash(username),
+		Username:         &username,
+		ConfirmationCode: &code,
+	})
+	return mapCognitoError(err)
+}
+
+// ResendConfirmationCode emails a new confirmation code
+func (p *CognitoProvider) ResendConfirmationCode(ctx context.Context, username string) error {
+	_, err := config.CognitoClient.ResendConfirmationCode(ctx, &cognitoidentityprovider.ResendConfirmationCodeInput{
+		ClientId:   &config.AppClientID,
+		SecretHash: secretHash(username),
+		Username:   &username,
+	})
+	return mapCognitoError(err)
+}
+
+// IsConfirmed reports whether the account has been confirmed
+func (p *CognitoProvider) IsConfirmed(ctx context.Context, username string) (bool, error) {
+	output, err := config.CognitoClient.AdminGetUser(ctx, &cognitoidentityprovider.AdminGetUserInput{
+		UserPoolId: &config.UserPoolID,
+		Username:   &username,
+	})
+	if err != nil {
+		return false, mapCognitoError(err)
+	}
+	return output.UserStatus != types.UserStatusTypeUnconfirmed, nil
+}
+
+// UserID returns the account's Cognito sub
+func (p *CognitoProvider) UserID(ctx context.Context, username string) (string, error) {
+	output, err := config.CognitoClient.AdminGetUser(ctx, &cognitoidentityprovider.AdminGetUserInput{
+		UserPoolId: &config.UserPoolID,
+		Username:   &username,
+	})
+	if err != nil {
+		return "", mapCognitoError(err)
+	}
+	for _, attribute := range output.UserAttributes {
+		if aws.ToString(attribute.Name) == "sub" {
+			return aws.ToString(attribute.Value), nil
+		}
+	}
+	return "", fmt.Errorf("user %s has no sub attribute", username)
+}
+
+// Authenticate authenticates a user using Cognito's USER_PASSWORD_AUTH flow
+func (p *CognitoProvider) Authenticate(ctx context.Context, username, password string) (*AuthResult, error) {
+	authOutput, err := config.CognitoClient.InitiateAuth(ctx, &cognitoidentityprovider.InitiateAuthInput{
+		AuthFlow: types.AuthFlowTypeUserPasswordAuth,
+		ClientId: &config.AppClientID,
+		AuthParameters: map[string]string{
+			"USERNAME":    username,
+			"PASSWORD":    password,
+			"SECRET_HASH": *secretHash(username),
+		},
+	})
+	if err != nil {
+		log.Printf("Cognito authentication failed: %v", err)
+		return nil, mapCognitoError(err)
+	}
+
+	if authOutput.AuthenticationResult == nil {
+		if authOutput.ChallengeName != types.ChallengeNameTypeSoftwareTokenMfa {
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedChallenge, authOutput.ChallengeName)
+		}
+		// With email sign-in, challenge responses need the internal username
+		challengeUser := authOutput.ChallengeParameters["USER_ID_FOR_SRP"]
+		if challengeUser == "" {
+			challengeUser = username
+		}
+		return &AuthResult{Challenge: &Challenge{
+			Name:     ChallengeSoftwareTokenMFA,
+			Username: challengeUser,
+			Session:  aws.ToString(authOutput.Session),
+		}}, nil
+	}
+
+	return authResultFromCognito(ctx, authOutput.AuthenticationResult)
+}
+
+// RespondToMFAChallenge completes a SOFTWARE_TOKEN_MFA challenge with the user's TOTP code
+func (p *CognitoProvider) RespondToMFAChallenge(ctx context.Context, challenge *Challenge, code string) (*AuthResult, error) {
+	challengeOutput, err := config.CognitoClient.RespondToAuthChallenge(ctx, &cognitoidentityprovider.RespondToAuthChallengeInput{
+		ChallengeName: types.ChallengeNameTypeSoftwareTokenMfa,
+		ClientId:      &config.AppClientID,
+		Session:       &challenge.Session,
+		ChallengeResponses: map[string]string{
+			"USERNAME":                challenge.Username,
+			"SOFTWARE_TOKEN_MFA_CODE": code,
+			"SECRET_HASH":             *secretHash(challenge.Username),
+		},
+	})
+	if err != nil {
+		log.Printf("Cognito MFA challenge failed: %v", err)
+		return nil, mapCognitoError(err)
+	}
+	if challengeOutput.AuthenticationResult == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedChallenge, challengeOutput.ChallengeName)
+	}
+	return authResultFromCognito(ctx, challengeOutput.AuthenticationResult)
+}
+
+// authResultFromCognito validates the ID token to get the user ID
+func authResultFromCognito(ctx context.Context, result *types.AuthenticationResultType) (*AuthResult, error) {
+	userID, err := ExtractSubFromIDToken(ctx, aws.ToString(result.IdToken))
+	if err != nil {
+		return nil, err
+	}
+	return &AuthResult{
+		UserID:      userID,
+		AccessToken: aws.ToString(result.AccessToken),
+		ExpiresIn:   time.Duration(result.ExpiresIn) * time.Second,
+	}, nil
+}
+
+// ForgotPassword emails a password reset code
+func (p *CognitoProvider) ForgotPassword(ctx context.Context, username string) error {
+	_, err := config.CognitoClient.ForgotPassword(ctx, &cognitoidentityprovider.ForgotPasswordInput{
+		ClientId:   &config.AppClientID,
+		SecretHash: secretHash(username),
+		Username:   &username,
+	})
+	return mapCognitoError(err)
+}
+
+// ConfirmForgotPassword sets a new password using the emailed reset code
+func (p *CognitoProvider) ConfirmForgotPassword(ctx context.Context, username, code, newPassword string) error {
+	_, err := config.CognitoClient.ConfirmForgotPassword(ctx, &cognitoidentityprovider.ConfirmForgotPasswordInput{
+		ClientId:         &config.AppClientID,
+		SecretHash:       secretHash(username),
+		Username:         &username,
+		ConfirmationCode: &code,
+		Password:         &newPassword,
+	})
+	return mapCognitoError(err)
+}
+
+// ChangePassword changes the password of the user the access token belongs to
+func (p *CognitoProvider) ChangePassword(ctx context.Context, accessToken, oldPassword, newPassword string) error {
+	_, err := config.CognitoClient.ChangePassword(ctx, &cognitoidentityprovider.ChangePasswordInput{
+		AccessToken:      &accessToken,
+		PreviousPassword: &oldPassword,
+		ProposedPassword: &newPassword,
+	})
+	return mapCognitoError(err)
+}
+
+// UpdateEmail starts an email change; Cognito emails a code to the new address
+func (p *CognitoProvider) UpdateEmail(ctx context.Context, accessToken, newEmail string) error {
+	_, err := config.CognitoClient.UpdateUserAttributes(ctx, &cognitoidentityprovider.UpdateUserAttributesInput{
+		AccessToken: &accessToken,
+		UserAttributes: []types.AttributeType{
+			{Name: aws.String("email"), Value: &newEmail},
+		},
+	})
+	return mapCognitoError(err)
+}
+
+// VerifyEmail completes an email change with the code sent to the new address
+func (p *CognitoProvider) VerifyEmail(ctx context.Context, accessToken, code string) error {
+	_, err := config.CognitoClient.VerifyUserAttribute(ctx, &cognitoidentityprovider.VerifyUserAttributeInput{
+		AccessToken:   &accessToken,
+		AttributeName: aws.String("email"),
+		Code:          &code,
+	})
+	return mapCognitoError(err)
+}
+
+// AssociateSoftwareToken starts TOTP enrollment and returns the shared secret
+func (p *CognitoProvider) AssociateSoftwareToken(ctx context.Context, accessToken string) (string, error) {
+	output, err := config.CognitoClient.AssociateSoftwareToken(ctx, &cognitoidentityprovider.AssociateSoftwareTokenInput{
+		AccessToken: &accessToken,
+	})
+	if err != nil {
+		return "", mapCognitoError(err)
+	}
+	return aws.ToString(output.SecretCode), nil
+}
+
+// VerifySoftwareToken finishes TOTP enrollment with a code from the authenticator app
+func (p *CognitoProvider) VerifySoftwareToken(ctx context.Context, accessToken, code, deviceName string) error {
+	input := &cognitoidentityprovider.VerifySoftwareTokenInput{
+		AccessToken: &accessToken,
+		UserCode:    &code,
+	}
+	if deviceName != "" {
+		input.FriendlyDeviceName = &deviceName
+	}
+	output, err := config.CognitoClient.VerifySoftwareToken(ctx, input)
+	if err != nil {
+		return mapCognitoError(err)
+	}
+	if output.Status != types.VerifySoftwareTokenResponseTypeSuccess {
+		return ErrCodeMismatch
+	}
+	return nil
+}
+
+// SetSoftwareTokenMFA turns TOTP MFA on or off for the user the access token belongs to
+func (p *CognitoProvider) SetSoftwareTokenMFA(ctx context.Context, accessToken string, enabled bool) error {
+	_, err := config.CognitoClient.SetUserMFAPreference(ctx, &cognitoidentityprovider.SetUserMFAPreferenceInput{
+		AccessToken: &accessToken,
+		SoftwareTokenMfaSettings: &types.SoftwareTokenMfaSettingsType{
+			Enabled:      enabled,
+			PreferredMfa: enabled,
+		},
+	})
+	return mapCognitoError(err)
+}
+
+// AdminDisableSoftwareTokenMFA turns off TOTP MFA without the user's tokens,
+// used when they sign in with a recovery code
+func (p *CognitoProvider) AdminDisableSoftwareTokenMFA(ctx context.Context, username string) error {
+	_, err := config.CognitoClient.AdminSetUserMFAPreference(ctx, &cognitoidentityprovider.AdminSetUserMFAPreferenceInput{
+		UserPoolId: &config.UserPoolID,
+		Username:   &username,
+		SoftwareTokenMfaSettings: &types.SoftwareTokenMfaSettingsType{
+			Enabled:      false,
+			PreferredMfa: false,
+		},
+	})
+	return mapCognitoError(err)
+}
+
+// MFAEnabled reports whether the user has TOTP MFA turned on
+func (p *CognitoProvider) MFAEnabled(ctx context.Context, username string) (bool, error) {
+	output, err := config.CognitoClient.AdminGetUser(ctx, &cognitoidentityprovider.AdminGetUserInput{
+		UserPoolId: &config.UserPoolID,
+		Username:   &username,
+	})
+	if err != nil {
+		return false, mapCognitoError(err)
+	}
+	for _, setting := range output.UserMFASettingList {
+		if setting == string(types.ChallengeNameTypeSoftwareTokenMfa) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,51 @@
+package identity
+
+import (
+	"account-api/config"
+	"context"
+	"errors"
+	"fmt"
+	"shared/jwks"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var (
+	cognitoKeys     *jwks.Cache
+	cognitoKeysOnce sync.Once
+)
+
+// cognitoKeySet returns the cache for the user pool's JWKS. It is created on
+// first use because the pool settings are only loaded by config.InitAWS.
+func cognitoKeySet() *jwks.Cache {
+	cognitoKeysOnce.Do(func() {
+		jwksURL := fmt.Sprintf("https://cognito-idp.%s.amazonaws.com/%s/.well-known/jwks.json", config.AwsRegion, config.UserPoolID)
+		cognitoKeys = jwks.New(jwksURL, jwks.Options{})
+	})
+	return cognitoKeys
+}
+
+// ExtractSubFromIDToken validates the ID token and extracts the user ID (sub)
+func ExtractSubFromIDToken(ctx context.Context, idToken string) (string, error) {
+	// Parse and validate the token using the pool's public key for its kid
+	parsedToken, err := jwt.Parse(idToken, cognitoKeySet().Keyfunc(ctx))
+	if err != nil {
+		return "", fmt.Errorf("failed to validate token: %v", err)
+	}
+
+	// Extract the claims from the parsed token
+	claims, ok := parsedToken.Claims.(jwt.MapClaims)
+	if !ok || !parsedToken.Valid {
+		return "", fmt.Errorf("invalid token claims or token not valid")
+	}
+
+	// Extract the user ID (sub) from the claims
+	userID, ok := claims["sub"].(string)
+	if !ok {
+		return "", errors.New("user ID (sub) not found in token")
+	}
+
+	// Return the user ID (sub)
+	return userID, nil
+}
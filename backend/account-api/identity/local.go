@@ -0,0 +1,494 @@
+package identity
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// localAccessTokenLifetime matches the lifetime of a Cognito access token
+	localAccessTokenLifetime = time.Hour
+	// localChallengeLifetime matches how long Cognito accepts a challenge session
+	localChallengeLifetime = 3 * time.Minute
+	// localConfirmationLifetime and localCodeLifetime bound the emailed codes
+	localConfirmationLifetime = 24 * time.Hour
+	localCodeLifetime         = time.Hour
+	// localMaxCodeAttempts is how many wrong guesses a code survives. After
+	// that it is discarded and a new one must be requested, so a six digit
+	// code cannot be brute forced.
+	localMaxCodeAttempts = 5
+	// localMinPasswordLength mirrors the Cognito user pool's password policy
+	localMinPasswordLength = 8
+)
+
+// LocalProvider is a self-contained IdentityProvider for development and CI.
+// Passwords are stored as bcrypt hashes. It sends no email: confirmation,
+// reset and verification codes are written to the codes writer, a file only
+// set up in DEV_MODE, and never to the log.
+type LocalProvider struct {
+	store      localStore
+	signingKey []byte
+	codes      io.Writer
+}
+
+// NewLocalProvider returns a local provider over the given store, delivering
+// codes to the codes writer; with a nil writer they are not delivered at all.
+// Its tokens are signed with LOCAL_IDENTITY_SECRET; without one a random key
+// is used, so they do not survive a restart or work across replicas.
+func NewLocalProvider(store localStore, codes io.Writer) *LocalProvider {
+	key := []byte(os.Getenv("LOCAL_IDENTITY_SECRET"))
+	if len(key) == 0 {
+		log.Println("LOCAL_IDENTITY_SECRET is not set, using a random key for local identity tokens")
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			log.Fatalf("Failed to generate local identity key: %v", err)
+		}
+	}
+	return &LocalProvider{store: store, signingKey: key, codes: codes}
+}
+
+// localToken is the payload of the provider's signed access and challenge tokens
+type localToken struct {
+	Username  string `json:"username"`
+	Purpose   string `json:"purpose"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+func (p *LocalProvider) signToken(username, purpose string, lifetime time.Duration) (string, error) {
+	payload, err := json.Marshal(localToken{
+		Username:  normalizeUsername(username),
+		Purpose:   purpose,
+		ExpiresAt: time.Now().Add(lifetime).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, p.signingKey)
+	mac.Write(payload)
+	return base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+func (p *LocalProvider) verifyToken(token, purpose string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return "", ErrNotAuthorized
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", ErrNotAuthorized
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", ErrNotAuthorized
+	}
+	mac := hmac.New(sha256.New, p.signingKey)
+	mac.Write(payload)
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return "", ErrNotAuthorized
+	}
+
+	var claims localToken
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return "", ErrNotAuthorized
+	}
+	if claims.Purpose != purpose || time.Now().Unix() > claims.ExpiresAt {
+		return "", ErrNotAuthorized
+	}
+	return claims.Username, nil
+}
+
+// userFromToken loads the user an access token was issued to
+func (p *LocalProvider) userFromToken(ctx context.Context, accessToken string) (*localUser, error) {
+	username, err := p.verifyToken(accessToken, "access")
+	if err != nil {
+		return nil, err
+	}
+	return p.store.Get(ctx, username)
+}
+
+// newCode returns a six digit code and its hash, writing the code to the codes
+// writer in place of an email
+func (p *LocalProvider) newCode(kind, username string) (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	code := fmt.Sprintf("%06d", n.Int64())
+	if p.codes == nil {
+		log.Printf("Local identity provider: %s code for %s not delivered, set DEV_MODE and LOCAL_IDENTITY_CODE_FILE to receive codes", kind, username)
+	} else if _, err := fmt.Fprintf(p.codes, "%s %s code for %s: %s\n",
+		time.Now().UTC().Format(time.RFC3339), kind, username, code); err != nil {
+		return "", fmt.Errorf("writing %s code: %w", kind, err)
+	}
+	return hashCode(code), nil
+}
+
+func hashCode(code string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(code)))
+	return hex.EncodeToString(sum[:])
+}
+
+// checkCode compares a submitted code with a stored hash and expiry
+func checkCode(code, hash string, expiresAt time.Time) error {
+	if hash == "" || time.Now().After(expiresAt) {
+		return ErrCodeMismatch
+	}
+	if subtle.ConstantTimeCompare([]byte(hashCode(code)), []byte(hash)) != 1 {
+		return ErrCodeMismatch
+	}
+	return nil
+}
+
+// useCode checks a code belonging to the user, counting wrong guesses in
+// attempts. A matching code is cleared so it cannot be used twice; the last
+// allowed wrong guess clears it too and returns ErrLimitExceeded. The caller
+// saves the user on success, useCode saves the failed attempt itself.
+func (p *LocalProvider) useCode(ctx context.Context, user *localUser, code string, hash *string, expiresAt time.Time, attempts *int) error {
+	err := checkCode(code, *hash, expiresAt)
+	if err == nil {
+		*hash = ""
+		*attempts = 0
+		return nil
+	}
+	if *hash == "" {
+		return err
+	}
+
+	*attempts++
+	if *attempts >= localMaxCodeAttempts {
+		*hash = ""
+		err = ErrLimitExceeded
+	}
+	if updateErr := p.store.Update(ctx, user.Username, user); updateErr != nil {
+		return updateErr
+	}
+	return err
+}
+
+func checkPasswordPolicy(password string) error {
+	if len(password) < localMinPasswordLength {
+		return ErrInvalidPassword
+	}
+	return nil
+}
+
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// SignUp creates an unconfirmed user and delivers the confirmation code
+func (p *LocalProvider) SignUp(ctx context.Context, email, password string) (string, error) {
+	if err := checkPasswordPolicy(password); err != nil {
+		return "", err
+	}
+	passwordHash, err := hashPassword(password)
+	if err != nil {
+		return "", err
+	}
+	codeHash, err := p.newCode("confirmation", email)
+	if err != nil {
+		return "", err
+	}
+
+	user := &localUser{
+		UserID:                gocql.MustRandomUUID().String(),
+		Username:              normalizeUsername(email),
+		PasswordHash:          passwordHash,
+		ConfirmationCodeHash:  codeHash,
+		ConfirmationExpiresAt: time.Now().Add(localConfirmationLifetime),
+	}
+	if err := p.store.Create(ctx, user); err != nil {
+		return "", err
+	}
+	return user.UserID, nil
+}
+
+// ConfirmSignUp confirms the account with the delivered confirmation code
+func (p *LocalProvider) ConfirmSignUp(ctx context.Context, username, code string) error {
+	user, err := p.store.Get(ctx, username)
+	if err != nil {
+		return err
+	}
+	if err := p.useCode(ctx, user, code, &user.ConfirmationCodeHash, user.ConfirmationExpiresAt, &user.ConfirmationAttempts); err != nil {
+		return err
+	}
+	user.Confirmed = true
+	return p.store.Update(ctx, user.Username, user)
+}
+
+// ResendConfirmationCode delivers a new confirmation code
+func (p *LocalProvider) ResendConfirmationCode(ctx context.Context, username string) error {
+	user, err := p.store.Get(ctx, username)
+	if err != nil {
+		return err
+	}
+	if user.Confirmed {
+		return fmt.Errorf("%w: user is already confirmed", ErrCodeMismatch)
+	}
+	codeHash, err := p.newCode("confirmation", user.Username)
+	if err != nil {
+		return err
+	}
+	user.ConfirmationCodeHash = codeHash
+	user.ConfirmationAttempts = 0
+	user.ConfirmationExpiresAt = time.Now().Add(localConfirmationLifetime)
+	return p.store.Update(ctx, user.Username, user)
+}
+
+// IsConfirmed reports whether the account has been confirmed
+func (p *LocalProvider) IsConfirmed(ctx context.Context, username string) (bool, error) {
+	user, err := p.store.Get(ctx, username)
+	if err != nil {
+		return false, err
+	}
+	return user.Confirmed, nil
+}
+
+// UserID returns the ID generated for the account at sign-up
+func (p *LocalProvider) UserID(ctx context.Context, username string) (string, error) {
+	user, err := p.store.Get(ctx, username)
+	if err != nil {
+		return "", err
+	}
+	return user.UserID, nil
+}
+
+// Authenticate checks the password, returning a challenge when MFA is enabled
+func (p *LocalProvider) Authenticate(ctx context.Context, username, password string) (*AuthResult, error) {
+	user, err := p.store.Get(ctx, username)
+	if errors.Is(err, ErrUserNotFound) {
+		// Same answer as a wrong password, as Cognito does
+		return nil, ErrNotAuthorized
+	} else if err != nil {
+		return nil, err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		return nil, ErrNotAuthorized
+	}
+	if !user.Confirmed {
+		return nil, ErrUserNotConfirmed
+	}
+
+	if user.MFAEnabled {
+		session, err := p.signToken(user.Username, "mfa", localChallengeLifetime)
+		if err != nil {
+			return nil, err
+		}
+		return &AuthResult{Challenge: &Challenge{
+			Name:     ChallengeSoftwareTokenMFA,
+			Username: user.Username,
+			Session:  session,
+		}}, nil
+	}
+	return p.authResult(user)
+}
+
+// RespondToMFAChallenge completes a login with a TOTP code
+func (p *LocalProvider) RespondToMFAChallenge(ctx context.Context, challenge *Challenge, code string) (*AuthResult, error) {
+	username, err := p.verifyToken(challenge.Session, "mfa")
+	if err != nil || username != normalizeUsername(challenge.Username) {
+		return nil, ErrNotAuthorized
+	}
+	user, err := p.store.Get(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if !user.MFAEnabled || !validateTOTP(user.TOTPSecret, code, time.Now()) {
+		return nil, ErrCodeMismatch
+	}
+	return p.authResult(user)
+}
+
+func (p *LocalProvider) authResult(user *localUser) (*AuthResult, error) {
+	accessToken, err := p.signToken(user.Username, "access", localAccessTokenLifetime)
+	if err != nil {
+		return nil, err
+	}
+	return &AuthResult{
+		UserID:      user.UserID,
+		AccessToken: accessToken,
+		ExpiresIn:   localAccessTokenLifetime,
+	}, nil
+}
+
+// ForgotPassword delivers a password reset code
+func (p *LocalProvider) ForgotPassword(ctx context.Context, username string) error {
+	user, err := p.store.Get(ctx, username)
+	if err != nil {
+		return err
+	}
+	codeHash, err := p.newCode("password reset", user.Username)
+	if err != nil {
+		return err
+	}
+	user.ResetCodeHash = codeHash
+	user.ResetAttempts = 0
+	user.ResetExpiresAt = time.Now().Add(localCodeLifetime)
+	return p.store.Update(ctx, user.Username, user)
+}
+
+// ConfirmForgotPassword sets a new password using the reset code
+func (p *LocalProvider) ConfirmForgotPassword(ctx context.Context, username, code, newPassword string) error {
+	user, err := p.store.Get(ctx, username)
+	if err != nil {
+		return err
+	}
+	// The password is checked first, so a weak one does not use up the code
+	if err := checkPasswordPolicy(newPassword); err != nil {
+		return err
+	}
+	if err := p.useCode(ctx, user, code, &user.ResetCodeHash, user.ResetExpiresAt, &user.ResetAttempts); err != nil {
+		return err
+	}
+	passwordHash, err := hashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+	user.PasswordHash = passwordHash
+	return p.store.Update(ctx, user.Username, user)
+}
+
+// ChangePassword changes the password of the user the access token belongs to
+func (p *LocalProvider) ChangePassword(ctx context.Context, accessToken, oldPassword, newPassword string) error {
+	user, err := p.userFromToken(ctx, accessToken)
+	if err != nil {
+		return err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(oldPassword)) != nil {
+		return ErrNotAuthorized
+	}
+	if err := checkPasswordPolicy(newPassword); err != nil {
+		return err
+	}
+	passwordHash, err := hashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+	user.PasswordHash = passwordHash
+	return p.store.Update(ctx, user.Username, user)
+}
+
+// UpdateEmail records the new address and delivers its verification code
+func (p *LocalProvider) UpdateEmail(ctx context.Context, accessToken, newEmail string) error {
+	user, err := p.userFromToken(ctx, accessToken)
+	if err != nil {
+		return err
+	}
+	if _, err := p.store.Get(ctx, newEmail); err == nil {
+		return ErrAliasExists
+	} else if !errors.Is(err, ErrUserNotFound) {
+		return err
+	}
+	codeHash, err := p.newCode("email verification", newEmail)
+	if err != nil {
+		return err
+	}
+	user.PendingEmail = normalizeUsername(newEmail)
+	user.EmailCodeHash = codeHash
+	user.EmailCodeAttempts = 0
+	user.EmailCodeExpiresAt = time.Now().Add(localCodeLifetime)
+	return p.store.Update(ctx, user.Username, user)
+}
+
+// VerifyEmail switches the account to the pending address
+func (p *LocalProvider) VerifyEmail(ctx context.Context, accessToken, code string) error {
+	user, err := p.userFromToken(ctx, accessToken)
+	if err != nil {
+		return err
+	}
+	if user.PendingEmail == "" {
+		return ErrCodeMismatch
+	}
+	if err := p.useCode(ctx, user, code, &user.EmailCodeHash, user.EmailCodeExpiresAt, &user.EmailCodeAttempts); err != nil {
+		return err
+	}
+	oldUsername := user.Username
+	user.Username = user.PendingEmail
+	user.PendingEmail = ""
+	return p.store.Update(ctx, oldUsername, user)
+}
+
+// AssociateSoftwareToken generates a TOTP secret awaiting verification
+func (p *LocalProvider) AssociateSoftwareToken(ctx context.Context, accessToken string) (string, error) {
+	user, err := p.userFromToken(ctx, accessToken)
+	if err != nil {
+		return "", err
+	}
+	secret, err := newTOTPSecret()
+	if err != nil {
+		return "", err
+	}
+	user.PendingTOTPSecret = secret
+	if err := p.store.Update(ctx, user.Username, user); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// VerifySoftwareToken activates the pending TOTP secret once a code matches it
+func (p *LocalProvider) VerifySoftwareToken(ctx context.Context, accessToken, code, deviceName string) error {
+	user, err := p.userFromToken(ctx, accessToken)
+	if err != nil {
+		return err
+	}
+	if user.PendingTOTPSecret == "" || !validateTOTP(user.PendingTOTPSecret, code, time.Now()) {
+		return ErrCodeMismatch
+	}
+	user.TOTPSecret = user.PendingTOTPSecret
+	user.PendingTOTPSecret = ""
+	return p.store.Update(ctx, user.Username, user)
+}
+
+// SetSoftwareTokenMFA turns TOTP MFA on or off
+func (p *LocalProvider) SetSoftwareTokenMFA(ctx context.Context, accessToken string, enabled bool) error {
+	user, err := p.userFromToken(ctx, accessToken)
+	if err != nil {
+		return err
+	}
+	if enabled && user.TOTPSecret == "" {
+		return ErrCodeMismatch
+	}
+	user.MFAEnabled = enabled
+	return p.store.Update(ctx, user.Username, user)
+}
+
+// AdminDisableSoftwareTokenMFA turns off TOTP MFA for a recovery code login
+func (p *LocalProvider) AdminDisableSoftwareTokenMFA(ctx context.Context, username string) error {
+	user, err := p.store.Get(ctx, username)
+	if err != nil {
+		return err
+	}
+	user.MFAEnabled = false
+	return p.store.Update(ctx, user.Username, user)
+}
+
+// MFAEnabled reports whether the user has TOTP MFA turned on
+func (p *LocalProvider) MFAEnabled(ctx context.Context, username string) (bool, error) {
+	user, err := p.store.Get(ctx, username)
+	if err != nil {
+		return false, err
+	}
+	return user.MFAEnabled, nil
+}
@@ -0,0 +1,176 @@
+package identity
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// localUser is an account managed by the local provider
+type localUser struct {
+	UserID       string
+	Username     string
+	PasswordHash string
+	Confirmed    bool
+
+	ConfirmationCodeHash  string
+	ConfirmationExpiresAt time.Time
+	ConfirmationAttempts  int
+	ResetCodeHash         string
+	ResetExpiresAt        time.Time
+	ResetAttempts         int
+
+	PendingEmail       string
+	EmailCodeHash      string
+	EmailCodeExpiresAt time.Time
+	EmailCodeAttempts  int
+
+	TOTPSecret        string
+	PendingTOTPSecret string
+	MFAEnabled        bool
+}
+
+// localStore persists local users keyed by their lowercased username
+type localStore interface {
+	Get(ctx context.Context, username string) (*localUser, error)
+	// Create fails with ErrUserExists if the username is taken
+	Create(ctx context.Context, user *localUser) error
+	// Update saves the user; a changed Username moves the record from oldUsername
+	Update(ctx context.Context, oldUsername string, user *localUser) error
+}
+
+func normalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// memoryStore keeps users in process memory, for tests and offline development
+type memoryStore struct {
+	mu    sync.Mutex
+	users map[string]localUser
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{users: make(map[string]localUser)}
+}
+
+func (s *memoryStore) Get(ctx context.Context, username string) (*localUser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[normalizeUsername(username)]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	return &user, nil
+}
+
+func (s *memoryStore) Create(ctx context.Context, user *localUser) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := normalizeUsername(user.Username)
+	if _, ok := s.users[key]; ok {
+		return ErrUserExists
+	}
+	s.users[key] = *user
+	return nil
+}
+
+func (s *memoryStore) Update(ctx context.Context, oldUsername string, user *localUser) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	oldKey := normalizeUsername(oldUsername)
+	newKey := normalizeUsername(user.Username)
+	if newKey != oldKey {
+		if _, ok := s.users[newKey]; ok {
+			return ErrAliasExists
+		}
+		delete(s.users, oldKey)
+	}
+	s.users[newKey] = *user
+	return nil
+}
+
+// cassandraStore keeps users in the local_identities table
+type cassandraStore struct {
+	session *gocql.Session
+}
+
+func newCassandraStore(session *gocql.Session) *cassandraStore {
+	return &cassandraStore{session: session}
+}
+
+const localUserColumns = `user_id, password_hash, confirmed,
+	confirmation_code_hash, confirmation_expires_at, confirmation_attempts,
+	reset_code_hash, reset_expires_at, reset_attempts,
+	pending_email, email_code_hash, email_code_expires_at, email_code_attempts,
+	totp_secret, pending_totp_secret, mfa_enabled`
+
+// localUserPlaceholders has a bind marker for the username and each of localUserColumns
+const localUserPlaceholders = `?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?`
+
+func (u *localUser) values() []interface{} {
+	return []interface{}{
+		u.UserID, u.PasswordHash, u.Confirmed,
+		u.ConfirmationCodeHash, u.ConfirmationExpiresAt, u.ConfirmationAttempts,
+		u.ResetCodeHash, u.ResetExpiresAt, u.ResetAttempts,
+		u.PendingEmail, u.EmailCodeHash, u.EmailCodeExpiresAt, u.EmailCodeAttempts,
+		u.TOTPSecret, u.PendingTOTPSecret, u.MFAEnabled,
+	}
+}
+
+func (s *cassandraStore) Get(ctx context.Context, username string) (*localUser, error) {
+	user := localUser{Username: normalizeUsername(username)}
+	err := s.session.Query(`SELECT `+localUserColumns+` FROM local_identities WHERE username = ?`,
+		user.Username).WithContext(ctx).Scan(
+		&user.UserID, &user.PasswordHash, &user.Confirmed,
+		&user.ConfirmationCodeHash, &user.ConfirmationExpiresAt, &user.ConfirmationAttempts,
+		&user.ResetCodeHash, &user.ResetExpiresAt, &user.ResetAttempts,
+		&user.PendingEmail, &user.EmailCodeHash, &user.EmailCodeExpiresAt, &user.EmailCodeAttempts,
+		&user.TOTPSecret, &user.PendingTOTPSecret, &user.MFAEnabled,
+	)
+	if err == gocql.ErrNotFound {
+		return nil, ErrUserNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (s *cassandraStore) Create(ctx context.Context, user *localUser) error {
+	applied, err := s.session.Query(
+		`INSERT INTO local_identities (username, `+localUserColumns+`)
+		VALUES (`+localUserPlaceholders+`) IF NOT EXISTS`,
+		append([]interface{}{normalizeUsername(user.Username)}, user.values()...)...,
+	).WithContext(ctx).MapScanCAS(map[string]interface{}{})
+	if err != nil {
+		return err
+	}
+	if !applied {
+		return ErrUserExists
+	}
+	return nil
+}
+
+func (s *cassandraStore) Update(ctx context.Context, oldUsername string, user *localUser) error {
+	oldKey := normalizeUsername(oldUsername)
+	newKey := normalizeUsername(user.Username)
+	insert := `INSERT INTO local_identities (username, ` + localUserColumns + `)
+		VALUES (` + localUserPlaceholders + `)`
+	values := append([]interface{}{newKey}, user.values()...)
+
+	if newKey == oldKey {
+		return s.session.Query(insert, values...).WithContext(ctx).Exec()
+	}
+
+	if _, err := s.Get(ctx, newKey); err == nil {
+		return ErrAliasExists
+	} else if err != ErrUserNotFound {
+		return err
+	}
+	batch := s.session.NewBatch(gocql.LoggedBatch).WithContext(ctx)
+	batch.Query(insert, values...)
+	batch.Query(`DELETE FROM local_identities WHERE username = ?`, oldKey)
+	return s.session.ExecuteBatch(batch)
+}
@@ -0,0 +1,108 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// Provider names accepted in IDENTITY_PROVIDER
+const (
+	ProviderCognito = "cognito"
+	ProviderLocal   = "local"
+)
+
+// ChallengeSoftwareTokenMFA is the challenge returned when a TOTP code is required
+const ChallengeSoftwareTokenMFA = "SOFTWARE_TOKEN_MFA"
+
+// Errors returned by every provider, so handlers can map them to responses
+// without knowing which provider is in use
+var (
+	ErrUserNotFound         = errors.New("user not found")
+	ErrUserExists           = errors.New("user already exists")
+	ErrNotAuthorized        = errors.New("incorrect username or password")
+	ErrUserNotConfirmed     = errors.New("user is not confirmed")
+	ErrCodeMismatch         = errors.New("invalid or expired code")
+	ErrInvalidPassword      = errors.New("password does not meet the requirements")
+	ErrLimitExceeded        = errors.New("attempt limit exceeded")
+	ErrAliasExists          = errors.New("email address is already in use")
+	ErrUnsupportedChallenge = errors.New("unsupported authentication challenge")
+)
+
+// AuthResult is the outcome of a successful password or MFA step. When a
+// second factor is required, Challenge is set and the other fields are empty.
+type AuthResult struct {
+	UserID string
+	// AccessToken is the provider's own token for self-service calls such as
+	// ChangePassword; it is never handed to clients
+	AccessToken string
+	ExpiresIn   time.Duration
+	Challenge   *Challenge
+}
+
+// Challenge is a pending second factor, answered with RespondToMFAChallenge
+type Challenge struct {
+	Name     string
+	Username string
+	Session  string
+}
+
+// IdentityProvider is everything account-api needs from a user directory.
+// Usernames are the account's email address.
+type IdentityProvider interface {
+	SignUp(ctx context.Context, email, password string) (string, error)
+	ConfirmSignUp(ctx context.Context, username, code string) error
+	ResendConfirmationCode(ctx context.Context, username string) error
+	IsConfirmed(ctx context.Context, username string) (bool, error)
+	// UserID returns the ID of the account, the same one SignUp returned
+	UserID(ctx context.Context, username string) (string, error)
+
+	Authenticate(ctx context.Context, username, password string) (*AuthResult, error)
+	RespondToMFAChallenge(ctx context.Context, challenge *Challenge, code string) (*AuthResult, error)
+
+	ForgotPassword(ctx context.Context, username string) error
+	ConfirmForgotPassword(ctx context.Context, username, code, newPassword string) error
+	ChangePassword(ctx context.Context, accessToken, oldPassword, newPassword string) error
+
+	UpdateEmail(ctx context.Context, accessToken, newEmail string) error
+	VerifyEmail(ctx context.Context, accessToken, code string) error
+
+	AssociateSoftwareToken(ctx context.Context, accessToken string) (string, error)
+	VerifySoftwareToken(ctx context.Context, accessToken, code, deviceName string) error
+	SetSoftwareTokenMFA(ctx context.Context, accessToken string, enabled bool) error
+	AdminDisableSoftwareTokenMFA(ctx context.Context, username string) error
+	MFAEnabled(ctx context.Context, username string) (bool, error)
+}
+
+// Provider is the identity provider selected at startup
+var Provider IdentityProvider
+
+// New creates the named provider. The local provider keeps its users in
+// Cassandra, or in memory when storeName is "memory", and delivers its codes
+// to the codes writer.
+func New(name, storeName string, session *gocql.Session, codes io.Writer) (IdentityProvider, error) {
+	switch name {
+	case ProviderCognito:
+		return NewCognitoProvider(), nil
+	case ProviderLocal:
+		var store localStore
+		switch storeName {
+		case "memory":
+			store = newMemoryStore()
+		case "cassandra":
+			if session == nil {
+				return nil, errors.New("the cassandra local identity store needs a Cassandra connection")
+			}
+			store = newCassandraStore(session)
+		default:
+			return nil, fmt.Errorf("unknown local identity store %q", storeName)
+		}
+		return NewLocalProvider(store, codes), nil
+	default:
+		return nil, fmt.Errorf("unknown identity provider %q", name)
+	}
+}
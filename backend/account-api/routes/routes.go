@@ -1,11 +1,14 @@
 package routes
 
 import (
+	"account-api/config"
 	"account-api/handlers"
 	"context" // Add this import
 	"github.com/gocql/gocql"
 	"github.com/gorilla/mux"
 	"net/http"
+	"shared/auth"
+	"shared/logging"
 )
 
 // SessionMiddleware adds the session to the request context
@@ -27,12 +30,49 @@ func SetupRoutes(session *gocql.Session) *mux.Router {
 	router := mux.NewRouter()
 
 	// Add the session middleware to the router
+	router.Use(logging.Middleware)
 	router.Use(SessionMiddleware(session))
 
 	// Define routes (no need to pass session here anymore)
 	router.HandleFunc("/register", handlers.Register).Methods("POST")
 	router.HandleFunc("/login", handlers.Login).Methods("POST")
+	router.HandleFunc("/login/mfa", handlers.LoginMFA).Methods("POST")
 	router.HandleFunc("/confirm", handlers.ConfirmSignUp()).Methods("POST")
+	router.HandleFunc("/confirm/resend", handlers.ResendConfirmationCode).Methods("POST")
+	router.HandleFunc("/confirm/status", handlers.ConfirmationStatus).Methods("GET")
+	router.HandleFunc("/refresh", handlers.Refresh).Methods("POST")
+	router.HandleFunc("/.well-known/jwks.json", handlers.JWKS).Methods("GET")
+	router.HandleFunc("/password/forgot", handlers.ForgotPassword).Methods("POST")
+	router.HandleFunc("/password/reset", handlers.ResetPassword).Methods("POST")
+	router.HandleFunc("/avatars/{user_id}/{file}", handlers.GetAvatar).Methods("GET")
+
+	// Authenticated routes
+	requireAuth := auth.JWTMiddleware(config.Verifier, config.Sessions)
+	router.Handle("/logout", requireAuth(http.HandlerFunc(handlers.Logout))).Methods("POST")
+	router.Handle("/logout/all", requireAuth(http.HandlerFunc(handlers.LogoutAll))).Methods("POST")
+	router.Handle("/sessions", requireAuth(http.HandlerFunc(handlers.ListSessions))).Methods("GET")
+	router.Handle("/sessions/{session_id}", requireAuth(http.HandlerFunc(handlers.RevokeSession))).Methods("DELETE")
+	router.Handle("/password/change", requireAuth(http.HandlerFunc(handlers.ChangePassword))).Methods("POST")
+	router.Handle("/email/change", requireAuth(http.HandlerFunc(handlers.ChangeEmail))).Methods("POST")
+	router.Handle("/email/verify", requireAuth(http.HandlerFunc(handlers.VerifyEmailChange))).Methods("POST")
+	router.Handle("/mfa", requireAuth(http.HandlerFunc(handlers.MFAStatus))).Methods("GET")
+	router.Handle("/mfa/setup", requireAuth(http.HandlerFunc(handlers.SetupMFA))).Methods("POST")
+	router.Handle("/mfa/verify", requireAuth(http.HandlerFunc(handlers.VerifyMFA))).Methods("POST")
+	router.Handle("/mfa/disable", requireAuth(http.HandlerFunc(handlers.DisableMFA))).Methods("POST")
+	router.Handle("/mfa/recovery-codes", requireAuth(http.HandlerFunc(handlers.RegenerateRecoveryCodes))).Methods("POST")
+	router.Handle("/tokens", requireAuth(http.HandlerFunc(handlers.CreateAccessToken))).Methods("POST")
+	router.Handle("/tokens", requireAuth(http.HandlerFunc(handlers.ListAccessTokens))).Methods("GET")
+	router.Handle("/tokens/{token_id}", requireAuth(http.HandlerFunc(handlers.RevokeAccessToken))).Methods("DELETE")
+	router.Handle("/me", requireAuth(http.HandlerFunc(handlers.GetMe))).Methods("GET")
+	router.Handle("/me", requireAuth(http.HandlerFunc(handlers.UpdateMe))).Methods("PATCH")
+	router.Handle("/me/avatar", requireAuth(http.HandlerFunc(handlers.UploadAvatar))).Methods("PUT")
+	router.Handle("/me/avatar", requireAuth(http.HandlerFunc(handlers.DeleteAvatar))).Methods("DELETE")
+	router.Handle("/users/lookup", requireAuth(http.HandlerFunc(handlers.LookupUsers))).Methods("POST")
+	router.Handle("/users/search", requireAuth(http.HandlerFunc(handlers.SearchUsers))).Methods("GET")
+
+	// Admin routes, authorized with ADMIN_API_TOKEN
+	router.Handle("/admin/login-lockouts/unlock", handlers.AdminMiddleware(http.HandlerFunc(handlers.UnlockLogin))).Methods("POST")
+	router.Handle("/admin/backfill/user-lookups", handlers.AdminMiddleware(http.HandlerFunc(handlers.BackfillUserLookups))).Methods("POST")
 
 	return router
 }
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	sharedconfig "shared/config"
+	"shared/lockout"
+	"shared/session"
+	"shared/token"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	testClientID     = "test-client"
+	testClientSecret = "test-secret"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// cognitoCall is a request the fake Cognito received
+type cognitoCall struct {
+	Operation string
+	Body      map[string]interface{}
+}
+
+// fakeCognito answers Cognito's JSON protocol. Operations without a set
+// error succeed with an empty response.
+type fakeCognito struct {
+	mu     sync.Mutex
+	calls  []cognitoCall
+	errors map[string]string
+}
+
+func (f *fakeCognito) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	operation := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "AWSCognitoIdentityProviderService.")
+	var body map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	f.calls = append(f.calls, cognitoCall{Operation: operation, Body: body})
+	errorType := f.errors[operation]
+	f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	if errorType != "" {
+		w.Header().Set("X-Amzn-Errortype", errorType)
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"__type": errorType, "message": "fake " + errorType})
+		return
+	}
+	io.WriteString(w, "{}")
+}
+
+// fail makes every later call of operation return an errorType error
+func (f *fakeCognito) fail(operation, errorType string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.errors == nil {
+		f.errors = map[string]string{}
+	}
+	f.errors[operation] = errorType
+}
+
+func (f *fakeCognito) received() []cognitoCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]cognitoCall(nil), f.calls...)
+}
+
+// newTestServices returns services backed by a fake Cognito and an
+// in-memory Redis. There is no Cassandra, so handlers that need it cannot
+// be run past their request validation.
+func newTestServices(t *testing.T) (*Services, *fakeCognito) {
+	t.Helper()
+	cognito := &fakeCognito{}
+	server := httptest.NewServer(cognito)
+	t.Cleanup(server.Close)
+
+	redisServer := miniredis.RunT(t)
+	redisClient := redis.NewClient(&redis.Options{Addr: redisServer.Addr()})
+	t.Cleanup(func() { redisClient.Close() })
+
+	keys, err := token.LoadKeyRing("", "", true)
+	if err != nil {
+		t.Fatalf("LoadKeyRing: %v", err)
+	}
+	policy := token.DefaultPolicy()
+	return &Services{
+		Cognito: &sharedconfig.Cognito{
+			Client: cognitoidentityprovider.New(cognitoidentityprovider.Options{
+				Region:           "us-east-1",
+				BaseEndpoint:     aws.String(server.URL),
+				Credentials:      aws.AnonymousCredentials{},
+				RetryMaxAttempts: 1,
+			}),
+			AppClientID:     testClientID,
+			AppClientSecret: testClientSecret,
+		},
+		Sessions: session.NewStore(redisClient, policy),
+		Lockout:  lockout.NewStore(redisClient),
+		Tokens:   policy,
+		Keys:     keys,
+		Issuer:   &token.Issuer{Keys: keys, Issuer: "test-issuer", Audience: "test-audience"},
+	}, cognito
+}
+
+// newTestRouter routes the handlers as main does
+func newTestRouter(s *Services, requireAuth gin.HandlerFunc) *gin.Engine {
+	r := gin.New()
+	v1 := r.Group("/v1")
+	v1.POST("/register", Register(s))
+	v1.POST("/confirm", Confirm(s))
+	v1.POST("/login", Login(s))
+	v1.POST("/refresh", Refresh(s))
+	v1.POST("/logout", requireAuth, Logout(s))
+	return r
+}
+
+func post(router http.Handler, path, body string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
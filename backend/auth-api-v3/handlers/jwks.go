@@ -0,0 +1,17 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JWKS publishes the public keys access tokens can be verified with
+func JWKS(s *Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Short enough that a rotation is picked up quickly; verifiers also
+		// refetch when they see an unknown kid
+		c.Header("Cache-Control", "public, max-age=300")
+		c.JSON(http.StatusOK, s.Keys.KeySet())
+	}
+}
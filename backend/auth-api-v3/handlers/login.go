@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"shared/logging"
+	"shared/models"
+	"shared/session"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider"
+	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider/types"
+	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
+)
+
+// Login authenticates the user with Cognito and starts a session, responding
+// with an access token and the session's first refresh token. Failed logins
+// count towards the same lockout as account-api's.
+func Login(s *Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req LoginRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"msg": err.Error()})
+			return
+		}
+		ctx := c.Request.Context()
+
+		email, ip := normalizeEmail(req.Email), c.ClientIP()
+		retryAfter, err := s.Lockout.Blocked(ctx, email, ip)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"msg": "Authentication failed"})
+			return
+		}
+		if retryAfter > 0 {
+			logging.Printf(ctx, "Login blocked for %s from %s for another %s", email, ip, retryAfter)
+			c.Header("Retry-After", formatSeconds(retryAfter))
+			c.JSON(http.StatusTooManyRequests, gin.H{"msg": "Too many failed login attempts, please try again later"})
+			return
+		}
+
+		authOutput, err := s.Cognito.Client.InitiateAuth(ctx, &cognitoidentityprovider.InitiateAuthInput{
+			AuthFlow: types.AuthFlowTypeUserPasswordAuth,
+			ClientId: aws.String(s.Cognito.AppClientID),
+			AuthParameters: map[string]string{
+				"USERNAME":    req.Email,
+				"PASSWORD":    req.Password,
+				"SECRET_HASH": s.Cognito.SecretHash(req.Email),
+			},
+		})
+		var (
+			notAuthorized    *types.NotAuthorizedException
+			userNotFound     *types.UserNotFoundException
+			userNotConfirmed *types.UserNotConfirmedException
+			tooManyRequests  *types.TooManyRequestsException
+		)
+		if errors.As(err, &notAuthorized) || errors.As(err, &userNotFound) {
+			if _, err := s.Lockout.RecordFailure(ctx, email, ip); err != nil {
+				logging.Printf(ctx, "Error recording login failure for %s: %v", email, err)
+			}
+			c.JSON(http.StatusUnauthorized, gin.H{"msg": "Authentication failed"})
+			return
+		} else if errors.As(err, &tooManyRequests) {
+			c.JSON(http.StatusTooManyRequests, gin.H{"msg": "Too many login attempts, please try again later"})
+			return
+		} else if errors.As(err, &userNotConfirmed) {
+			c.JSON(http.StatusForbidden, gin.H{"msg": "User account is not confirmed"})
+			return
+		} else if err != nil {
+			logging.Errorf(ctx, "Cognito authentication failed for user %s: %v", req.Email, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"msg": "Authentication failed"})
+			return
+		}
+		if authOutput.AuthenticationResult == nil {
+			// MFA challenges are only answered by account-api's /login/mfa
+			c.JSON(http.StatusForbidden, gin.H{"msg": "Multi-factor authentication is required, sign in through account-api"})
+			logging.Printf(ctx, "Unsupported challenge %s for user %s", authOutput.ChallengeName, req.Email)
+			return
+		}
+
+		if err := s.Lockout.ClearFailures(ctx, email); err != nil {
+			logging.Printf(ctx, "Error clearing login failures for %s: %v", email, err)
+		}
+
+		// The Cognito sub is the user ID everywhere else
+		user, err := s.Cognito.Client.GetUser(ctx, &cognitoidentityprovider.GetUserInput{
+			AccessToken: authOutput.AuthenticationResult.AccessToken,
+		})
+		if err != nil {
+			logging.Errorf(ctx, "Failed to look up user %s: %v", req.Email, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"msg": "Authentication failed"})
+			return
+		}
+		var userID string
+		for _, attribute := range user.UserAttributes {
+			if aws.ToString(attribute.Name) == "sub" {
+				userID = aws.ToString(attribute.Value)
+			}
+		}
+		if userID == "" {
+			logging.Errorf(ctx, "Cognito user %s has no sub", req.Email)
+			c.JSON(http.StatusInternalServerError, gin.H{"msg": "Authentication failed"})
+			return
+		}
+
+		// Start a session for this device
+		now := time.Now()
+		deviceName := req.DeviceName
+		if deviceName == "" {
+			deviceName = c.Request.UserAgent()
+		}
+		sess := &session.Session{
+			SessionID: gocql.MustRandomUUID().String(),
+			UserID:    userID,
+			Device:    deviceName,
+			UserAgent: c.Request.UserAgent(),
+			IPAddress: ip,
+			CreatedAt: now.Unix(),
+			ExpiresAt: s.Tokens.SessionExpiry(now).Unix(),
+			LastSeen:  now.Unix(),
+		}
+		if err := s.Sessions.Create(ctx, sess); err != nil {
+			logging.Errorf(ctx, "Error creating session for user %s: %v", userID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"msg": "Failed to create session"})
+			return
+		}
+
+		jwtToken, expiresAt, err := s.issueAccessToken(sess)
+		if err != nil {
+			logging.Errorf(ctx, "Error generating JWT for user %s: %v", userID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"msg": "Failed to generate JWT"})
+			return
+		}
+		refreshToken, err := s.Sessions.IssueRefreshToken(ctx, sess)
+		if err != nil {
+			logging.Errorf(ctx, "Error issuing refresh token for user %s: %v", userID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"msg": "Failed to generate refresh token"})
+			return
+		}
+
+		c.JSON(http.StatusOK, models.TokenResponse{
+			Message:      "Login successful",
+			UserID:       userID,
+			JWTToken:     jwtToken,
+			ExpiresAt:    expiresAt.Unix(),
+			ExpiresIn:    int64(time.Until(expiresAt).Seconds()),
+			RefreshToken: refreshToken,
+			SessionID:    sess.SessionID,
+		})
+	}
+}
+
+// Refresh exchanges a refresh token for a new access token. The refresh token
+// is rotated on every use; presenting a rotated one again revokes the session.
+func Refresh(s *Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req RefreshRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"msg": err.Error()})
+			return
+		}
+
+		sess, refreshToken, err := s.Sessions.RotateRefreshToken(c.Request.Context(), req.RefreshToken)
+		if err == session.ErrRefreshTokenInvalid || err == session.ErrRefreshTokenReused {
+			c.JSON(http.StatusUnauthorized, gin.H{"msg": "Invalid refresh token"})
+			return
+		} else if err != nil {
+			logging.Errorf(c.Request.Context(), "Error rotating refresh token: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"msg": "Failed to refresh token"})
+			return
+		}
+
+		jwtToken, expiresAt, err := s.issueAccessToken(sess)
+		if err != nil {
+			logging.Errorf(c.Request.Context(), "Error generating JWT for user %s: %v", sess.UserID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"msg": "Failed to generate JWT"})
+			return
+		}
+
+		c.JSON(http.StatusOK, models.TokenResponse{
+			Message:      "Token refreshed",
+			UserID:       sess.UserID,
+			JWTToken:     jwtToken,
+			ExpiresAt:    expiresAt.Unix(),
+			ExpiresIn:    int64(time.Until(expiresAt).Seconds()),
+			RefreshToken: refreshToken,
+			SessionID:    sess.SessionID,
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"shared/lockout"
+	"shared/models"
+	"shared/session"
+)
+
+func TestRequestValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		body string
+	}{
+		{"register without email", "/v1/register", `{"password": "password1"}`},
+		{"register with invalid email", "/v1/register", `{"email": "ada", "password": "password1"}`},
+		{"register with short password", "/v1/register", `{"email": "ada@example.com", "password": "short"}`},
+		{"register with malformed body", "/v1/register", `{"email": `},
+		{"confirm without code", "/v1/confirm", `{"email": "ada@example.com"}`},
+		{"confirm with invalid email", "/v1/confirm", `{"email": "ada", "code": "123456"}`},
+		{"login without password", "/v1/login", `{"email": "ada@example.com"}`},
+		{"login with invalid email", "/v1/login", `{"email": "ada", "password": "password1"}`},
+		{"login with long device name", "/v1/login",
+			`{"email": "ada@example.com", "password": "password1", "device_name": "` + strings.Repeat("a", 101) + `"}`},
+		{"refresh without token", "/v1/refresh", `{}`},
+		{"refresh with wrong type", "/v1/refresh", `{"refresh_token": 42}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, cognito := newTestServices(t)
+			rec := post(newTestRouter(s, nil), tt.path, tt.body, nil)
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusBadRequest, rec.Body)
+			}
+			var body map[string]string
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body["msg"] == "" {
+				t.Errorf("body = %s, want a msg", rec.Body)
+			}
+			if calls := cognito.received(); len(calls) != 0 {
+				t.Errorf("Cognito was called with %v", calls)
+			}
+		})
+	}
+}
+
+// expectedSecretHash computes Cognito's SECRET_HASH independently of
+// sharedconfig.CognitoSecretHash
+func expectedSecretHash(username string) string {
+	mac := hmac.New(sha256.New, []byte(testClientSecret))
+	mac.Write([]byte(username))
+	mac.Write([]byte(testClientID))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestSecretHash(t *testing.T) {
+	s, cognito := newTestServices(t)
+	router := newTestRouter(s, nil)
+	email := "Ada@Example.com"
+
+	if rec := post(router, "/v1/confirm", `{"email": "`+email+`", "code": "123456"}`, nil); rec.Code != http.StatusOK {
+		t.Fatalf("confirm status = %d: %s", rec.Code, rec.Body)
+	}
+	// The fake answers without tokens, which Login treats as a challenge
+	if rec := post(router, "/v1/login", `{"email": "`+email+`", "password": "password1"}`, nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("login status = %d: %s", rec.Code, rec.Body)
+	}
+
+	calls := cognito.received()
+	if len(calls) != 2 {
+		t.Fatalf("Cognito calls = %v, want ConfirmSignUp and InitiateAuth", calls)
+	}
+	want := expectedSecretHash(email)
+
+	confirm := calls[0]
+	if confirm.Operation != "ConfirmSignUp" {
+		t.Fatalf("first call = %s, want ConfirmSignUp", confirm.Operation)
+	}
+	if confirm.Body["ClientId"] != testClientID {
+		t.Errorf("ConfirmSignUp ClientId = %v, want %s", confirm.Body["ClientId"], testClientID)
+	}
+	if confirm.Body["SecretHash"] != want {
+		t.Errorf("ConfirmSignUp SecretHash = %v, want %s", confirm.Body["SecretHash"], want)
+	}
+
+	login := calls[1]
+	if login.Operation != "InitiateAuth" {
+		t.Fatalf("second call = %s, want InitiateAuth", login.Operation)
+	}
+	params, _ := login.Body["AuthParameters"].(map[string]interface{})
+	if params["SECRET_HASH"] != want {
+		t.Errorf("InitiateAuth SECRET_HASH = %v, want %s", params["SECRET_HASH"], want)
+	}
+	if params["USERNAME"] != email {
+		t.Errorf("InitiateAuth USERNAME = %v, want %s", params["USERNAME"], email)
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	s, cognito := newTestServices(t)
+	cognito.fail("InitiateAuth", "NotAuthorizedException")
+	router := newTestRouter(s, nil)
+	body := `{"email": "ada@example.com", "password": "wrong-password"}`
+
+	for i := int64(0); i < lockout.AccountLimits.BackoffAfter; i++ {
+		if rec := post(router, "/v1/login", body, nil); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: status = %d, want %d: %s", i+1, rec.Code, http.StatusUnauthorized, rec.Body)
+		}
+	}
+
+	// The account is counted by its normalized email, so a change of case
+	// does not get around the block
+	rec := post(router, "/v1/login", `{"email": "ADA@example.com", "password": "password1"}`, nil)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusTooManyRequests, rec.Body)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("Retry-After = %q, want %q", got, "1")
+	}
+	if calls := len(cognito.received()); calls != int(lockout.AccountLimits.BackoffAfter) {
+		t.Errorf("Cognito calls = %d, want %d; a blocked login must not reach Cognito", calls, lockout.AccountLimits.BackoffAfter)
+	}
+}
+
+// startSession creates a session for userID and returns its first refresh token
+func startSession(t *testing.T, s *Services, sessionID, userID string) string {
+	t.Helper()
+	ctx := context.Background()
+	now := time.Now()
+	sess := &session.Session{
+		SessionID: sessionID,
+		UserID:    userID,
+		Device:    "test",
+		CreatedAt: now.Unix(),
+		ExpiresAt: s.Tokens.SessionExpiry(now).Unix(),
+		LastSeen:  now.Unix(),
+	}
+	if err := s.Sessions.Create(ctx, sess); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	refreshToken, err := s.Sessions.IssueRefreshToken(ctx, sess)
+	if err != nil {
+		t.Fatalf("IssueRefreshToken: %v", err)
+	}
+	return refreshToken
+}
+
+func refresh(t *testing.T, router http.Handler, refreshToken string) (int, models.TokenResponse) {
+	t.Helper()
+	rec := post(router, "/v1/refresh", `{"refresh_token": "`+refreshToken+`"}`, nil)
+	var response models.TokenResponse
+	if rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatalf("decoding %s: %v", rec.Body, err)
+		}
+	}
+	return rec.Code, response
+}
+
+func TestRefreshTokenReuse(t *testing.T) {
+	s, _ := newTestServices(t)
+	router := newTestRouter(s, nil)
+	first := startSession(t, s, "session-1", "user-1")
+
+	code, rotated := refresh(t, router, first)
+	if code != http.StatusOK {
+		t.Fatalf("first refresh status = %d, want %d", code, http.StatusOK)
+	}
+	if rotated.UserID != "user-1" || rotated.SessionID != "session-1" {
+		t.Errorf("refreshed user %q session %q, want user-1 session-1", rotated.UserID, rotated.SessionID)
+	}
+	if rotated.JWTToken == "" || rotated.RefreshToken == "" || rotated.RefreshToken == first {
+		t.Fatalf("refresh returned access token %q and refresh token %q, want new ones", rotated.JWTToken, rotated.RefreshToken)
+	}
+
+	// Presenting the spent token again means it leaked, so the session ends
+	// and the token it was rotated to stops working too
+	if code, _ := refresh(t, router, first); code != http.StatusUnauthorized {
+		t.Fatalf("reused refresh status = %d, want %d", code, http.StatusUnauthorized)
+	}
+	if code, _ := refresh(t, router, rotated.RefreshToken); code != http.StatusUnauthorized {
+		t.Errorf("refresh after reuse status = %d, want %d", code, http.StatusUnauthorized)
+	}
+	if _, err := s.Sessions.Get(context.Background(), "session-1"); err != session.ErrNotFound {
+		t.Errorf("Get after reuse: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestRefreshUnknownToken(t *testing.T) {
+	s, _ := newTestServices(t)
+	if code, _ := refresh(t, newTestRouter(s, nil), "not-a-refresh-token"); code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", code, http.StatusUnauthorized)
+	}
+}
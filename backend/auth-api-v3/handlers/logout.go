@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"shared/auth"
+	"shared/logging"
+	"shared/pat"
+	"shared/session"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Logout revokes the session the request was made with
+func Logout(s *Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := auth.UserIDFromContext(c.Request.Context())
+		sessionID, _ := auth.SessionIDFromContext(c.Request.Context())
+
+		err := s.Sessions.Revoke(c.Request.Context(), userID, sessionID)
+		if err != nil && err != session.ErrNotFound {
+			logging.Errorf(c.Request.Context(), "Error revoking session %s for user %s: %v", sessionID, userID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"msg": "Failed to log out"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+	}
+}
+
+// LogoutAll revokes every session and personal access token belonging to the
+// user, logging them out on all devices and scripts
+func LogoutAll(s *Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := auth.UserIDFromContext(c.Request.Context())
+
+		if err := pat.RevokeCredentials(c.Request.Context(), s.Sessions, pat.NewStore(s.Cassandra), userID, ""); err != nil {
+			message := "Logged out of all sessions but access tokens could not be revoked"
+			if errors.Is(err, pat.ErrSessionsNotRevoked) {
+				message = "Failed to log out"
+			}
+			logging.Errorf(c.Request.Context(), "Error revoking credentials of user %s: %v", userID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"msg": message})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Logged out of all sessions successfully"})
+	}
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"shared/logging"
+
+	"errors"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider"
+	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider/types"
+	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
+)
+
+// Register signs the user up in Cognito and stores them in Cassandra. Cognito
+// emails a confirmation code to be sent to /v1/confirm.
+func Register(s *Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req RegisterRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"msg": err.Error()})
+			return
+		}
+
+		result, err := s.Cognito.Client.SignUp(c.Request.Context(), &cognitoidentityprovider.SignUpInput{
+			ClientId:   aws.String(s.Cognito.AppClientID),
+			SecretHash: aws.String(s.Cognito.SecretHash(req.Email)),
+			Username:   aws.String(req.Email),
+			Password:   aws.String(req.Password),
+			UserAttributes: []types.AttributeType{
+				{Name: aws.String("email"), Value: aws.String(req.Email)},
+			},
+		})
+		var (
+			usernameExists  *types.UsernameExistsException
+			invalidPassword *types.InvalidPasswordException
+		)
+		if errors.As(err, &usernameExists) {
+			c.JSON(http.StatusConflict, gin.H{"msg": "User already exists"})
+			return
+		} else if errors.As(err, &invalidPassword) {
+			c.JSON(http.StatusBadRequest, gin.H{"msg": "Password does not meet the password requirements"})
+			return
+		} else if err != nil {
+			logging.Errorf(c.Request.Context(), "Cognito signup failed: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"msg": "Failed to register user"})
+			return
+		}
+		userID := aws.ToString(result.UserSub)
+
+		// Insert user details into Cassandra, along with the email lookup row,
+		// the same way account-api does
+		batch := s.Cassandra.NewBatch(gocql.LoggedBatch)
+		batch.Query(`INSERT INTO users (user_id, username, email) VALUES (?, ?, ?)`,
+			userID, req.Email, req.Email)
+		batch.Query(`INSERT INTO users_by_email (email, user_id) VALUES (?, ?)`,
+			normalizeEmail(req.Email), userID)
+		if err := s.Cassandra.ExecuteBatch(batch); err != nil {
+			logging.Errorf(c.Request.Context(), "Failed to insert user %s: %v", userID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"msg": "Failed to store user"})
+			return
+		}
+
+		logging.Printf(c.Request.Context(), "Registered user with ID: %s", userID)
+		c.JSON(http.StatusCreated, gin.H{
+			"message":        "User registered successfully",
+			"user_id":        userID,
+			"user_confirmed": result.UserConfirmed,
+		})
+	}
+}
+
+// Confirm confirms the account with the code Cognito emailed
+func Confirm(s *Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req ConfirmRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"msg": err.Error()})
+			return
+		}
+
+		_, err := s.Cognito.Client.ConfirmSignUp(c.Request.Context(), &cognitoidentityprovider.ConfirmSignUpInput{
+			ClientId:         aws.String(s.Cognito.AppClientID),
+			SecretHash:       aws.String(s.Cognito.SecretHash(req.Email)),
+			Username:         aws.String(req.Email),
+			ConfirmationCode: aws.String(req.Code),
+		})
+		var (
+			codeMismatch *types.CodeMismatchException
+			expiredCode  *types.ExpiredCodeException
+			userNotFound *types.UserNotFoundException
+		)
+		if errors.As(err, &codeMismatch) || errors.As(err, &expiredCode) || errors.As(err, &userNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"msg": "Failed to confirm user account. Please check the code and try again."})
+			return
+		} else if err != nil {
+			logging.Errorf(c.Request.Context(), "Failed to confirm sign up for user '%s': %v", req.Email, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"msg": "Failed to confirm user account"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "User account confirmed successfully"})
+	}
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	sharedconfig "shared/config"
+	"shared/lockout"
+	"shared/session"
+	"shared/token"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
+)
+
+// Services are the clients and settings the handlers share
+type Services struct {
+	Cognito   *sharedconfig.Cognito
+	Cassandra *gocql.Session
+	Sessions  *session.Store
+	// Lockout counts failed logins in the auth Redis, shared with account-api
+	Lockout *lockout.Store
+	Tokens  token.Policy
+	Keys    *token.KeyRing
+	Issuer  *token.Issuer
+}
+
+// issueAccessToken generates a short-lived JWT for the session
+func (s *Services) issueAccessToken(sess *session.Session) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := s.Tokens.AccessExpiry(now, time.Unix(sess.ExpiresAt, 0))
+	jwtToken, err := s.Issuer.Issue(sess.UserID, sess.SessionID, now, expiresAt)
+	return jwtToken, expiresAt, err
+}
+
+// normalizeEmail is the form emails are looked up and counted in, as in account-api
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// formatSeconds renders a wait as whole seconds for a Retry-After header
+func formatSeconds(d time.Duration) string {
+	seconds := int(math.Ceil(d.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	return strconv.Itoa(seconds)
+}
+
+// WrapMiddleware adapts a net/http middleware from the shared module to Gin.
+// The request the middleware passes on, carrying whatever it added to the
+// context, replaces Gin's; if the middleware answers the request itself the
+// chain is aborted.
+func WrapMiddleware(middleware func(http.Handler) http.Handler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		passed := false
+		middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			passed = true
+			c.Request = r
+			c.Next()
+		})).ServeHTTP(c.Writer, c.Request)
+		if !passed {
+			c.Abort()
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"shared/auth"
+	"shared/session"
+	"shared/token"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+type contextKey string
+
+func TestWrapMiddleware(t *testing.T) {
+	passing := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey("user"), "user-1")))
+		})
+	}
+	rejecting := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		})
+	}
+
+	tests := []struct {
+		name       string
+		middleware func(http.Handler) http.Handler
+		wantStatus int
+		wantRun    bool
+	}{
+		{"passing", passing, http.StatusOK, true},
+		{"rejecting", rejecting, http.StatusUnauthorized, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ran := false
+			r := gin.New()
+			r.GET("/", WrapMiddleware(tt.middleware), func(c *gin.Context) {
+				ran = true
+				user, _ := c.Request.Context().Value(contextKey("user")).(string)
+				c.String(http.StatusOK, user)
+			})
+
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if ran != tt.wantRun {
+				t.Errorf("handler ran = %v, want %v", ran, tt.wantRun)
+			}
+			if tt.wantRun && rec.Body.String() != "user-1" {
+				t.Errorf("body = %q, want the middleware's context value", rec.Body)
+			}
+		})
+	}
+}
+
+func TestWrapMiddlewareAbortStopsChain(t *testing.T) {
+	rejecting := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		})
+	}
+	ran := false
+	r := gin.New()
+	r.Use(WrapMiddleware(rejecting))
+	r.GET("/", func(c *gin.Context) { ran = true })
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	if ran {
+		t.Error("handler ran after the middleware answered the request")
+	}
+}
+
+func TestLogoutRequiresAuth(t *testing.T) {
+	s, _ := newTestServices(t)
+	verifier := &token.Verifier{
+		Keyfunc:   s.Keys.Keyfunc,
+		Algorithm: jwt.SigningMethodRS256.Alg(),
+		Issuer:    s.Issuer.Issuer,
+		Audience:  s.Issuer.Audience,
+		ClockSkew: time.Minute,
+	}
+	router := newTestRouter(s, WrapMiddleware(auth.JWTMiddleware(verifier, s.Sessions)))
+	startSession(t, s, "session-1", "user-1")
+
+	if rec := post(router, "/v1/logout", "", nil); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("logout without a token: status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	if _, err := s.Sessions.Get(context.Background(), "session-1"); err != nil {
+		t.Fatalf("session revoked by an unauthenticated logout: %v", err)
+	}
+
+	now := time.Now()
+	accessToken, err := s.Issuer.Issue("user-1", "session-1", now, now.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	header := http.Header{"Authorization": {"Bearer " + accessToken}}
+	if rec := post(router, "/v1/logout", "", header); rec.Code != http.StatusOK {
+		t.Fatalf("logout status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	if _, err := s.Sessions.Get(context.Background(), "session-1"); err != session.ErrNotFound {
+		t.Errorf("Get after logout: err = %v, want ErrNotFound", err)
+	}
+
+	// The token's session is gone, so it no longer authenticates
+	if rec := post(router, "/v1/logout", "", header); rec.Code != http.StatusUnauthorized {
+		t.Errorf("logout with a revoked session: status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
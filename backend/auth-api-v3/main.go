@@ -3,50 +3,114 @@ package main
 import (
 	"context"
 	"log"
+	"net/http"
 	"os"
 
-	"account-api/handlers"
+	"auth-api/handlers"
+
+	"shared/auth"
+	sharedconfig "shared/config"
+	"shared/lockout"
+	"shared/logging"
+	"shared/session"
+	"shared/token"
 
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider"
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
 )
 
-type Config struct {
-	userPoolId    string
-	clientID      string
-	clientSecret  string
-	cognitoClient *cognitoidentityprovider.Client
-}
-
 func main() {
-	appConfig := Config{
-		userPoolId:   os.Getenv("COGNITO_USER_POOL_ID"),
-		clientID:     os.Getenv("COGNITO_CLIENT_ID"),
-		clientSecret: os.Getenv("COGNITO_CLIENT_SECRET"),
+	// Initialize structured, redacting logging
+	logging.Init("auth-api")
+	ctx := context.Background()
+
+	// Cognito settings, including AWS_REGION, come from the environment
+	cognito, err := sharedconfig.LoadCognito(ctx)
+	if err != nil {
+		log.Fatalf("Failed to initialize Cognito: %v", err)
+	}
+
+	// Tokens are issued and verified exactly like account-api's, so the other
+	// services accept them. JWT_PRIVATE_KEY must be account-api's key.
+	jwtConfig, err := sharedconfig.LoadJWT()
+	if err != nil {
+		log.Fatalf("Invalid JWT configuration: %v", err)
+	}
+	policy, err := token.LoadPolicy()
+	if err != nil {
+		log.Fatalf("Invalid token policy: %v", err)
+	}
+	keys, err := token.LoadKeyRing(os.Getenv("JWT_PRIVATE_KEY"), os.Getenv("JWT_RETIRED_PUBLIC_KEYS"), sharedconfig.DevMode())
+	if err != nil {
+		log.Fatalf("Failed to load JWT signing keys: %v", err)
 	}
-	// validating COGNITO env variables
-	if appConfig.userPoolId == "" || appConfig.clientID == "" || appConfig.clientSecret == "" {
-		log.Fatal("missing COGNITO env variables")
+
+	redisClient, err := sharedconfig.RedisFromEnv(ctx, "AUTH")
+	if err != nil {
+		log.Fatalf("Failed to connect to Redis: %v", err)
 	}
+	defer redisClient.Close()
 
-	cfg, err := config.LoadDefaultConfig(context.Background(),
-		config.WithRegion("ap-southeast-2"))
+	cassandra, err := sharedconfig.NewCassandraSession()
 	if err != nil {
-		log.Fatal(err)
+		log.Fatalf("Failed to connect to Cassandra: %v", err)
 	}
+	defer cassandra.Close()
 
-	appConfig.cognitoClient = cognitoidentityprovider.NewFromConfig(
-		cfg,
-	)
+	services := &handlers.Services{
+		Cognito:   cognito,
+		Cassandra: cassandra,
+		Sessions:  session.NewStore(redisClient, policy),
+		Lockout:   lockout.NewStore(redisClient),
+		Tokens:    policy,
+		Keys:      keys,
+		Issuer:    &token.Issuer{Keys: keys, Issuer: jwtConfig.Issuer, Audience: jwtConfig.Audience},
+	}
+	verifier := &token.Verifier{
+		Keyfunc:   keys.Keyfunc,
+		Algorithm: jwt.SigningMethodRS256.Alg(),
+		Issuer:    jwtConfig.Issuer,
+		Audience:  jwtConfig.Audience,
+		ClockSkew: jwtConfig.ClockSkew,
+	}
+	requireAuth := handlers.WrapMiddleware(auth.JWTMiddleware(verifier, services.Sessions))
 
-	r := gin.Default()
+	// Gin believes X-Forwarded-For from anyone unless told otherwise. Only the
+	// proxies in TRUSTED_PROXIES are, the same ones account-api trusts, so the
+	// per-IP login lockout cannot be dodged with a made-up header.
+	proxies, err := sharedconfig.TrustedProxiesFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid proxy configuration: %v", err)
+	}
+	trusted := make([]string, 0, len(proxies))
+	for _, network := range proxies {
+		trusted = append(trusted, network.String())
+	}
+
+	r := gin.New()
+	r.RemoteIPHeaders = []string{"X-Forwarded-For"}
+	if err := r.SetTrustedProxies(trusted); err != nil {
+		log.Fatalf("Invalid proxy configuration: %v", err)
+	}
+	r.Use(gin.Recovery())
+	r.GET("/.well-known/jwks.json", handlers.JWKS(services))
 
 	v1 := r.Group("/v1")
 	{
-		v1.POST("/login", handlers.Login)
-		v1.POST("/register", handlers.Register(appConfig.cognitoClient, appConfig.clientID))
+		v1.POST("/register", handlers.Register(services))
+		v1.POST("/confirm", handlers.Confirm(services))
+		v1.POST("/login", handlers.Login(services))
+		v1.POST("/refresh", handlers.Refresh(services))
+		v1.POST("/logout", requireAuth, handlers.Logout(services))
+		v1.POST("/logout/all", requireAuth, handlers.LogoutAll(services))
 	}
 
-	r.Run()
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080" // Default port
+	}
+	// The request logging middleware wraps the whole engine so it sees the
+	// status Gin writes
+	log.Printf("Server is listening on port %s...", port)
+	log.Fatal(http.ListenAndServe(":"+port, logging.Middleware(r)))
 }
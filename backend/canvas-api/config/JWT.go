@@ -3,15 +3,48 @@ package config
 import (
 	"log"
 	"os"
+
+	sharedconfig "shared/config"
+)
+
+// defaultJWKSURL is account-api's in-cluster JWKS endpoint
+const defaultJWKSURL = "http://account-api.backend.svc.cluster.local:8080/.well-known/jwks.json"
+
+// Verification modes for JWTVerificationMode
+const (
+	// VerificationFull checks the signature and looks the session up in Redis
+	VerificationFull = "full"
+	// VerificationStateless checks the signature and an in-memory list of
+	// revoked sessions kept in sync over Redis pub/sub
+	VerificationStateless = "stateless"
 )
 
 var (
-	JWTSecretKey string
+	// AccountAPIJWKSURL is where the public keys for access tokens are published
+	AccountAPIJWKSURL string
+	// JWTVerificationMode is how the auth middleware checks that a token's session is live
+	JWTVerificationMode string
+	// JWT holds the iss and aud claims tokens must carry and the allowed clock skew
+	JWT sharedconfig.JWT
 )
 
 func InitConfig() {
-	JWTSecretKey = os.Getenv("JWT_SECRET_KEY")
-	if JWTSecretKey == "" {
-		log.Fatal("JWT_SECRET_KEY is not set in the environment")
+	AccountAPIJWKSURL = sharedconfig.EnvOrDefault("ACCOUNT_API_JWKS_URL", defaultJWKSURL)
+	log.Printf("Verifying access tokens against %s", AccountAPIJWKSURL)
+
+	JWTVerificationMode = os.Getenv("JWT_VERIFICATION_MODE")
+	switch JWTVerificationMode {
+	case "":
+		JWTVerificationMode = VerificationFull
+	case VerificationFull, VerificationStateless:
+	default:
+		log.Fatalf("JWT_VERIFICATION_MODE must be %q or %q, got %q", VerificationFull, VerificationStateless, JWTVerificationMode)
+	}
+	log.Printf("JWT verification mode: %s", JWTVerificationMode)
+
+	var err error
+	JWT, err = sharedconfig.LoadJWT()
+	if err != nil {
+		log.Fatalf("Invalid JWT configuration: %v", err)
 	}
 }
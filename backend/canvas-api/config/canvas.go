@@ -0,0 +1,33 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// defaultTrashRetentionDays is how long deleted canvases stay restorable by default
+const defaultTrashRetentionDays = 30
+
+// TrashRetention returns how long a deleted canvas is kept in the trash before
+// it is purged, configured with CANVAS_TRASH_RETENTION_DAYS
+func TrashRetention() time.Duration {
+	days := defaultTrashRetentionDays
+	if value := os.Getenv("CANVAS_TRASH_RETENTION_DAYS"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			log.Printf("Invalid CANVAS_TRASH_RETENTION_DAYS %q, using %d days", value, defaultTrashRetentionDays)
+		} else {
+			days = parsed
+		}
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// BackfillIndexes reports whether the listing indexes should be rebuilt from
+// the canvases table at startup, set with CANVAS_BACKFILL_INDEXES=true
+func BackfillIndexes() bool {
+	enabled, _ := strconv.ParseBool(os.Getenv("CANVAS_BACKFILL_INDEXES"))
+	return enabled
+}
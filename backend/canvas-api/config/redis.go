@@ -4,29 +4,21 @@ import (
 	"context"
 	"github.com/go-redis/redis/v8"
 	"log"
+
+	sharedconfig "shared/config"
 )
 
 // RedisCtx is a shared context for Redis operations
 var RedisCtx = context.Background()
 
-// InitRedis initializes a new Redis client with provided configuration
-func InitRedis(redisHost, redisPort, redisPassword string) *redis.Client {
-	// Construct Redis address
-	redisAddr := redisHost + ":" + redisPort
-
-	// Create a Redis client
-	client := redis.NewClient(&redis.Options{
-		Addr:     redisAddr,
-		Password: redisPassword, // Add if necessary
-		DB:       0,             // Default DB
-	})
-
-	// Test Redis connection
-	_, err := client.Ping(RedisCtx).Result()
+// InitRedis connects to the Redis instance described by <prefix>_REDIS_HOST,
+// <prefix>_REDIS_PORT and <prefix>_REDIS_PASSWORD
+func InitRedis(prefix string) *redis.Client {
+	client, err := sharedconfig.RedisFromEnv(RedisCtx, prefix)
 	if err != nil {
-		log.Fatalf("Failed to connect to Redis at %s: %v", redisAddr, err)
+		log.Fatalf("Failed to connect to %s Redis: %v", prefix, err)
 	}
 
-	log.Printf("Connected to Redis at %s", redisAddr)
+	log.Printf("Connected to %s Redis", prefix)
 	return client
 }
@@ -0,0 +1,88 @@
+package excalidraw
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"canvas-api/models"
+
+	"github.com/gocql/gocql"
+)
+
+// ErrInvalidFile is returned when a document is not a .excalidraw file
+var ErrInvalidFile = errors.New("not an excalidraw file")
+
+// Export converts a canvas's current elements into an Excalidraw document.
+// Elements whose SVG has no Excalidraw equivalent are skipped and counted.
+func Export(canvasName string, elements []models.SVGData) (File, int) {
+	file := File{
+		Type:     FileType,
+		Version:  FileVersion,
+		Source:   Source,
+		Elements: make([]Element, 0, len(elements)),
+		AppState: AppState{
+			Name:                canvasName,
+			ViewBackgroundColor: "#ffffff",
+		},
+		Files: map[string]interface{}{},
+	}
+
+	skipped := 0
+	for _, data := range elements {
+		el, err := FromSVG(data.SVGID.String(), data.SVGContent)
+		if err != nil {
+			log.Printf("Skipping element %s during export: %v", data.SVGID, err)
+			skipped++
+			continue
+		}
+		el.Updated = data.CreatedAt.UnixMilli()
+		file.Elements = append(file.Elements, el)
+	}
+	return file, skipped
+}
+
+// Import converts an Excalidraw document into svg_data entries ready to be
+// stored on a new canvas. Deleted elements are dropped silently, as Excalidraw
+// itself does on load; unsupported elements are skipped and counted.
+func Import(file File, now time.Time) ([]models.SVGData, int) {
+	elements := make([]models.SVGData, 0, len(file.Elements))
+
+	skipped := 0
+	for _, el := range file.Elements {
+		if el.IsDeleted {
+			continue
+		}
+		content, err := ToSVG(el)
+		if err != nil {
+			log.Printf("Skipping element %s during import: %v", el.ID, err)
+			skipped++
+			continue
+		}
+		elements = append(elements, models.SVGData{
+			SVGID:      gocql.TimeUUID(),
+			SVGContent: content,
+			CreatedAt:  now,
+			Action:     models.ActionCreated,
+		})
+	}
+	return elements, skipped
+}
+
+// Decode reads and validates a .excalidraw document
+func Decode(r io.Reader) (File, error) {
+	var file File
+	if err := json.NewDecoder(r).Decode(&file); err != nil {
+		return File{}, fmt.Errorf("%w: %v", ErrInvalidFile, err)
+	}
+	if file.Type != FileType {
+		return File{}, fmt.Errorf("%w: unexpected type %q", ErrInvalidFile, file.Type)
+	}
+	if file.Version > FileVersion {
+		return File{}, fmt.Errorf("%w: unsupported version %d", ErrInvalidFile, file.Version)
+	}
+	return file, nil
+}
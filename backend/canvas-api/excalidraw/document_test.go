@@ -0,0 +1,222 @@
+package excalidraw
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"canvas-api/models"
+
+	"github.com/gocql/gocql"
+)
+
+var testNow = time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func decodeFile(t *testing.T, path string) File {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open %s: %v", path, err)
+	}
+	defer f.Close()
+	file, err := Decode(f)
+	if err != nil {
+		t.Fatalf("Decode %s: %v", path, err)
+	}
+	return file
+}
+
+// reencode writes the file out as JSON and reads it back, as a download
+// followed by an upload would
+func reencode(t *testing.T, file File) File {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(file); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	decoded, err := Decode(&buf)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	return decoded
+}
+
+// tolerance is how far coordinates may drift between exports. svg_content
+// is written with two decimals, so foreign markup with more precision loses
+// up to a hundredth on its first pass, doubled for widths derived from radii.
+const tolerance = 0.02
+
+// geometry pulls out an element's coordinates, for comparison with tolerance
+func geometry(el Element) []float64 {
+	values := []float64{el.X, el.Y, el.Width, el.Height, el.Angle}
+	for _, p := range el.Points {
+		values = append(values, p[0], p[1])
+	}
+	return values
+}
+
+// normalize clears what legitimately changes between exports, such as IDs and
+// the seeds derived from them, and the coordinates compared separately
+func normalize(el Element) Element {
+	el.ID, el.Seed, el.VersionNonce, el.Version, el.Updated = "", 0, 0, 0, 0
+	el.X, el.Y, el.Width, el.Height, el.Angle = 0, 0, 0, 0, 0
+	el.Points = nil
+	return el
+}
+
+func assertSameElements(t *testing.T, got, want []Element) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d elements, want %d", len(got), len(want))
+	}
+	for i := range want {
+		gotGeometry, wantGeometry := geometry(got[i]), geometry(want[i])
+		same := len(gotGeometry) == len(wantGeometry)
+		for j := 0; same && j < len(wantGeometry); j++ {
+			same = math.Abs(gotGeometry[j]-wantGeometry[j]) <= tolerance
+		}
+		if !same {
+			t.Errorf("element %d (%s) moved:\n got  %v\n want %v", i, want[i].Type, gotGeometry, wantGeometry)
+		}
+		if !reflect.DeepEqual(normalize(got[i]), normalize(want[i])) {
+			t.Errorf("element %d (%s) differs:\n got  %+v\n want %+v", i, want[i].Type, got[i], want[i])
+		}
+	}
+}
+
+func TestImportSample(t *testing.T) {
+	file := decodeFile(t, filepath.Join("testdata", "sample.excalidraw"))
+
+	elements, skipped := Import(file, testNow)
+	// The image is unsupported; the deleted rectangle is dropped without counting
+	if skipped != 1 {
+		t.Errorf("skipped = %d, want 1", skipped)
+	}
+	if len(elements) != 7 {
+		t.Fatalf("imported %d elements, want 7", len(elements))
+	}
+	for _, data := range elements {
+		if data.Action != models.ActionCreated || !data.CreatedAt.Equal(testNow) {
+			t.Errorf("element %s has action %q at %s", data.SVGID, data.Action, data.CreatedAt)
+		}
+	}
+}
+
+func TestExcalidrawRoundTrip(t *testing.T) {
+	original := decodeFile(t, filepath.Join("testdata", "sample.excalidraw"))
+
+	var supported []Element
+	for _, el := range original.Elements {
+		if !el.IsDeleted && el.Type != "image" {
+			supported = append(supported, el)
+		}
+	}
+
+	// Import the file, export the canvas, then do it again with the export
+	imported, _ := Import(original, testNow)
+	first, skipped := Export("Round trip", imported)
+	if skipped != 0 {
+		t.Fatalf("first export skipped %d elements", skipped)
+	}
+	reimported, skipped := Import(reencode(t, first), testNow)
+	if skipped != 0 {
+		t.Fatalf("re-import skipped %d elements", skipped)
+	}
+	second, skipped := Export("Round trip", reimported)
+	if skipped != 0 {
+		t.Fatalf("second export skipped %d elements", skipped)
+	}
+
+	if first.Type != FileType || first.Version != FileVersion || first.Source != Source {
+		t.Errorf("export header = %q v%d from %q", first.Type, first.Version, first.Source)
+	}
+	if first.AppState.Name != "Round trip" {
+		t.Errorf("export name = %q", first.AppState.Name)
+	}
+
+	t.Run("export matches the original", func(t *testing.T) {
+		assertSameElements(t, first.Elements, supported)
+	})
+	t.Run("second export matches the first", func(t *testing.T) {
+		assertSameElements(t, second.Elements, first.Elements)
+	})
+	t.Run("stored SVG is stable", func(t *testing.T) {
+		for i := range imported {
+			if imported[i].SVGContent != reimported[i].SVGContent {
+				t.Errorf("element %d changed on re-import:\n first  %s\n second %s",
+					i, imported[i].SVGContent, reimported[i].SVGContent)
+			}
+		}
+	})
+}
+
+func TestSVGRoundTrip(t *testing.T) {
+	tests := []struct {
+		file     string
+		wantType string
+	}{
+		{"rect.svg", TypeRectangle},
+		{"circle.svg", TypeEllipse},
+		{"line.svg", TypeLine},
+		{"polygon.svg", TypeLine},
+		{"arrow.svg", TypeArrow},
+		{"path.svg", TypeFreedraw},
+		{"text.svg", TypeText},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			content, err := os.ReadFile(filepath.Join("testdata", "svg", tt.file))
+			if err != nil {
+				t.Fatalf("read sample: %v", err)
+			}
+			canvas := []models.SVGData{{
+				SVGID:      gocql.TimeUUID(),
+				SVGContent: strings.TrimSpace(string(content)),
+				CreatedAt:  testNow,
+				Action:     models.ActionCreated,
+			}}
+
+			first, skipped := Export("Sample", canvas)
+			if skipped != 0 || len(first.Elements) != 1 {
+				t.Fatalf("export kept %d elements and skipped %d", len(first.Elements), skipped)
+			}
+			if got := first.Elements[0].Type; got != tt.wantType {
+				t.Fatalf("exported as %q, want %q", got, tt.wantType)
+			}
+
+			imported, skipped := Import(reencode(t, first), testNow)
+			if skipped != 0 || len(imported) != 1 {
+				t.Fatalf("import kept %d elements and skipped %d", len(imported), skipped)
+			}
+			second, _ := Export("Sample", imported)
+			assertSameElements(t, second.Elements, first.Elements)
+
+			// Once in our own format, another pass changes nothing
+			again, _ := Import(second, testNow)
+			if again[0].SVGContent != imported[0].SVGContent {
+				t.Errorf("SVG changed on the second pass:\n first  %s\n second %s",
+					imported[0].SVGContent, again[0].SVGContent)
+			}
+		})
+	}
+}
+
+func TestDecodeRejectsOtherFiles(t *testing.T) {
+	for name, body := range map[string]string{
+		"not JSON":      "<svg/>",
+		"wrong type":    `{"type":"excalidrawlib","version":2,"elements":[]}`,
+		"newer version": `{"type":"excalidraw","version":99,"elements":[]}`,
+	} {
+		if _, err := Decode(strings.NewReader(body)); !errors.Is(err, ErrInvalidFile) {
+			t.Errorf("%s: Decode returned %v, want ErrInvalidFile", name, err)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package excalidraw
+
+// FileType is the value of the "type" field in every .excalidraw file
+const FileType = "excalidraw"
+
+// FileVersion is the schema version we read and write
+const FileVersion = 2
+
+// Source identifies canvases exported by this service
+const Source = "canvis"
+
+// Element types understood by the importer and exporter
+const (
+	TypeRectangle = "rectangle"
+	TypeEllipse   = "ellipse"
+	TypeDiamond   = "diamond"
+	TypeLine      = "line"
+	TypeArrow     = "arrow"
+	TypeFreedraw  = "freedraw"
+	TypeText      = "text"
+)
+
+// File is the top level structure of a .excalidraw JSON document
+type File struct {
+	Type     string                 `json:"type"`
+	Version  int                    `json:"version"`
+	Source   string                 `json:"source"`
+	Elements []Element              `json:"elements"`
+	AppState AppState               `json:"appState"`
+	Files    map[string]interface{} `json:"files"`
+}
+
+// AppState holds the subset of editor state we carry across an export
+type AppState struct {
+	Name                string `json:"name,omitempty"`
+	ViewBackgroundColor string `json:"viewBackgroundColor"`
+}
+
+// Element is a single Excalidraw scene element. Type specific fields are
+// omitted when empty so Excalidraw fills in its own defaults on load.
+type Element struct {
+	ID              string   `json:"id"`
+	Type            string   `json:"type"`
+	X               float64  `json:"x"`
+	Y               float64  `json:"y"`
+	Width           float64  `json:"width"`
+	Height          float64  `json:"height"`
+	Angle           float64  `json:"angle"`
+	StrokeColor     string   `json:"strokeColor"`
+	BackgroundColor string   `json:"backgroundColor"`
+	FillStyle       string   `json:"fillStyle"`
+	StrokeWidth     float64  `json:"strokeWidth"`
+	StrokeStyle     string   `json:"strokeStyle"`
+	Roughness       int      `json:"roughness"`
+	Opacity         float64  `json:"opacity"`
+	GroupIDs        []string `json:"groupIds"`
+	Seed            int64    `json:"seed"`
+	Version         int      `json:"version"`
+	VersionNonce    int64    `json:"versionNonce"`
+	IsDeleted       bool     `json:"isDeleted"`
+	Updated         int64    `json:"updated,omitempty"`
+	Locked          bool     `json:"locked"`
+
+	// Linear elements (line, arrow) and freedraw
+	Points         [][2]float64 `json:"points,omitempty"`
+	StartArrowhead *string      `json:"startArrowhead,omitempty"`
+	EndArrowhead   *string      `json:"endArrowhead,omitempty"`
+
+	// Text elements
+	Text          string  `json:"text,omitempty"`
+	OriginalText  string  `json:"originalText,omitempty"`
+	FontSize      float64 `json:"fontSize,omitempty"`
+	FontFamily    int     `json:"fontFamily,omitempty"`
+	TextAlign     string  `json:"textAlign,omitempty"`
+	VerticalAlign string  `json:"verticalAlign,omitempty"`
+	LineHeight    float64 `json:"lineHeight,omitempty"`
+}
@@ -0,0 +1,674 @@
+package excalidraw
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Defaults applied when an SVG element carries no styling of its own
+const (
+	defaultStrokeColor = "#1e1e1e"
+	defaultFillStyle   = "solid"
+	defaultStrokeStyle = "solid"
+	defaultFontSize    = 20
+	defaultFontFamily  = 1
+	defaultLineHeight  = 1.25
+)
+
+// ErrUnsupportedElement is returned for elements with no mapping onto the other format
+var ErrUnsupportedElement = errors.New("unsupported element")
+
+var fontFamilies = map[int]string{
+	1: "Virgil",
+	2: "Helvetica",
+	3: "Cascadia",
+}
+
+// ToSVG renders an Excalidraw element as the SVG markup stored in svg_content.
+// Excalidraw specific properties without an SVG equivalent are kept as data-*
+// attributes so that FromSVG can restore them.
+func ToSVG(el Element) (string, error) {
+	var b strings.Builder
+
+	switch el.Type {
+	case TypeRectangle:
+		b.WriteString("<rect")
+		writeAttr(&b, "x", formatFloat(el.X))
+		writeAttr(&b, "y", formatFloat(el.Y))
+		writeAttr(&b, "width", formatFloat(el.Width))
+		writeAttr(&b, "height", formatFloat(el.Height))
+		writeStyle(&b, el)
+		b.WriteString("/>")
+
+	case TypeEllipse:
+		b.WriteString("<ellipse")
+		writeAttr(&b, "cx", formatFloat(el.X+el.Width/2))
+		writeAttr(&b, "cy", formatFloat(el.Y+el.Height/2))
+		writeAttr(&b, "rx", formatFloat(el.Width/2))
+		writeAttr(&b, "ry", formatFloat(el.Height/2))
+		writeStyle(&b, el)
+		b.WriteString("/>")
+
+	case TypeDiamond:
+		points := [][2]float64{
+			{el.X + el.Width/2, el.Y},
+			{el.X + el.Width, el.Y + el.Height/2},
+			{el.X + el.Width/2, el.Y + el.Height},
+			{el.X, el.Y + el.Height/2},
+		}
+		b.WriteString("<polygon")
+		writeAttr(&b, "points", formatPoints(points))
+		writeAttr(&b, "data-shape", TypeDiamond)
+		writeStyle(&b, el)
+		b.WriteString("/>")
+
+	case TypeLine, TypeArrow:
+		b.WriteString("<polyline")
+		writeAttr(&b, "points", formatPoints(absolutePoints(el)))
+		if el.Type == TypeArrow {
+			writeAttr(&b, "data-shape", TypeArrow)
+			if el.StartArrowhead != nil {
+				writeAttr(&b, "marker-start", "url(#arrowhead)")
+				writeAttr(&b, "data-start-arrowhead", *el.StartArrowhead)
+			}
+			if el.EndArrowhead != nil {
+				writeAttr(&b, "marker-end", "url(#arrowhead)")
+				writeAttr(&b, "data-end-arrowhead", *el.EndArrowhead)
+			}
+		}
+		writeStyle(&b, el)
+		b.WriteString("/>")
+
+	case TypeFreedraw:
+		b.WriteString("<path")
+		writeAttr(&b, "d", formatPath(absolutePoints(el)))
+		writeAttr(&b, "data-shape", TypeFreedraw)
+		writeAttr(&b, "stroke-linecap", "round")
+		writeAttr(&b, "stroke-linejoin", "round")
+		writeStyle(&b, el)
+		b.WriteString("/>")
+
+	case TypeText:
+		writeText(&b, el)
+
+	default:
+		return "", fmt.Errorf("%w: %q", ErrUnsupportedElement, el.Type)
+	}
+
+	return b.String(), nil
+}
+
+// FromSVG parses svg_content markup into an Excalidraw element with the given ID.
+// The markup may be a bare shape or a shape wrapped in <svg> or <g>.
+func FromSVG(id, content string) (Element, error) {
+	var root svgNode
+	if err := xml.Unmarshal([]byte(content), &root); err != nil {
+		return Element{}, fmt.Errorf("failed to parse SVG content: %w", err)
+	}
+
+	node := firstShape(&root)
+	if node == nil {
+		return Element{}, fmt.Errorf("%w: no drawable shape in SVG content", ErrUnsupportedElement)
+	}
+
+	el := newElement(id)
+	attrs := node.attrMap()
+	readStyle(&el, attrs)
+
+	switch node.XMLName.Local {
+	case "rect":
+		el.Type = TypeRectangle
+		el.X, el.Y = attrFloat(attrs, "x"), attrFloat(attrs, "y")
+		el.Width, el.Height = attrFloat(attrs, "width"), attrFloat(attrs, "height")
+
+	case "ellipse", "circle":
+		el.Type = TypeEllipse
+		rx, ry := attrFloat(attrs, "rx"), attrFloat(attrs, "ry")
+		if node.XMLName.Local == "circle" {
+			rx, ry = attrFloat(attrs, "r"), attrFloat(attrs, "r")
+		}
+		el.X, el.Y = attrFloat(attrs, "cx")-rx, attrFloat(attrs, "cy")-ry
+		el.Width, el.Height = rx*2, ry*2
+
+	case "polygon":
+		points, err := parsePoints(attrs["points"])
+		if err != nil {
+			return Element{}, err
+		}
+		if attrs["data-shape"] == TypeDiamond {
+			el.Type = TypeDiamond
+			el.X, el.Y, el.Width, el.Height = bounds(points)
+			break
+		}
+		// Any other polygon becomes a closed line
+		el.Type = TypeLine
+		setLinePoints(&el, append(points, points[0]))
+
+	case "polyline", "line":
+		var points [][2]float64
+		if node.XMLName.Local == "line" {
+			points = [][2]float64{
+				{attrFloat(attrs, "x1"), attrFloat(attrs, "y1")},
+				{attrFloat(attrs, "x2"), attrFloat(attrs, "y2")},
+			}
+		} else {
+			var err error
+			if points, err = parsePoints(attrs["points"]); err != nil {
+				return Element{}, err
+			}
+		}
+		el.Type = TypeLine
+		if attrs["data-shape"] == TypeArrow || attrs["marker-end"] != "" || attrs["marker-start"] != "" {
+			el.Type = TypeArrow
+			el.StartArrowhead = arrowhead(attrs, "marker-start", "data-start-arrowhead")
+			el.EndArrowhead = arrowhead(attrs, "marker-end", "data-end-arrowhead")
+		}
+		setLinePoints(&el, points)
+
+	case "path":
+		points, err := parsePath(attrs["d"])
+		if err != nil {
+			return Element{}, err
+		}
+		el.Type = TypeFreedraw
+		setLinePoints(&el, points)
+
+	case "text":
+		readText(&el, node, attrs)
+
+	default:
+		return Element{}, fmt.Errorf("%w: <%s>", ErrUnsupportedElement, node.XMLName.Local)
+	}
+
+	return el, nil
+}
+
+// newElement returns an element populated with Excalidraw's defaults
+func newElement(id string) Element {
+	seed := seedFor(id)
+	return Element{
+		ID:              id,
+		StrokeColor:     defaultStrokeColor,
+		BackgroundColor: "transparent",
+		FillStyle:       defaultFillStyle,
+		StrokeWidth:     1,
+		StrokeStyle:     defaultStrokeStyle,
+		Roughness:       1,
+		Opacity:         100,
+		GroupIDs:        []string{},
+		Seed:            seed,
+		Version:         1,
+		VersionNonce:    seed / 2,
+	}
+}
+
+// seedFor derives a stable rough.js seed from an element ID so repeated
+// exports of the same canvas render identically
+func seedFor(id string) int64 {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return int64(h.Sum32() & 0x7fffffff)
+}
+
+// svgNode is a generic XML element used to walk arbitrary SVG markup
+type svgNode struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Nodes   []svgNode  `xml:",any"`
+	Content string     `xml:",chardata"`
+}
+
+func (n *svgNode) attrMap() map[string]string {
+	attrs := make(map[string]string, len(n.Attrs))
+	for _, a := range n.Attrs {
+		attrs[a.Name.Local] = a.Value
+	}
+	// Inline CSS wins over presentation attributes, as it does in browsers
+	for _, decl := range strings.Split(attrs["style"], ";") {
+		if k, v, ok := strings.Cut(decl, ":"); ok {
+			attrs[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+	return attrs
+}
+
+// firstShape finds the first drawable element, descending through containers
+func firstShape(n *svgNode) *svgNode {
+	switch n.XMLName.Local {
+	case "svg", "g":
+		for i := range n.Nodes {
+			if shape := firstShape(&n.Nodes[i]); shape != nil {
+				return shape
+			}
+		}
+		return nil
+	case "defs", "marker", "title", "desc":
+		return nil
+	}
+	return n
+}
+
+func writeAttr(b *strings.Builder, name, value string) {
+	b.WriteString(" ")
+	b.WriteString(name)
+	b.WriteString(`="`)
+	xml.EscapeText(b, []byte(value))
+	b.WriteString(`"`)
+}
+
+// writeStyle writes the presentation attributes shared by every shape
+func writeStyle(b *strings.Builder, el Element) {
+	stroke := el.StrokeColor
+	if stroke == "" {
+		stroke = defaultStrokeColor
+	}
+	fill := el.BackgroundColor
+	// Excalidraw only fills a line when it is closed; arrows and strokes never
+	open := el.Type == TypeLine && !isClosed(el.Points)
+	if fill == "" || fill == "transparent" || open || el.Type == TypeArrow || el.Type == TypeFreedraw {
+		fill = "none"
+	}
+
+	writeAttr(b, "stroke", stroke)
+	writeAttr(b, "fill", fill)
+	writeAttr(b, "stroke-width", formatFloat(el.StrokeWidth))
+	if el.Opacity > 0 && el.Opacity < 100 {
+		writeAttr(b, "opacity", formatFloat(el.Opacity/100))
+	}
+	switch el.StrokeStyle {
+	case "dashed":
+		writeAttr(b, "stroke-dasharray", "8 8")
+	case "dotted":
+		writeAttr(b, "stroke-dasharray", "1.5 6")
+	}
+	if el.Angle != 0 {
+		cx, cy := el.X+el.Width/2, el.Y+el.Height/2
+		writeAttr(b, "transform", fmt.Sprintf("rotate(%s %s %s)",
+			strconv.FormatFloat(el.Angle*180/math.Pi, 'f', -1, 64), formatFloat(cx), formatFloat(cy)))
+	}
+	if el.FillStyle != "" {
+		writeAttr(b, "data-fill-style", el.FillStyle)
+	}
+	if el.StrokeStyle != "" {
+		writeAttr(b, "data-stroke-style", el.StrokeStyle)
+	}
+	writeAttr(b, "data-roughness", strconv.Itoa(el.Roughness))
+}
+
+// readStyle is the inverse of writeStyle
+func readStyle(el *Element, attrs map[string]string) {
+	if v := attrs["stroke"]; v != "" && v != "none" {
+		el.StrokeColor = v
+	}
+	if v := attrs["fill"]; v != "" && v != "none" {
+		el.BackgroundColor = v
+	}
+	if v, ok := parseFloat(attrs["stroke-width"]); ok {
+		el.StrokeWidth = v
+	}
+	if v, ok := parseFloat(attrs["opacity"]); ok {
+		el.Opacity = math.Round(v * 100)
+	}
+	if v := attrs["data-fill-style"]; v != "" {
+		el.FillStyle = v
+	}
+	switch {
+	case attrs["data-stroke-style"] != "":
+		el.StrokeStyle = attrs["data-stroke-style"]
+	case strings.HasPrefix(attrs["stroke-dasharray"], "8"):
+		el.StrokeStyle = "dashed"
+	case attrs["stroke-dasharray"] != "" && attrs["stroke-dasharray"] != "none":
+		el.StrokeStyle = "dotted"
+	}
+	if v, err := strconv.Atoi(attrs["data-roughness"]); err == nil {
+		el.Roughness = v
+	}
+	if t := attrs["transform"]; strings.HasPrefix(t, "rotate(") {
+		fields := strings.FieldsFunc(strings.TrimSuffix(strings.TrimPrefix(t, "rotate("), ")"), isSeparator)
+		if len(fields) > 0 {
+			if deg, ok := parseFloat(fields[0]); ok {
+				el.Angle = deg * math.Pi / 180
+			}
+		}
+	}
+}
+
+// writeText renders a text element, one tspan per line. The x attribute is
+// the anchor point implied by the alignment, as SVG expects.
+func writeText(b *strings.Builder, el Element) {
+	fontSize := el.FontSize
+	if fontSize == 0 {
+		fontSize = defaultFontSize
+	}
+	lineHeight := el.LineHeight
+	if lineHeight == 0 {
+		lineHeight = defaultLineHeight
+	}
+	family, ok := fontFamilies[el.FontFamily]
+	if !ok {
+		family = fontFamilies[defaultFontFamily]
+	}
+
+	anchor, x := "start", el.X
+	switch el.TextAlign {
+	case "center":
+		anchor, x = "middle", el.X+el.Width/2
+	case "right":
+		anchor, x = "end", el.X+el.Width
+	}
+
+	b.WriteString("<text")
+	writeAttr(b, "x", formatFloat(x))
+	writeAttr(b, "y", formatFloat(el.Y))
+	writeAttr(b, "font-size", formatFloat(fontSize))
+	writeAttr(b, "font-family", family)
+	writeAttr(b, "text-anchor", anchor)
+	writeAttr(b, "dominant-baseline", "text-before-edge")
+	writeAttr(b, "data-width", formatFloat(el.Width))
+	writeAttr(b, "data-height", formatFloat(el.Height))
+	if el.VerticalAlign != "" {
+		writeAttr(b, "data-vertical-align", el.VerticalAlign)
+	}
+	writeAttr(b, "data-line-height", formatFloat(lineHeight))
+	// Text is filled with its stroke color rather than outlined
+	textEl := el
+	textEl.BackgroundColor = el.StrokeColor
+	textEl.StrokeWidth = 0
+	writeStyle(b, textEl)
+	b.WriteString(">")
+
+	for i, line := range strings.Split(el.Text, "\n") {
+		b.WriteString("<tspan")
+		writeAttr(b, "x", formatFloat(x))
+		if i > 0 {
+			writeAttr(b, "dy", formatFloat(fontSize*lineHeight))
+		}
+		b.WriteString(">")
+		xml.EscapeText(b, []byte(line))
+		b.WriteString("</tspan>")
+	}
+	b.WriteString("</text>")
+}
+
+// readText is the inverse of writeText
+func readText(el *Element, node *svgNode, attrs map[string]string) {
+	el.Type = TypeText
+	el.BackgroundColor = "transparent"
+	el.StrokeWidth = 1
+	if v := attrs["fill"]; v != "" && v != "none" {
+		el.StrokeColor = v
+	}
+
+	var lines []string
+	for _, child := range node.Nodes {
+		if child.XMLName.Local == "tspan" {
+			lines = append(lines, child.Content)
+		}
+	}
+	if len(lines) == 0 {
+		lines = []string{strings.TrimSpace(node.Content)}
+	}
+	el.Text = strings.Join(lines, "\n")
+	el.OriginalText = el.Text
+
+	el.FontSize = defaultFontSize
+	if v, ok := parseFloat(attrs["font-size"]); ok {
+		el.FontSize = v
+	}
+	el.FontFamily = defaultFontFamily
+	for id, name := range fontFamilies {
+		if strings.Contains(attrs["font-family"], name) {
+			el.FontFamily = id
+		}
+	}
+	el.LineHeight = defaultLineHeight
+	if v, ok := parseFloat(attrs["data-line-height"]); ok {
+		el.LineHeight = v
+	}
+	el.VerticalAlign = "top"
+	if v := attrs["data-vertical-align"]; v != "" {
+		el.VerticalAlign = v
+	}
+
+	el.Width, _ = parseFloat(attrs["data-width"])
+	el.Height, _ = parseFloat(attrs["data-height"])
+	if el.Height == 0 {
+		el.Height = el.FontSize * el.LineHeight * float64(len(lines))
+	}
+
+	x := attrFloat(attrs, "x")
+	el.Y = attrFloat(attrs, "y")
+	el.TextAlign = "left"
+	switch attrs["text-anchor"] {
+	case "middle":
+		el.TextAlign, x = "center", x-el.Width/2
+	case "end":
+		el.TextAlign, x = "right", x-el.Width
+	}
+	el.X = x
+}
+
+// arrowhead restores the arrowhead kind for one end of an arrow
+func arrowhead(attrs map[string]string, marker, data string) *string {
+	if v := attrs[data]; v != "" {
+		return &v
+	}
+	if attrs[marker] != "" {
+		v := "arrow"
+		return &v
+	}
+	return nil
+}
+
+// absolutePoints converts an element's relative points to canvas coordinates
+func absolutePoints(el Element) [][2]float64 {
+	points := make([][2]float64, len(el.Points))
+	for i, p := range el.Points {
+		points[i] = [2]float64{el.X + p[0], el.Y + p[1]}
+	}
+	return points
+}
+
+// setLinePoints stores absolute points on a linear element, relative to the
+// first point as Excalidraw expects
+func setLinePoints(el *Element, points [][2]float64) {
+	if len(points) == 0 {
+		return
+	}
+	el.X, el.Y = points[0][0], points[0][1]
+	el.Points = make([][2]float64, len(points))
+	for i, p := range points {
+		el.Points[i] = [2]float64{p[0] - el.X, p[1] - el.Y}
+	}
+	_, _, el.Width, el.Height = bounds(points)
+}
+
+// isClosed reports whether a line ends where it starts, making it a polygon
+func isClosed(points [][2]float64) bool {
+	return len(points) > 2 && points[0] == points[len(points)-1]
+}
+
+// bounds returns the bounding box of a set of points
+func bounds(points [][2]float64) (x, y, width, height float64) {
+	if len(points) == 0 {
+		return 0, 0, 0, 0
+	}
+	minX, minY := points[0][0], points[0][1]
+	maxX, maxY := minX, minY
+	for _, p := range points[1:] {
+		minX, maxX = math.Min(minX, p[0]), math.Max(maxX, p[0])
+		minY, maxY = math.Min(minY, p[1]), math.Max(maxY, p[1])
+	}
+	return minX, minY, maxX - minX, maxY - minY
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64)
+}
+
+func formatPoints(points [][2]float64) string {
+	parts := make([]string, len(points))
+	for i, p := range points {
+		parts[i] = formatFloat(p[0]) + "," + formatFloat(p[1])
+	}
+	return strings.Join(parts, " ")
+}
+
+func formatPath(points [][2]float64) string {
+	var b strings.Builder
+	for i, p := range points {
+		if i == 0 {
+			b.WriteString("M")
+		} else {
+			b.WriteString(" L")
+		}
+		b.WriteString(formatFloat(p[0]) + " " + formatFloat(p[1]))
+	}
+	return b.String()
+}
+
+func isSeparator(r rune) bool {
+	return r == ',' || r == ' ' || r == '\t' || r == '\n'
+}
+
+func parseFloat(s string) (float64, bool) {
+	v, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(s), "px"), 64)
+	return v, err == nil
+}
+
+func attrFloat(attrs map[string]string, name string) float64 {
+	v, _ := parseFloat(attrs[name])
+	return v
+}
+
+// parsePoints parses a points attribute ("x1,y1 x2,y2 ...")
+func parsePoints(s string) ([][2]float64, error) {
+	fields := strings.FieldsFunc(s, isSeparator)
+	if len(fields) < 4 || len(fields)%2 != 0 {
+		return nil, fmt.Errorf("invalid points attribute %q", s)
+	}
+	points := make([][2]float64, 0, len(fields)/2)
+	for i := 0; i < len(fields); i += 2 {
+		x, okX := parseFloat(fields[i])
+		y, okY := parseFloat(fields[i+1])
+		if !okX || !okY {
+			return nil, fmt.Errorf("invalid points attribute %q", s)
+		}
+		points = append(points, [2]float64{x, y})
+	}
+	return points, nil
+}
+
+// parsePath flattens path data into the points it passes through. Curves are
+// reduced to their end points, which is enough to keep a freedraw stroke's shape.
+func parsePath(d string) ([][2]float64, error) {
+	var points [][2]float64
+	var cur, start [2]float64
+	var cmd byte
+
+	tokens := tokenizePath(d)
+	for i := 0; i < len(tokens); {
+		if c := tokens[i]; len(c) == 1 && strings.Contains("MmLlHhVvCcSsQqTtZz", c) {
+			cmd = c[0]
+			i++
+			if cmd == 'Z' || cmd == 'z' {
+				cur = start
+				points = append(points, cur)
+				continue
+			}
+		}
+		if cmd == 0 {
+			return nil, fmt.Errorf("invalid path data %q", d)
+		}
+
+		n := map[byte]int{'M': 2, 'L': 2, 'H': 1, 'V': 1, 'C': 6, 'S': 4, 'Q': 4, 'T': 2}[upper(cmd)]
+		if n == 0 || i+n > len(tokens) {
+			return nil, fmt.Errorf("invalid path data %q", d)
+		}
+		args := make([]float64, n)
+		for j := range args {
+			v, ok := parseFloat(tokens[i+j])
+			if !ok {
+				return nil, fmt.Errorf("invalid path data %q", d)
+			}
+			args[j] = v
+		}
+		i += n
+
+		relative := cmd >= 'a'
+		next := cur
+		switch upper(cmd) {
+		case 'H':
+			next[0] = args[0]
+			if relative {
+				next[0] += cur[0]
+			}
+		case 'V':
+			next[1] = args[0]
+			if relative {
+				next[1] += cur[1]
+			}
+		default:
+			next = [2]float64{args[n-2], args[n-1]}
+			if relative {
+				next[0] += cur[0]
+				next[1] += cur[1]
+			}
+		}
+		cur = next
+		points = append(points, cur)
+
+		switch cmd {
+		case 'M', 'm':
+			start = cur
+			// Coordinates following a moveto are implicit linetos
+			cmd = map[byte]byte{'M': 'L', 'm': 'l'}[cmd]
+		}
+	}
+
+	if len(points) == 0 {
+		return nil, fmt.Errorf("invalid path data %q", d)
+	}
+	return points, nil
+}
+
+func upper(c byte) byte {
+	if c >= 'a' && c <= 'z' {
+		return c - ('a' - 'A')
+	}
+	return c
+}
+
+// tokenizePath splits path data into command letters and numbers
+func tokenizePath(d string) []string {
+	var tokens []string
+	var num strings.Builder
+	flush := func() {
+		if num.Len() > 0 {
+			tokens = append(tokens, num.String())
+			num.Reset()
+		}
+	}
+	for i := 0; i < len(d); i++ {
+		c := d[i]
+		switch {
+		case (c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z') && c != 'e' && c != 'E':
+			flush()
+			tokens = append(tokens, string(c))
+		case c == '-' && num.Len() > 0 && !strings.HasSuffix(num.String(), "e"):
+			flush()
+			num.WriteByte(c)
+		case c == ',' || c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			flush()
+		default:
+			num.WriteByte(c)
+		}
+	}
+	flush()
+	return tokens
+}
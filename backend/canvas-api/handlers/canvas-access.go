@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gocql/gocql"
+)
+
+// Access levels a user can hold on a canvas
+const (
+	RoleOwner  = "owner"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+)
+
+// errCanvasNotFound is returned when a canvas doesn't exist or the user has no access to it
+var errCanvasNotFound = errors.New("canvas not found")
+
+// resolveCanvasAccess works out whose partition a canvas lives in and what
+// access the user has to it. Canvases the user owns are found in their own
+// partition; anything else must have been shared with them.
+func resolveCanvasAccess(session *gocql.Session, userID string, canvasID gocql.UUID) (ownerID, role string, err error) {
+	var id gocql.UUID
+	err = session.Query(
+		`SELECT canvas_id FROM canvases WHERE user_id = ? AND canvas_id = ?`,
+		userID, canvasID,
+	).Consistency(gocql.One).Scan(&id)
+	if err == nil {
+		return userID, RoleOwner, nil
+	} else if err != gocql.ErrNotFound {
+		return "", "", err
+	}
+
+	err = session.Query(
+		`SELECT owner_id, role FROM canvas_shares WHERE user_id = ? AND canvas_id = ?`,
+		userID, canvasID,
+	).Consistency(gocql.One).Scan(&ownerID, &role)
+	if err == gocql.ErrNotFound {
+		return "", "", errCanvasNotFound
+	} else if err != nil {
+		return "", "", err
+	}
+	return ownerID, role, nil
+}
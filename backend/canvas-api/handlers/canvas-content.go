@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"canvas-api/models"
+)
+
+// currentElements replays a canvas's svg_data history and returns the latest
+// version of every element that has not been deleted, in first-drawn order.
+func currentElements(history []models.SVGData) []models.SVGData {
+	latest := make(map[string]int)
+	var elements []models.SVGData
+
+	for _, data := range history {
+		id := data.SVGID.String()
+		idx, seen := latest[id]
+
+		switch {
+		case data.Action == models.ActionDeleted:
+			if seen {
+				elements[idx].Action = models.ActionDeleted
+			}
+		case seen:
+			elements[idx] = data
+		default:
+			latest[id] = len(elements)
+			elements = append(elements, data)
+		}
+	}
+
+	current := make([]models.SVGData, 0, len(elements))
+	for _, data := range elements {
+		if data.Action != models.ActionDeleted {
+			current = append(current, data)
+		}
+	}
+	return current
+}
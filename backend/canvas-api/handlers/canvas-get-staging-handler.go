@@ -1,11 +1,12 @@
 package handlers
 
 import (
+	"shared/logging"
+
 	"context"
 	"encoding/json"
 	"github.com/go-redis/redis/v8"
 	"github.com/gorilla/mux"
-	"log"
 	"net/http"
 )
 
@@ -31,7 +32,7 @@ func GetStagedCanvas(redisClient *redis.Client) http.HandlerFunc {
 			} else {
 				http.Error(w, "Error retrieving canvas metadata", http.StatusInternalServerError)
 			}
-			log.Printf("Error retrieving canvas metadata from Redis: %v", err)
+			logging.Printf(r.Context(), "Error retrieving canvas metadata from Redis: %v", err)
 			return
 		}
 
@@ -44,7 +45,7 @@ func GetStagedCanvas(redisClient *redis.Client) http.HandlerFunc {
 			} else {
 				http.Error(w, "Error retrieving SVG data", http.StatusInternalServerError)
 			}
-			log.Printf("Error retrieving SVG data from Redis: %v", err)
+			logging.Printf(r.Context(), "Error retrieving SVG data from Redis: %v", err)
 			return
 		}
 
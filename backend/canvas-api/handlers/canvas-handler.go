@@ -1,60 +1,453 @@
 package handlers
 
 import (
-	"canvas-api/auth"
+	"encoding/base64"
 	"encoding/json" // This enables JSON encoding/decoding
+	"errors"
 	"github.com/gocql/gocql"
-	"log"
 	"net/http"
+	"shared/auth"
+	"shared/logging"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// Listing limits
+const (
+	defaultPageSize = 25
+	maxPageSize     = 100
+	// maxScannedRows bounds how many rows one request reads while filtering by name
+	maxScannedRows = 1000
+)
+
 // Canvas struct represents the canvas structure
 type Canvas struct {
 	CanvasID   gocql.UUID `json:"canvas_id"`
 	CanvasName string     `json:"canvas_name"`
 	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  *time.Time `json:"updated_at,omitempty"`
+	OwnerID    string     `json:"owner_id"`
+	Role       string     `json:"role,omitempty"`
+	Starred    bool       `json:"starred"`
+	DeletedAt  *time.Time `json:"deleted_at,omitempty"`
+}
+
+// CanvasPage is one page of a canvas listing
+type CanvasPage struct {
+	Canvases   []Canvas `json:"canvases"`
+	NextCursor string   `json:"next_cursor,omitempty"`
+}
+
+// listOptions are the query parameters of a canvas listing
+type listOptions struct {
+	Sort   string `json:"s"`
+	Order  string `json:"o"`
+	Filter string `json:"f"`
+	Search string `json:"q"`
+}
+
+// listCursor is the opaque next_cursor: the options it was issued for plus the Cassandra paging state
+type listCursor struct {
+	listOptions
+	PageState []byte `json:"p"`
+}
+
+var errCursorMismatch = errors.New("cursor does not match query")
+
+func encodeCursor(opts listOptions, pageState []byte) string {
+	if len(pageState) == 0 {
+		return ""
+	}
+	raw, _ := json.Marshal(listCursor{listOptions: opts, PageState: pageState})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(cursor string, opts listOptions) ([]byte, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+	var c listCursor
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return nil, err
+	}
+	if c.listOptions != opts {
+		return nil, errCursorMismatch
+	}
+	return c.PageState, nil
+}
+
+// parseListOptions reads and validates the listing query parameters
+func parseListOptions(r *http.Request) (listOptions, int, error) {
+	query := r.URL.Query()
+	opts := listOptions{
+		Sort:   query.Get("sort"),
+		Order:  query.Get("order"),
+		Filter: query.Get("filter"),
+		Search: strings.ToLower(strings.TrimSpace(query.Get("q"))),
+	}
+	if opts.Sort == "" {
+		opts.Sort = "created"
+	}
+	if opts.Filter == "" {
+		opts.Filter = "owned"
+	}
+	if opts.Order == "" {
+		opts.Order = "desc"
+		if opts.Sort == "name" {
+			opts.Order = "asc"
+		}
+	}
+
+	switch {
+	case opts.Sort != "created" && opts.Sort != "updated" && opts.Sort != "name":
+		return opts, 0, errors.New("sort must be created, updated or name")
+	case opts.Order != "asc" && opts.Order != "desc":
+		return opts, 0, errors.New("order must be asc or desc")
+	case opts.Filter != "owned" && opts.Filter != "shared" && opts.Filter != "starred" && opts.Filter != "trashed":
+		return opts, 0, errors.New("filter must be owned, shared, starred or trashed")
+	case opts.Filter != "owned" && opts.Sort != "created":
+		return opts, 0, errors.New("only owned canvases can be sorted by updated or name")
+	}
+
+	limit := defaultPageSize
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxPageSize {
+			return opts, 0, errors.New("limit must be between 1 and 100")
+		}
+		limit = parsed
+	}
+	return opts, limit, nil
+}
+
+// pagedScan reads successive Cassandra pages until limit matches have been
+// collected, the results run out or maxScannedRows is reached. scan consumes
+// one page and reports how many rows matched. The returned paging state
+// resumes after the last page read, so no rows are skipped between requests.
+func pagedScan(newQuery func() *gocql.Query, limit int, pageState []byte, scan func(*gocql.Iter) int) ([]byte, error) {
+	found, scanned := 0, 0
+	for {
+		iter := newQuery().PageSize(limit - found).PageState(pageState).Iter()
+		scanned += iter.NumRows()
+		found += scan(iter)
+		pageState = iter.PageState()
+		if err := iter.Close(); err != nil {
+			return nil, err
+		}
+		if len(pageState) == 0 || found >= limit || scanned >= maxScannedRows {
+			return pageState, nil
+		}
+	}
+}
+
+// matchesSearch reports whether a canvas name matches the lower cased search term
+func matchesSearch(name, search string) bool {
+	return search == "" || strings.Contains(strings.ToLower(name), search)
 }
 
-// GetCanvasesByUserID fetches all canvases for the authenticated user
+// GetCanvasesByUserID returns a page of the authenticated user's canvases.
+// Query parameters:
+//   - sort: created (default), updated or name
+//   - order: asc or desc
+//   - filter: owned (default), shared, starred or trashed
+//   - q: case-insensitive name search
+//   - limit: page size, up to 100
+//   - cursor: the next_cursor from the previous page
 func GetCanvasesByUserID(session *gocql.Session) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Extract userID from context (set by JWT middleware)
 		userID, ok := auth.UserIDFromContext(r.Context())
 		if !ok {
 			http.Error(w, "User ID not found in context", http.StatusUnauthorized)
-			log.Println("User ID not found in context")
+			logging.Printf(r.Context(), "User ID not found in context")
 			return
 		}
 
-		// Log the user ID for debugging
-		log.Printf("Fetching canvases for user ID: %s", userID)
+		opts, limit, err := parseListOptions(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		pageState, err := decodeCursor(r.URL.Query().Get("cursor"), opts)
+		if err != nil {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
 
-		// Query the database for canvases belonging to the user
 		var canvases []Canvas
-		iter := session.Query(
-			`SELECT canvas_id, canvas_name, created_at FROM canvases WHERE user_id = ?`,
-			userID,
-		).Iter()
-
-		// Fetch the canvases
-		var canvas Canvas
-		for iter.Scan(&canvas.CanvasID, &canvas.CanvasName, &canvas.CreatedAt) {
-			canvases = append(canvases, canvas)
+		switch opts.Filter {
+		case "owned":
+			canvases, pageState, err = listOwnedCanvases(session, userID, opts, limit, pageState)
+		case "shared":
+			canvases, pageState, err = listLinkedCanvases(session, userID, "canvas_shares", opts, limit, pageState)
+		case "starred":
+			canvases, pageState, err = listLinkedCanvases(session, userID, "canvas_stars", opts, limit, pageState)
+		case "trashed":
+			canvases, pageState, err = listTrashedCanvases(session, userID, opts, limit, pageState)
 		}
-
-		// Handle potential query errors
-		if err := iter.Close(); err != nil {
+		if err != nil {
 			http.Error(w, "Failed to fetch canvases", http.StatusInternalServerError)
-			log.Printf("Error fetching canvases for user %s: %v", userID, err)
+			logging.Errorf(r.Context(), "Error fetching canvases for user %s: %v", userID, err)
 			return
 		}
 
-		// Respond with the list of canvases
+		if opts.Filter != "starred" {
+			if err := markStarred(session, userID, canvases); err != nil {
+				logging.Printf(r.Context(), "Error fetching starred canvases for user %s: %v", userID, err)
+			}
+		}
+
+		page := CanvasPage{Canvases: canvases, NextCursor: encodeCursor(opts, pageState)}
+		if page.Canvases == nil {
+			page.Canvases = []Canvas{}
+		}
+
+		// Respond with the page of canvases
 		w.Header().Set("Content-Type", "application/json")
-		if err := json.NewEncoder(w).Encode(canvases); err != nil {
+		if err := json.NewEncoder(w).Encode(page); err != nil {
 			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
-			log.Printf("Error encoding response for user %s: %v", userID, err)
+			logging.Errorf(r.Context(), "Error encoding response for user %s: %v", userID, err)
 		}
 	}
 }
+
+// listOwnedCanvases pages through the user's partition of canvases, or one of
+// its listing indexes when sorting by name or last update
+func listOwnedCanvases(session *gocql.Session, userID string, opts listOptions, limit int, pageState []byte) ([]Canvas, []byte, error) {
+	direction := strings.ToUpper(opts.Order)
+
+	var stmt string
+	switch opts.Sort {
+	case "created":
+		stmt = `SELECT canvas_id, canvas_name, created_at, updated_at FROM canvases
+			WHERE user_id = ? ORDER BY canvas_id ` + direction
+	case "name":
+		stmt = `SELECT canvas_id, canvas_name, created_at, updated_at FROM canvases_by_name
+			WHERE user_id = ? ORDER BY name_key ` + direction
+	case "updated":
+		stmt = `SELECT canvas_id, canvas_name, created_at, updated_at FROM canvases_by_updated
+			WHERE user_id = ? ORDER BY updated_at ` + direction
+	}
+
+	var canvases []Canvas
+	pageState, err := pagedScan(
+		func() *gocql.Query { return session.Query(stmt, userID) },
+		limit, pageState,
+		func(iter *gocql.Iter) int {
+			matched := 0
+			var canvas Canvas
+			var updatedAt time.Time
+			for iter.Scan(&canvas.CanvasID, &canvas.CanvasName, &canvas.CreatedAt, &updatedAt) {
+				if !matchesSearch(canvas.CanvasName, opts.Search) {
+					continue
+				}
+				canvas.OwnerID, canvas.Role, canvas.UpdatedAt = userID, RoleOwner, timePtr(updatedAt)
+				canvases = append(canvases, canvas)
+				matched++
+			}
+			return matched
+		},
+	)
+	return canvases, pageState, err
+}
+
+// listLinkedCanvases pages through a per-user table of canvases that live in
+// other partitions (canvas_shares or canvas_stars) and loads each page of
+// canvases with a single query. Links to canvases that have since been
+// deleted, or starred canvases no longer shared with the user, are skipped.
+func listLinkedCanvases(session *gocql.Session, userID, table string, opts listOptions, limit int, pageState []byte) ([]Canvas, []byte, error) {
+	// Only shares record a role; for stars it is looked up separately
+	withRole := table == "canvas_shares"
+	columns := "canvas_id, owner_id"
+	if withRole {
+		columns += ", role"
+	}
+	stmt := `SELECT ` + columns + ` FROM ` + table + ` WHERE user_id = ? ORDER BY canvas_id ` + strings.ToUpper(opts.Order)
+
+	var canvases []Canvas
+	var lookupErr error
+	pageState, err := pagedScan(
+		func() *gocql.Query { return session.Query(stmt, userID) },
+		limit, pageState,
+		func(iter *gocql.Iter) int {
+			var links []Canvas
+			var canvasID gocql.UUID
+			var ownerID, role string
+			dest := []interface{}{&canvasID, &ownerID}
+			if withRole {
+				dest = append(dest, &role)
+			}
+			for iter.Scan(dest...) {
+				links = append(links, Canvas{CanvasID: canvasID, OwnerID: ownerID, Role: role})
+			}
+
+			linked, err := loadLinkedCanvases(session, userID, links, withRole)
+			if err != nil {
+				lookupErr = err
+				return 0
+			}
+			matched := 0
+			for _, canvas := range linked {
+				if !matchesSearch(canvas.CanvasName, opts.Search) {
+					continue
+				}
+				canvas.Starred = table == "canvas_stars"
+				canvases = append(canvases, canvas)
+				matched++
+			}
+			return matched
+		},
+	)
+	if err == nil {
+		err = lookupErr
+	}
+	return canvases, pageState, err
+}
+
+// loadLinkedCanvases fills in the listing fields of linked canvases, keeping
+// the order of the links. The canvases are read with one query across their
+// owners' partitions; without a role on the links, the user's roles come from
+// a second query over their shares.
+func loadLinkedCanvases(session *gocql.Session, userID string, links []Canvas, withRole bool) ([]Canvas, error) {
+	if len(links) == 0 {
+		return nil, nil
+	}
+
+	type canvasKey struct {
+		ownerID  string
+		canvasID gocql.UUID
+	}
+	var ownerIDs []string
+	seenOwners := make(map[string]bool)
+	canvasIDs := make([]gocql.UUID, len(links))
+	for i, link := range links {
+		if !seenOwners[link.OwnerID] {
+			seenOwners[link.OwnerID] = true
+			ownerIDs = append(ownerIDs, link.OwnerID)
+		}
+		canvasIDs[i] = link.CanvasID
+	}
+
+	// The IN over both key columns can also return canvases of one owner that
+	// were linked under another; only exact matches are kept below
+	found := make(map[canvasKey]Canvas)
+	iter := session.Query(
+		`SELECT user_id, canvas_id, canvas_name, created_at, updated_at FROM canvases
+		WHERE user_id IN ? AND canvas_id IN ?`,
+		ownerIDs, canvasIDs,
+	).Iter()
+	var canvas Canvas
+	var updatedAt time.Time
+	for iter.Scan(&canvas.OwnerID, &canvas.CanvasID, &canvas.CanvasName, &canvas.CreatedAt, &updatedAt) {
+		canvas.UpdatedAt = timePtr(updatedAt)
+		found[canvasKey{canvas.OwnerID, canvas.CanvasID}] = canvas
+		canvas = Canvas{}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+
+	sharedRoles := make(map[gocql.UUID]string)
+	if !withRole {
+		iter := session.Query(
+			`SELECT canvas_id, role FROM canvas_shares WHERE user_id = ? AND canvas_id IN ?`,
+			userID, canvasIDs,
+		).Iter()
+		var canvasID gocql.UUID
+		var role string
+		for iter.Scan(&canvasID, &role) {
+			sharedRoles[canvasID] = role
+		}
+		if err := iter.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	var canvases []Canvas
+	for _, link := range links {
+		canvas, ok := found[canvasKey{link.OwnerID, link.CanvasID}]
+		if !ok {
+			continue
+		}
+		canvas.Role = link.Role
+		if !withRole {
+			if link.OwnerID == userID {
+				canvas.Role = RoleOwner
+			} else if canvas.Role, ok = sharedRoles[link.CanvasID]; !ok {
+				continue
+			}
+		}
+		canvases = append(canvases, canvas)
+	}
+	return canvases, nil
+}
+
+// listTrashedCanvases pages through the user's trash
+func listTrashedCanvases(session *gocql.Session, userID string, opts listOptions, limit int, pageState []byte) ([]Canvas, []byte, error) {
+	stmt := `SELECT canvas_id, canvas_name, created_at, updated_at, deleted_at FROM canvas_trash
+		WHERE user_id = ? ORDER BY canvas_id ` + strings.ToUpper(opts.Order)
+
+	var canvases []Canvas
+	pageState, err := pagedScan(
+		func() *gocql.Query { return session.Query(stmt, userID) },
+		limit, pageState,
+		func(iter *gocql.Iter) int {
+			matched := 0
+			var canvas Canvas
+			var updatedAt, deletedAt time.Time
+			for iter.Scan(&canvas.CanvasID, &canvas.CanvasName, &canvas.CreatedAt, &updatedAt, &deletedAt) {
+				if !matchesSearch(canvas.CanvasName, opts.Search) {
+					continue
+				}
+				canvas.OwnerID, canvas.Role = userID, RoleOwner
+				canvas.UpdatedAt, canvas.DeletedAt = timePtr(updatedAt), timePtr(deletedAt)
+				canvases = append(canvases, canvas)
+				matched++
+			}
+			return matched
+		},
+	)
+	return canvases, pageState, err
+}
+
+// markStarred flags the canvases in a page that the user has starred
+func markStarred(session *gocql.Session, userID string, canvases []Canvas) error {
+	if len(canvases) == 0 {
+		return nil
+	}
+	ids := make([]gocql.UUID, len(canvases))
+	for i, canvas := range canvases {
+		ids[i] = canvas.CanvasID
+	}
+
+	starred := make(map[gocql.UUID]bool)
+	iter := session.Query(
+		`SELECT canvas_id FROM canvas_stars WHERE user_id = ? AND canvas_id IN ?`,
+		userID, ids,
+	).Iter()
+	var canvasID gocql.UUID
+	for iter.Scan(&canvasID) {
+		starred[canvasID] = true
+	}
+	if err := iter.Close(); err != nil {
+		return err
+	}
+
+	for i := range canvases {
+		canvases[i].Starred = starred[canvases[i].CanvasID]
+	}
+	return nil
+}
+
+// timePtr returns nil for unset timestamps so they are omitted from responses
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
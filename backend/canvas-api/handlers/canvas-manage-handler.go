@@ -0,0 +1,476 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"canvas-api/config"
+	"shared/auth"
+	"shared/logging"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/gocql/gocql"
+	"github.com/gorilla/mux"
+)
+
+const maxCanvasNameLength = 200
+const maxDescriptionLength = 2000
+
+var backgroundColorPattern = regexp.MustCompile(`^(#[0-9a-fA-F]{3}|#[0-9a-fA-F]{6}|transparent)$`)
+
+var backgroundPatterns = map[string]bool{"none": true, "grid": true, "dots": true}
+
+// TrashedCanvas is a canvas in the trash, as returned by ListTrash
+type TrashedCanvas struct {
+	CanvasID   gocql.UUID `json:"canvas_id"`
+	CanvasName string     `json:"canvas_name"`
+	CreatedAt  time.Time  `json:"created_at"`
+	DeletedAt  time.Time  `json:"deleted_at"`
+	PurgeAt    time.Time  `json:"purge_at"`
+}
+
+// canvasIDFromRequest parses the canvas_id path variable, writing a 400 if it is invalid
+func canvasIDFromRequest(w http.ResponseWriter, r *http.Request) (gocql.UUID, bool) {
+	canvasID, err := gocql.ParseUUID(mux.Vars(r)["canvas_id"])
+	if err != nil {
+		http.Error(w, "Invalid canvas ID", http.StatusBadRequest)
+		return gocql.UUID{}, false
+	}
+	return canvasID, true
+}
+
+// UpdateCanvas changes a canvas's name, description or background settings.
+// Only fields present in the request body are changed. Owners and editors may update.
+func UpdateCanvas(session *gocql.Session) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.UserIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			logging.Printf(r.Context(), "User ID not found in context")
+			return
+		}
+		canvasID, ok := canvasIDFromRequest(w, r)
+		if !ok {
+			return
+		}
+
+		var requestData struct {
+			CanvasName        *string `json:"canvas_name"`
+			Description       *string `json:"description"`
+			BackgroundColor   *string `json:"background_color"`
+			BackgroundPattern *string `json:"background_pattern"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			logging.Printf(r.Context(), "Error decoding request body: %v", err)
+			return
+		}
+
+		// Build the SET clause from the fields that were provided
+		var assignments []string
+		var values []interface{}
+		if requestData.CanvasName != nil {
+			name := strings.TrimSpace(*requestData.CanvasName)
+			if name == "" || len(name) > maxCanvasNameLength {
+				http.Error(w, "Canvas name must be between 1 and 200 characters", http.StatusBadRequest)
+				return
+			}
+			assignments = append(assignments, "canvas_name = ?")
+			values = append(values, name)
+		}
+		if requestData.Description != nil {
+			if len(*requestData.Description) > maxDescriptionLength {
+				http.Error(w, "Description must be at most 2000 characters", http.StatusBadRequest)
+				return
+			}
+			assignments = append(assignments, "description = ?")
+			values = append(values, *requestData.Description)
+		}
+		if requestData.BackgroundColor != nil {
+			if !backgroundColorPattern.MatchString(*requestData.BackgroundColor) {
+				http.Error(w, "Background color must be a hex colour or transparent", http.StatusBadRequest)
+				return
+			}
+			assignments = append(assignments, "background_color = ?")
+			values = append(values, *requestData.BackgroundColor)
+		}
+		if requestData.BackgroundPattern != nil {
+			if !backgroundPatterns[*requestData.BackgroundPattern] {
+				http.Error(w, "Background pattern must be none, grid or dots", http.StatusBadRequest)
+				return
+			}
+			assignments = append(assignments, "background_pattern = ?")
+			values = append(values, *requestData.BackgroundPattern)
+		}
+		if len(assignments) == 0 {
+			http.Error(w, "No fields to update", http.StatusBadRequest)
+			return
+		}
+
+		ownerID, role, err := resolveCanvasAccess(session, userID, canvasID)
+		if err == errCanvasNotFound {
+			http.Error(w, "Canvas not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to fetch canvas", http.StatusInternalServerError)
+			logging.Errorf(r.Context(), "Error resolving access to canvas %s: %v", canvasID, err)
+			return
+		}
+		if role == RoleViewer {
+			http.Error(w, "You do not have permission to edit this canvas", http.StatusForbidden)
+			return
+		}
+
+		// Read the current listing fields so the index rows can be replaced after the update
+		var currentName string
+		var createdAt, previousUpdate time.Time
+		err = session.Query(
+			`SELECT canvas_name, created_at, updated_at FROM canvases WHERE user_id = ? AND canvas_id = ?`,
+			ownerID, canvasID,
+		).Scan(&currentName, &createdAt, &previousUpdate)
+		if err == gocql.ErrNotFound {
+			http.Error(w, "Canvas not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to fetch canvas", http.StatusInternalServerError)
+			logging.Errorf(r.Context(), "Error fetching canvas %s: %v", canvasID, err)
+			return
+		}
+
+		updatedAt := time.Now()
+		assignments = append(assignments, "updated_at = ?")
+		values = append(values, updatedAt, ownerID, canvasID)
+
+		newName := currentName
+		if requestData.CanvasName != nil {
+			newName = strings.TrimSpace(*requestData.CanvasName)
+		}
+
+		// The row and its index entries change together, so listings never
+		// show a name or position the canvas no longer has
+		batch := session.NewBatch(gocql.LoggedBatch)
+		batch.Query(`UPDATE canvases SET `+strings.Join(assignments, ", ")+` WHERE user_id = ? AND canvas_id = ?`, values...)
+		unindexCanvas(batch, ownerID, canvasID, currentName, previousUpdate)
+		indexCanvas(batch, ownerID, canvasID, newName, createdAt, updatedAt)
+		if err := session.ExecuteBatch(batch); err != nil {
+			http.Error(w, "Failed to update canvas", http.StatusInternalServerError)
+			logging.Errorf(r.Context(), "Error updating canvas %s: %v", canvasID, err)
+			return
+		}
+
+		// A batch spanning tables cannot be conditional, so an update racing a
+		// delete can leave behind a row holding only the updated columns
+		if err := removeResurrectedCanvas(session, ownerID, canvasID, newName, updatedAt); err == errCanvasNotFound {
+			http.Error(w, "Canvas not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			logging.Printf(r.Context(), "Error checking canvas %s after update: %v", canvasID, err)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":   "Canvas updated successfully",
+			"canvas_id": canvasID,
+		})
+	}
+}
+
+// removeResurrectedCanvas deletes a canvas row that an update brought back
+// after the canvas was deleted, recognisable by its missing created_at, and
+// reports errCanvasNotFound if it had to
+func removeResurrectedCanvas(session *gocql.Session, ownerID string, canvasID gocql.UUID, name string, updatedAt time.Time) error {
+	var createdAt time.Time
+	err := session.Query(
+		`SELECT created_at FROM canvases WHERE user_id = ? AND canvas_id = ?`,
+		ownerID, canvasID,
+	).Scan(&createdAt)
+	if err == gocql.ErrNotFound {
+		return errCanvasNotFound
+	} else if err != nil || !createdAt.IsZero() {
+		return err
+	}
+
+	batch := session.NewBatch(gocql.LoggedBatch)
+	batch.Query(`DELETE FROM canvases WHERE user_id = ? AND canvas_id = ?`, ownerID, canvasID)
+	unindexCanvas(batch, ownerID, canvasID, name, updatedAt)
+	if err := session.ExecuteBatch(batch); err != nil {
+		return err
+	}
+	return errCanvasNotFound
+}
+
+// canvasReferences are the rows in other tables that point at a canvas: who
+// it is shared with and who starred it. They are written with the trash TTL
+// when the canvas is trashed, so they expire with it, and made permanent again
+// when it is restored.
+type canvasReferences struct {
+	shares    map[string]string // role by the user the canvas is shared with
+	starredBy []string
+}
+
+// loadCanvasReferences reads the shares of a canvas and the stars of its owner
+// and the users it is shared with, the only users who can star it
+func loadCanvasReferences(session *gocql.Session, ownerID string, canvasID gocql.UUID) (*canvasReferences, error) {
+	refs := &canvasReferences{shares: make(map[string]string)}
+	iter := session.Query(`SELECT user_id, role FROM canvas_shares_by_canvas WHERE canvas_id = ?`, canvasID).Iter()
+	var shareUserID, role string
+	for iter.Scan(&shareUserID, &role) {
+		refs.shares[shareUserID] = role
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+
+	users := []string{ownerID}
+	for shareUserID := range refs.shares {
+		users = append(users, shareUserID)
+	}
+	for _, starUserID := range users {
+		var id gocql.UUID
+		err := session.Query(
+			`SELECT canvas_id FROM canvas_stars WHERE user_id = ? AND canvas_id = ?`,
+			starUserID, canvasID,
+		).Scan(&id)
+		if err == nil {
+			refs.starredBy = append(refs.starredBy, starUserID)
+		} else if err != gocql.ErrNotFound {
+			return nil, err
+		}
+	}
+	return refs, nil
+}
+
+// writeCanvasReferences adds inserts rewriting a canvas's share and star rows
+// to a batch. A ttl of 0 makes them permanent.
+func writeCanvasReferences(batch *gocql.Batch, ownerID string, canvasID gocql.UUID, refs *canvasReferences, ttl int) {
+	for shareUserID, role := range refs.shares {
+		batch.Query(
+			`INSERT INTO canvas_shares (user_id, canvas_id, owner_id, role) VALUES (?, ?, ?, ?) USING TTL ?`,
+			shareUserID, canvasID, ownerID, role, ttl,
+		)
+		batch.Query(
+			`INSERT INTO canvas_shares_by_canvas (canvas_id, user_id, role) VALUES (?, ?, ?) USING TTL ?`,
+			canvasID, shareUserID, role, ttl,
+		)
+	}
+	for _, starUserID := range refs.starredBy {
+		batch.Query(
+			`INSERT INTO canvas_stars (user_id, canvas_id, owner_id) VALUES (?, ?, ?) USING TTL ?`,
+			starUserID, canvasID, ownerID, ttl,
+		)
+	}
+}
+
+// DeleteCanvas moves a canvas the user owns into the trash and tears down any
+// staged copies of it. Trashed canvases expire after the retention window,
+// along with their shares and stars.
+func DeleteCanvas(session *gocql.Session, redisClient *redis.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.UserIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			logging.Printf(r.Context(), "User ID not found in context")
+			return
+		}
+		canvasID, ok := canvasIDFromRequest(w, r)
+		if !ok {
+			return
+		}
+
+		// Only the owner's partition is checked, so shared users can never delete
+		record, err := loadCanvasRecord(session, "canvases", userID, canvasID)
+		if err == errCanvasNotFound {
+			http.Error(w, "Canvas not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to fetch canvas", http.StatusInternalServerError)
+			logging.Errorf(r.Context(), "Error fetching canvas %s: %v", canvasID, err)
+			return
+		}
+
+		refs, err := loadCanvasReferences(session, userID, canvasID)
+		if err != nil {
+			http.Error(w, "Failed to delete canvas", http.StatusInternalServerError)
+			logging.Errorf(r.Context(), "Error fetching shares and stars of canvas %s: %v", canvasID, err)
+			return
+		}
+
+		retention := config.TrashRetention()
+		ttl := int(retention.Seconds())
+		deletedAt := time.Now()
+
+		batch := session.NewBatch(gocql.LoggedBatch)
+		batch.Query(
+			`INSERT INTO canvas_trash (user_id, canvas_id, `+canvasColumns+`, deleted_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) USING TTL ?`,
+			append(record.values(), deletedAt, ttl)...,
+		)
+		batch.Query(`DELETE FROM canvases WHERE user_id = ? AND canvas_id = ?`, userID, canvasID)
+		unindexCanvas(batch, userID, canvasID, record.CanvasName, record.UpdatedAt)
+		writeCanvasReferences(batch, userID, canvasID, refs, ttl)
+		if err := session.ExecuteBatch(batch); err != nil {
+			http.Error(w, "Failed to delete canvas", http.StatusInternalServerError)
+			logging.Errorf(r.Context(), "Error moving canvas %s to trash: %v", canvasID, err)
+			return
+		}
+
+		if err := teardownStagingSessions(context.Background(), redisClient, canvasID.String()); err != nil {
+			logging.Printf(r.Context(), "Error tearing down staging sessions for canvas %s: %v", canvasID, err)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":   "Canvas moved to trash",
+			"canvas_id": canvasID,
+			"purge_at":  deletedAt.Add(retention),
+		})
+	}
+}
+
+// ListTrash returns the user's deleted canvases that are still within the retention window
+func ListTrash(session *gocql.Session) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.UserIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			logging.Printf(r.Context(), "User ID not found in context")
+			return
+		}
+
+		retention := config.TrashRetention()
+		trashed := []TrashedCanvas{}
+		iter := session.Query(
+			`SELECT canvas_id, canvas_name, created_at, deleted_at FROM canvas_trash WHERE user_id = ?`,
+			userID,
+		).Iter()
+
+		var canvas TrashedCanvas
+		for iter.Scan(&canvas.CanvasID, &canvas.CanvasName, &canvas.CreatedAt, &canvas.DeletedAt) {
+			canvas.PurgeAt = canvas.DeletedAt.Add(retention)
+			trashed = append(trashed, canvas)
+		}
+		if err := iter.Close(); err != nil {
+			http.Error(w, "Failed to fetch trash", http.StatusInternalServerError)
+			logging.Errorf(r.Context(), "Error fetching trash for user %s: %v", userID, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(trashed)
+	}
+}
+
+// RestoreCanvas moves a canvas out of the trash back into the user's canvases,
+// keeping its shares and stars
+func RestoreCanvas(session *gocql.Session) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.UserIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			logging.Printf(r.Context(), "User ID not found in context")
+			return
+		}
+		canvasID, ok := canvasIDFromRequest(w, r)
+		if !ok {
+			return
+		}
+
+		record, err := loadCanvasRecord(session, "canvas_trash", userID, canvasID)
+		if err == errCanvasNotFound {
+			http.Error(w, "Canvas not found in trash", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to fetch canvas", http.StatusInternalServerError)
+			logging.Errorf(r.Context(), "Error fetching trashed canvas %s: %v", canvasID, err)
+			return
+		}
+		record.UpdatedAt = time.Now()
+
+		refs, err := loadCanvasReferences(session, userID, canvasID)
+		if err != nil {
+			http.Error(w, "Failed to restore canvas", http.StatusInternalServerError)
+			logging.Errorf(r.Context(), "Error fetching shares and stars of canvas %s: %v", canvasID, err)
+			return
+		}
+
+		batch := session.NewBatch(gocql.LoggedBatch)
+		batch.Query(
+			`INSERT INTO canvases (user_id, canvas_id, `+canvasColumns+`)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			record.values()...,
+		)
+		batch.Query(`DELETE FROM canvas_trash WHERE user_id = ? AND canvas_id = ?`, userID, canvasID)
+		indexCanvas(batch, userID, canvasID, record.CanvasName, record.CreatedAt, record.UpdatedAt)
+		writeCanvasReferences(batch, userID, canvasID, refs, 0)
+		if err := session.ExecuteBatch(batch); err != nil {
+			http.Error(w, "Failed to restore canvas", http.StatusInternalServerError)
+			logging.Errorf(r.Context(), "Error restoring canvas %s: %v", canvasID, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":   "Canvas restored successfully",
+			"canvas_id": canvasID,
+		})
+	}
+}
+
+// PurgeCanvas permanently deletes a canvas from the trash without waiting for
+// the retention window, along with everything that refers to it: its shares,
+// the stars on it and any listing index rows
+func PurgeCanvas(session *gocql.Session) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.UserIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			logging.Printf(r.Context(), "User ID not found in context")
+			return
+		}
+		canvasID, ok := canvasIDFromRequest(w, r)
+		if !ok {
+			return
+		}
+
+		record, err := loadCanvasRecord(session, "canvas_trash", userID, canvasID)
+		if err == errCanvasNotFound {
+			http.Error(w, "Canvas not found in trash", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to purge canvas", http.StatusInternalServerError)
+			logging.Errorf(r.Context(), "Error fetching trashed canvas %s: %v", canvasID, err)
+			return
+		}
+
+		var sharedWith []string
+		iter := session.Query(`SELECT user_id FROM canvas_shares_by_canvas WHERE canvas_id = ?`, canvasID).Iter()
+		var shareUserID string
+		for iter.Scan(&shareUserID) {
+			sharedWith = append(sharedWith, shareUserID)
+		}
+		if err := iter.Close(); err != nil {
+			http.Error(w, "Failed to purge canvas", http.StatusInternalServerError)
+			logging.Errorf(r.Context(), "Error fetching shares of canvas %s: %v", canvasID, err)
+			return
+		}
+
+		batch := session.NewBatch(gocql.LoggedBatch)
+		batch.Query(`DELETE FROM canvas_trash WHERE user_id = ? AND canvas_id = ?`, userID, canvasID)
+		unindexCanvas(batch, userID, canvasID, record.CanvasName, record.UpdatedAt)
+		batch.Query(`DELETE FROM canvas_stars WHERE user_id = ? AND canvas_id = ?`, userID, canvasID)
+		for _, shareUserID := range sharedWith {
+			unshareCanvas(batch, canvasID, shareUserID)
+		}
+		if err := session.ExecuteBatch(batch); err != nil {
+			http.Error(w, "Failed to purge canvas", http.StatusInternalServerError)
+			logging.Errorf(r.Context(), "Error purging canvas %s: %v", canvasID, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -3,13 +3,13 @@ package handlers
 import (
 	"context"
 	"encoding/json"
-	"log"
 	"math/rand"
 	"net/http"
 	"time"
 
-	"canvas-api/auth"
 	"canvas-api/models"
+	"shared/auth"
+	"shared/logging"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/gocql/gocql"
@@ -17,6 +17,27 @@ import (
 
 const stagingIDLength = 10
 const alphanumericCharset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+const stagingTTL = 10 * time.Minute
+
+// stagingIndexKey is the Redis set of staging IDs created for a canvas
+func stagingIndexKey(canvasID string) string {
+	return "canvas-stagings:" + canvasID
+}
+
+// teardownStagingSessions removes every staged copy of a canvas from Redis
+func teardownStagingSessions(ctx context.Context, redisClient *redis.Client, canvasID string) error {
+	indexKey := stagingIndexKey(canvasID)
+	stagingIDs, err := redisClient.SMembers(ctx, indexKey).Result()
+	if err != nil {
+		return err
+	}
+
+	keys := []string{indexKey}
+	for _, stagingID := range stagingIDs {
+		keys = append(keys, "canvas-info:"+stagingID, "canvas-svg:"+stagingID)
+	}
+	return redisClient.Del(ctx, keys...).Err()
+}
 
 func generateStagingID() string {
 	rand.Seed(time.Now().UnixNano())
@@ -33,7 +54,7 @@ func StageCanvas(session *gocql.Session, redisClient *redis.Client) http.Handler
 		userID, ok := auth.UserIDFromContext(r.Context())
 		if !ok {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			log.Println("User ID not found in context")
+			logging.Printf(r.Context(), "User ID not found in context")
 			return
 		}
 
@@ -43,7 +64,7 @@ func StageCanvas(session *gocql.Session, redisClient *redis.Client) http.Handler
 		}
 		if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
 			http.Error(w, "Invalid request body", http.StatusBadRequest)
-			log.Printf("Error decoding request body: %v", err)
+			logging.Printf(r.Context(), "Error decoding request body: %v", err)
 			return
 		}
 		if requestData.CanvasID == "" {
@@ -55,7 +76,7 @@ func StageCanvas(session *gocql.Session, redisClient *redis.Client) http.Handler
 		uuid, err := gocql.ParseUUID(requestData.CanvasID)
 		if err != nil {
 			http.Error(w, "Invalid canvas ID", http.StatusBadRequest)
-			log.Printf("Invalid canvas ID: %v", err)
+			logging.Printf(r.Context(), "Invalid canvas ID: %v", err)
 			return
 		}
 
@@ -70,7 +91,7 @@ func StageCanvas(session *gocql.Session, redisClient *redis.Client) http.Handler
 		)
 		if err != nil {
 			http.Error(w, "Canvas not found", http.StatusNotFound)
-			log.Printf("Error fetching canvas from Cassandra: %v", err)
+			logging.Printf(r.Context(), "Error fetching canvas from Cassandra: %v", err)
 			return
 		}
 
@@ -82,14 +103,14 @@ func StageCanvas(session *gocql.Session, redisClient *redis.Client) http.Handler
 		canvasInfoJSON, err := json.Marshal(canvasInfo)
 		if err != nil {
 			http.Error(w, "Failed to serialize canvas metadata", http.StatusInternalServerError)
-			log.Printf("Error serializing canvas metadata: %v", err)
+			logging.Errorf(r.Context(), "Error serializing canvas metadata: %v", err)
 			return
 		}
 
 		svgDataJSON, err := json.Marshal(svgData)
 		if err != nil {
 			http.Error(w, "Failed to serialize SVG data", http.StatusInternalServerError)
-			log.Printf("Error serializing SVG data: %v", err)
+			logging.Errorf(r.Context(), "Error serializing SVG data: %v", err)
 			return
 		}
 
@@ -101,20 +122,28 @@ func StageCanvas(session *gocql.Session, redisClient *redis.Client) http.Handler
 		canvasInfoKey := "canvas-info:" + stagingID
 		canvasSVGKey := "canvas-svg:" + stagingID
 
-		err = redisClient.Set(ctx, canvasInfoKey, canvasInfoJSON, 10*time.Minute).Err()
+		err = redisClient.Set(ctx, canvasInfoKey, canvasInfoJSON, stagingTTL).Err()
 		if err != nil {
 			http.Error(w, "Failed to stage canvas metadata", http.StatusInternalServerError)
-			log.Printf("Error storing canvas metadata in Redis: %v", err)
+			logging.Errorf(r.Context(), "Error storing canvas metadata in Redis: %v", err)
 			return
 		}
 
-		err = redisClient.Set(ctx, canvasSVGKey, svgDataJSON, 10*time.Minute).Err()
+		err = redisClient.Set(ctx, canvasSVGKey, svgDataJSON, stagingTTL).Err()
 		if err != nil {
 			http.Error(w, "Failed to stage SVG data", http.StatusInternalServerError)
-			log.Printf("Error storing SVG data in Redis: %v", err)
+			logging.Errorf(r.Context(), "Error storing SVG data in Redis: %v", err)
 			return
 		}
 
+		// Track the staging ID against the canvas so it can be torn down if the canvas is deleted
+		indexKey := stagingIndexKey(uuid.String())
+		if err := redisClient.SAdd(ctx, indexKey, stagingID).Err(); err != nil {
+			logging.Printf(r.Context(), "Error indexing staging ID for canvas %s: %v", uuid, err)
+		} else {
+			redisClient.Expire(ctx, indexKey, stagingTTL)
+		}
+
 		// Respond with success
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]string{
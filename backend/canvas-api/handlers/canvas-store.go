@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"canvas-api/models"
+
+	"github.com/gocql/gocql"
+)
+
+// canvasColumns lists every column a canvas row carries besides its key.
+// canvases and canvas_trash share these so rows can be moved between them.
+const canvasColumns = `canvas_name, created_at, svg_data, description, background_color,
+	background_pattern, updated_at, forked_from_canvas, forked_from_owner, forked_from_version`
+
+// canvasRecord is a complete canvas row
+type canvasRecord struct {
+	UserID            string
+	CanvasID          gocql.UUID
+	CanvasName        string
+	CreatedAt         time.Time
+	SVGData           []models.SVGData
+	Description       string
+	BackgroundColor   string
+	BackgroundPattern string
+	UpdatedAt         time.Time
+	ForkedFromCanvas  *gocql.UUID
+	ForkedFromOwner   *string
+	ForkedFromVersion *int
+}
+
+// fields returns pointers to the record's fields in canvasColumns order
+func (c *canvasRecord) fields() []interface{} {
+	return []interface{}{
+		&c.CanvasName, &c.CreatedAt, &c.SVGData, &c.Description, &c.BackgroundColor,
+		&c.BackgroundPattern, &c.UpdatedAt, &c.ForkedFromCanvas, &c.ForkedFromOwner, &c.ForkedFromVersion,
+	}
+}
+
+// values returns the row key followed by the record's values in canvasColumns order
+func (c *canvasRecord) values() []interface{} {
+	svgData := c.SVGData
+	if svgData == nil {
+		svgData = []models.SVGData{}
+	}
+	return []interface{}{
+		c.UserID, c.CanvasID,
+		c.CanvasName, c.CreatedAt, svgData, c.Description, c.BackgroundColor,
+		c.BackgroundPattern, c.UpdatedAt, c.ForkedFromCanvas, c.ForkedFromOwner, c.ForkedFromVersion,
+	}
+}
+
+// loadCanvasRecord reads a full canvas row from canvases or canvas_trash
+func loadCanvasRecord(session *gocql.Session, table, userID string, canvasID gocql.UUID) (*canvasRecord, error) {
+	record := &canvasRecord{UserID: userID, CanvasID: canvasID}
+	err := session.Query(
+		`SELECT `+canvasColumns+` FROM `+table+` WHERE user_id = ? AND canvas_id = ?`,
+		userID, canvasID,
+	).Scan(record.fields()...)
+	if err == gocql.ErrNotFound {
+		return nil, errCanvasNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// insertCanvas writes a new canvas row together with its listing index rows
+func insertCanvas(session *gocql.Session, record *canvasRecord) error {
+	if record.UpdatedAt.IsZero() {
+		record.UpdatedAt = record.CreatedAt
+	}
+
+	batch := session.NewBatch(gocql.LoggedBatch)
+	batch.Query(
+		`INSERT INTO canvases (user_id, canvas_id, `+canvasColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		record.values()...,
+	)
+	indexCanvas(batch, record.UserID, record.CanvasID, record.CanvasName, record.CreatedAt, record.UpdatedAt)
+	return session.ExecuteBatch(batch)
+}
+
+// nameKey is the sort key used by canvases_by_name
+func nameKey(name string) string {
+	return strings.ToLower(name)
+}
+
+// indexCanvas adds the listing index rows for a canvas to a batch
+func indexCanvas(batch *gocql.Batch, userID string, canvasID gocql.UUID, name string, createdAt, updatedAt time.Time) {
+	batch.Query(
+		`INSERT INTO canvases_by_name (user_id, name_key, canvas_id, canvas_name, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		userID, nameKey(name), canvasID, name, createdAt, updatedAt,
+	)
+	batch.Query(
+		`INSERT INTO canvases_by_updated (user_id, updated_at, canvas_id, canvas_name, created_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		userID, updatedAt, canvasID, name, createdAt,
+	)
+}
+
+// unindexCanvas adds deletes for a canvas's listing index rows to a batch
+func unindexCanvas(batch *gocql.Batch, userID string, canvasID gocql.UUID, name string, updatedAt time.Time) {
+	batch.Query(
+		`DELETE FROM canvases_by_name WHERE user_id = ? AND name_key = ? AND canvas_id = ?`,
+		userID, nameKey(name), canvasID,
+	)
+	batch.Query(
+		`DELETE FROM canvases_by_updated WHERE user_id = ? AND updated_at = ? AND canvas_id = ?`,
+		userID, updatedAt, canvasID,
+	)
+}
+
+// BackfillCanvasIndexes writes the listing index rows of every canvas.
+// Canvases created before canvases_by_name and canvases_by_updated existed
+// have none, and are missing from lists sorted by name or last update. Rows
+// are rewritten with the canvas's current values, so it is safe to run more
+// than once or while canvases are being edited.
+func BackfillCanvasIndexes(session *gocql.Session) error {
+	iter := session.Query(
+		`SELECT user_id, canvas_id, canvas_name, created_at, updated_at FROM canvases`,
+	).PageSize(500).Iter()
+
+	indexed := 0
+	var userID, name string
+	var canvasID gocql.UUID
+	var createdAt, updatedAt time.Time
+	for iter.Scan(&userID, &canvasID, &name, &createdAt, &updatedAt) {
+		batch := session.NewBatch(gocql.LoggedBatch)
+		// Older rows have no updated_at; give them the one they are indexed
+		// under, so the next update can find and replace the index row
+		if updatedAt.IsZero() {
+			updatedAt = createdAt
+			batch.Query(`UPDATE canvases SET updated_at = ? WHERE user_id = ? AND canvas_id = ?`,
+				updatedAt, userID, canvasID)
+		}
+		indexCanvas(batch, userID, canvasID, name, createdAt, updatedAt)
+		if err := session.ExecuteBatch(batch); err != nil {
+			iter.Close()
+			log.Printf("Error indexing canvas %s: %v", canvasID, err)
+			return err
+		}
+		indexed++
+	}
+	if err := iter.Close(); err != nil {
+		log.Printf("Error scanning canvases for backfill: %v", err)
+		return err
+	}
+
+	log.Printf("Backfilled listing indexes for %d canvases", indexed)
+	return nil
+}
@@ -2,24 +2,25 @@ package handlers
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
 	"time"
 
-	"canvas-api/auth"
 	"canvas-api/models"
 	"github.com/gocql/gocql"
+	"shared/auth"
+	"shared/logging"
 )
 
-// CreateCanvas creates a new canvas with an empty svg_data list.
+// CreateCanvas creates a new canvas with an empty svg_data list, or seeded
+// from a template when template_id is provided.
 func CreateCanvas(session *gocql.Session) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Extract userID from context (passed by JWT middleware)
 		userID, ok := auth.UserIDFromContext(r.Context())
 		if !ok {
 
-			log.Println("User ID not found in context")
-			log.Printf("User ID not found in context %s", userID)
+			logging.Printf(r.Context(), "User ID not found in context")
+			logging.Printf(r.Context(), "User ID not found in context %s", userID)
 
 		}
 
@@ -28,30 +29,43 @@ func CreateCanvas(session *gocql.Session) http.HandlerFunc {
 		decoder := json.NewDecoder(r.Body)
 		if err := decoder.Decode(&canvas); err != nil {
 			http.Error(w, "Invalid request payload", http.StatusBadRequest)
-			log.Printf("Error decoding request: %v", err)
+			logging.Printf(r.Context(), "Error decoding request: %v", err)
 			return
 		}
 
 		// Set the userID from context into the canvas model
 		canvas.UserID = userID
 
+		// Seed the canvas from a template if one was requested, otherwise start empty
+		now := time.Now()
+		var svgData []models.SVGData
+		if canvas.TemplateID != "" {
+			t, err := loadTemplate(session, userID, canvas.TemplateID)
+			if err == errTemplateNotFound {
+				http.Error(w, "Template not found", http.StatusBadRequest)
+				return
+			} else if err != nil {
+				http.Error(w, "Failed to fetch template", http.StatusInternalServerError)
+				logging.Errorf(r.Context(), "Error fetching template %s: %v", canvas.TemplateID, err)
+				return
+			}
+			svgData = t.SVGData(now)
+		}
+
 		// Generate a new canvas ID (UUID)
 		canvasID := gocql.TimeUUID()
 
-		// Prepare the query to insert the canvas with an empty SVG data list
-		err := session.Query(
-			`INSERT INTO canvases (user_id, canvas_id, canvas_name, created_at, svg_data)
-			VALUES (?, ?, ?, ?, ?)`,
-			canvas.UserID,
-			canvasID,
-			canvas.CanvasName,
-			time.Now(),
-			[]interface{}{}, // Empty list for svg_data
-		).Exec()
-
+		// Insert the canvas along with its listing index rows
+		err := insertCanvas(session, &canvasRecord{
+			UserID:     canvas.UserID,
+			CanvasID:   canvasID,
+			CanvasName: canvas.CanvasName,
+			CreatedAt:  now,
+			SVGData:    svgData,
+		})
 		if err != nil {
 			http.Error(w, "Failed to create canvas", http.StatusInternalServerError)
-			log.Printf("Error inserting canvas: %v", err)
+			logging.Errorf(r.Context(), "Error inserting canvas: %v", err)
 			return
 		}
 
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"canvas-api/models"
+	"shared/auth"
+	"shared/logging"
+
+	"github.com/gocql/gocql"
+	"github.com/gorilla/mux"
+)
+
+// DuplicateCanvas copies a canvas the user can read into a new canvas they own.
+// By default only the current content is copied; include_history copies the
+// full svg_data history. The new canvas records which canvas and version it
+// was forked from.
+func DuplicateCanvas(session *gocql.Session) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.UserIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			logging.Printf(r.Context(), "User ID not found in context")
+			return
+		}
+
+		sourceID, err := gocql.ParseUUID(mux.Vars(r)["canvas_id"])
+		if err != nil {
+			http.Error(w, "Invalid canvas ID", http.StatusBadRequest)
+			return
+		}
+
+		// The body is optional; an empty one duplicates with defaults
+		var requestData struct {
+			CanvasName     string `json:"canvas_name"`
+			IncludeHistory bool   `json:"include_history"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil && err != io.EOF {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			logging.Printf(r.Context(), "Error decoding request body: %v", err)
+			return
+		}
+
+		// Any access level is enough to fork, so viewers can copy a board into their own space
+		ownerID, _, err := resolveCanvasAccess(session, userID, sourceID)
+		if err == errCanvasNotFound {
+			http.Error(w, "Canvas not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to fetch canvas", http.StatusInternalServerError)
+			logging.Errorf(r.Context(), "Error resolving access to canvas %s: %v", sourceID, err)
+			return
+		}
+
+		var sourceName string
+		var history []models.SVGData
+		err = session.Query(
+			`SELECT canvas_name, svg_data FROM canvases WHERE user_id = ? AND canvas_id = ?`,
+			ownerID, sourceID,
+		).Scan(&sourceName, &history)
+		if err == gocql.ErrNotFound {
+			http.Error(w, "Canvas not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to fetch canvas", http.StatusInternalServerError)
+			logging.Errorf(r.Context(), "Error fetching canvas %s: %v", sourceID, err)
+			return
+		}
+
+		// The source's version is the length of its history at the time of the fork
+		version := len(history)
+
+		svgData := history
+		if !requestData.IncludeHistory {
+			svgData = currentElements(history)
+			for i := range svgData {
+				svgData[i].Action = models.ActionCreated
+			}
+		}
+
+		canvasName := strings.TrimSpace(requestData.CanvasName)
+		if canvasName == "" {
+			canvasName = sourceName + " (copy)"
+		}
+
+		canvasID := gocql.TimeUUID()
+		err = insertCanvas(session, &canvasRecord{
+			UserID:            userID,
+			CanvasID:          canvasID,
+			CanvasName:        canvasName,
+			CreatedAt:         time.Now(),
+			SVGData:           svgData,
+			ForkedFromCanvas:  &sourceID,
+			ForkedFromOwner:   &ownerID,
+			ForkedFromVersion: &version,
+		})
+		if err != nil {
+			http.Error(w, "Failed to duplicate canvas", http.StatusInternalServerError)
+			logging.Errorf(r.Context(), "Error inserting duplicate of canvas %s: %v", sourceID, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":     "Canvas duplicated successfully",
+			"canvas_id":   canvasID,
+			"canvas_name": canvasName,
+			"forked_from": map[string]interface{}{
+				"canvas_id": sourceID,
+				"owner_id":  ownerID,
+				"version":   version,
+			},
+		})
+	}
+}
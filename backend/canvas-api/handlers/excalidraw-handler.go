@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"canvas-api/excalidraw"
+	"canvas-api/models"
+	"shared/auth"
+	"shared/logging"
+
+	"github.com/gocql/gocql"
+	"github.com/gorilla/mux"
+)
+
+// maxImportSize bounds the size of an uploaded .excalidraw file
+const maxImportSize = 10 << 20
+
+var unsafeFilenameChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// ExportExcalidraw serializes a canvas the user can read to an Excalidraw
+// .excalidraw document
+func ExportExcalidraw(session *gocql.Session) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.UserIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			logging.Printf(r.Context(), "User ID not found in context")
+			return
+		}
+
+		canvasID, err := gocql.ParseUUID(mux.Vars(r)["canvas_id"])
+		if err != nil {
+			http.Error(w, "Invalid canvas ID", http.StatusBadRequest)
+			return
+		}
+
+		// Shared canvases are stored in their owner's partition
+		ownerID, _, err := resolveCanvasAccess(session, userID, canvasID)
+		if err == errCanvasNotFound {
+			http.Error(w, "Canvas not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to fetch canvas", http.StatusInternalServerError)
+			logging.Errorf(r.Context(), "Error resolving access to canvas %s: %v", canvasID, err)
+			return
+		}
+
+		var canvasName string
+		var history []models.SVGData
+		err = session.Query(
+			`SELECT canvas_name, svg_data FROM canvases WHERE user_id = ? AND canvas_id = ?`,
+			ownerID, canvasID,
+		).Consistency(gocql.One).Scan(&canvasName, &history)
+		if err == gocql.ErrNotFound {
+			http.Error(w, "Canvas not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to fetch canvas", http.StatusInternalServerError)
+			logging.Errorf(r.Context(), "Error fetching canvas %s for export: %v", canvasID, err)
+			return
+		}
+
+		file, skipped := excalidraw.Export(canvasName, currentElements(history))
+		if skipped > 0 {
+			logging.Printf(r.Context(), "Skipped %d unsupported elements exporting canvas %s", skipped, canvasID)
+		}
+
+		filename := unsafeFilenameChars.ReplaceAllString(canvasName, "_")
+		if filename == "" {
+			filename = canvasID.String()
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.excalidraw"`, filename))
+		if err := json.NewEncoder(w).Encode(file); err != nil {
+			logging.Printf(r.Context(), "Error encoding export for canvas %s: %v", canvasID, err)
+		}
+	}
+}
+
+// ImportExcalidraw creates a new canvas from an uploaded .excalidraw document.
+// The canvas name is taken from the canvas_name query parameter, falling back
+// to the name stored in the file.
+func ImportExcalidraw(session *gocql.Session) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.UserIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			logging.Printf(r.Context(), "User ID not found in context")
+			return
+		}
+
+		file, err := excalidraw.Decode(http.MaxBytesReader(w, r.Body, maxImportSize))
+		if err != nil {
+			http.Error(w, "Invalid Excalidraw file", http.StatusBadRequest)
+			logging.Printf(r.Context(), "Error decoding Excalidraw import: %v", err)
+			return
+		}
+
+		canvasName := strings.TrimSpace(r.URL.Query().Get("canvas_name"))
+		if canvasName == "" {
+			canvasName = file.AppState.Name
+		}
+		if canvasName == "" {
+			canvasName = "Imported canvas"
+		}
+
+		now := time.Now()
+		elements, skipped := excalidraw.Import(file, now)
+		canvasID := gocql.TimeUUID()
+
+		err = insertCanvas(session, &canvasRecord{
+			UserID:     userID,
+			CanvasID:   canvasID,
+			CanvasName: canvasName,
+			CreatedAt:  now,
+			SVGData:    elements,
+		})
+		if err != nil {
+			http.Error(w, "Failed to create canvas", http.StatusInternalServerError)
+			logging.Errorf(r.Context(), "Error inserting imported canvas: %v", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":           "Canvas imported successfully",
+			"canvas_id":         canvasID,
+			"imported_elements": len(elements),
+			"skipped_elements":  skipped,
+		})
+	}
+}
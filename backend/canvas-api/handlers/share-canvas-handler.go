@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"shared/auth"
+	"shared/logging"
+
+	"github.com/gocql/gocql"
+	"github.com/gorilla/mux"
+)
+
+// CanvasShare is a user a canvas is shared with, as returned by ListCanvasShares
+type CanvasShare struct {
+	UserID string `json:"user_id"`
+	Role   string `json:"role"`
+}
+
+// requireOwnedCanvas checks the canvas is in the user's own partition, writing
+// a 404 if not. Only owners manage who a canvas is shared with.
+func requireOwnedCanvas(w http.ResponseWriter, r *http.Request, session *gocql.Session, userID string, canvasID gocql.UUID) bool {
+	var id gocql.UUID
+	err := session.Query(
+		`SELECT canvas_id FROM canvases WHERE user_id = ? AND canvas_id = ?`,
+		userID, canvasID,
+	).Scan(&id)
+	if err == gocql.ErrNotFound {
+		http.Error(w, "Canvas not found", http.StatusNotFound)
+		return false
+	} else if err != nil {
+		http.Error(w, "Failed to fetch canvas", http.StatusInternalServerError)
+		logging.Errorf(r.Context(), "Error fetching canvas %s: %v", canvasID, err)
+		return false
+	}
+	return true
+}
+
+// ListCanvasShares returns the users a canvas the user owns is shared with
+func ListCanvasShares(session *gocql.Session) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.UserIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			logging.Printf(r.Context(), "User ID not found in context")
+			return
+		}
+		canvasID, ok := canvasIDFromRequest(w, r)
+		if !ok {
+			return
+		}
+		if !requireOwnedCanvas(w, r, session, userID, canvasID) {
+			return
+		}
+
+		shares := []CanvasShare{}
+		iter := session.Query(
+			`SELECT user_id, role FROM canvas_shares_by_canvas WHERE canvas_id = ?`,
+			canvasID,
+		).Iter()
+		var share CanvasShare
+		for iter.Scan(&share.UserID, &share.Role) {
+			shares = append(shares, share)
+		}
+		if err := iter.Close(); err != nil {
+			http.Error(w, "Failed to fetch shares", http.StatusInternalServerError)
+			logging.Errorf(r.Context(), "Error fetching shares of canvas %s: %v", canvasID, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(shares)
+	}
+}
+
+// ShareCanvas gives another user editor or viewer access to a canvas the user
+// owns, or changes the access they already have
+func ShareCanvas(session *gocql.Session) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.UserIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			logging.Printf(r.Context(), "User ID not found in context")
+			return
+		}
+		canvasID, ok := canvasIDFromRequest(w, r)
+		if !ok {
+			return
+		}
+		shareWith := mux.Vars(r)["user_id"]
+
+		var requestData struct {
+			Role string `json:"role"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			logging.Printf(r.Context(), "Error decoding request body: %v", err)
+			return
+		}
+		if requestData.Role != RoleEditor && requestData.Role != RoleViewer {
+			http.Error(w, "Role must be editor or viewer", http.StatusBadRequest)
+			return
+		}
+		if shareWith == userID {
+			http.Error(w, "You already own this canvas", http.StatusBadRequest)
+			return
+		}
+		if !requireOwnedCanvas(w, r, session, userID, canvasID) {
+			return
+		}
+
+		var id string
+		err := session.Query(`SELECT user_id FROM users WHERE user_id = ?`, shareWith).Scan(&id)
+		if err == gocql.ErrNotFound {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to share canvas", http.StatusInternalServerError)
+			logging.Errorf(r.Context(), "Error looking up user %s: %v", shareWith, err)
+			return
+		}
+
+		batch := session.NewBatch(gocql.LoggedBatch)
+		batch.Query(
+			`INSERT INTO canvas_shares (user_id, canvas_id, owner_id, role) VALUES (?, ?, ?, ?)`,
+			shareWith, canvasID, userID, requestData.Role,
+		)
+		batch.Query(
+			`INSERT INTO canvas_shares_by_canvas (canvas_id, user_id, role) VALUES (?, ?, ?)`,
+			canvasID, shareWith, requestData.Role,
+		)
+		if err := session.ExecuteBatch(batch); err != nil {
+			http.Error(w, "Failed to share canvas", http.StatusInternalServerError)
+			logging.Errorf(r.Context(), "Error sharing canvas %s with user %s: %v", canvasID, shareWith, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(CanvasShare{UserID: shareWith, Role: requestData.Role})
+	}
+}
+
+// UnshareCanvas takes away another user's access to a canvas the user owns,
+// along with their star on it
+func UnshareCanvas(session *gocql.Session) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.UserIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			logging.Printf(r.Context(), "User ID not found in context")
+			return
+		}
+		canvasID, ok := canvasIDFromRequest(w, r)
+		if !ok {
+			return
+		}
+		sharedWith := mux.Vars(r)["user_id"]
+		if !requireOwnedCanvas(w, r, session, userID, canvasID) {
+			return
+		}
+
+		batch := session.NewBatch(gocql.LoggedBatch)
+		unshareCanvas(batch, canvasID, sharedWith)
+		if err := session.ExecuteBatch(batch); err != nil {
+			http.Error(w, "Failed to unshare canvas", http.StatusInternalServerError)
+			logging.Errorf(r.Context(), "Error unsharing canvas %s from user %s: %v", canvasID, sharedWith, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// unshareCanvas adds deletes for a user's share of a canvas, and their star on
+// it, to a batch
+func unshareCanvas(batch *gocql.Batch, canvasID gocql.UUID, sharedWith string) {
+	batch.Query(`DELETE FROM canvas_shares WHERE user_id = ? AND canvas_id = ?`, sharedWith, canvasID)
+	batch.Query(`DELETE FROM canvas_shares_by_canvas WHERE canvas_id = ? AND user_id = ?`, canvasID, sharedWith)
+	batch.Query(`DELETE FROM canvas_stars WHERE user_id = ? AND canvas_id = ?`, sharedWith, canvasID)
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"net/http"
+
+	"shared/auth"
+	"shared/logging"
+
+	"github.com/gocql/gocql"
+)
+
+// StarCanvas stars a canvas the user can read, so it shows up under the starred filter
+func StarCanvas(session *gocql.Session) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.UserIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			logging.Printf(r.Context(), "User ID not found in context")
+			return
+		}
+		canvasID, ok := canvasIDFromRequest(w, r)
+		if !ok {
+			return
+		}
+
+		ownerID, _, err := resolveCanvasAccess(session, userID, canvasID)
+		if err == errCanvasNotFound {
+			http.Error(w, "Canvas not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to fetch canvas", http.StatusInternalServerError)
+			logging.Errorf(r.Context(), "Error resolving access to canvas %s: %v", canvasID, err)
+			return
+		}
+
+		err = session.Query(
+			`INSERT INTO canvas_stars (user_id, canvas_id, owner_id) VALUES (?, ?, ?)`,
+			userID, canvasID, ownerID,
+		).Exec()
+		if err != nil {
+			http.Error(w, "Failed to star canvas", http.StatusInternalServerError)
+			logging.Errorf(r.Context(), "Error starring canvas %s: %v", canvasID, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// UnstarCanvas removes a canvas from the user's starred canvases
+func UnstarCanvas(session *gocql.Session) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.UserIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			logging.Printf(r.Context(), "User ID not found in context")
+			return
+		}
+		canvasID, ok := canvasIDFromRequest(w, r)
+		if !ok {
+			return
+		}
+
+		err := session.Query(
+			`DELETE FROM canvas_stars WHERE user_id = ? AND canvas_id = ?`,
+			userID, canvasID,
+		).Exec()
+		if err != nil {
+			http.Error(w, "Failed to unstar canvas", http.StatusInternalServerError)
+			logging.Errorf(r.Context(), "Error unstarring canvas %s: %v", canvasID, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"canvas-api/models"
+	"canvas-api/templates"
+	"shared/auth"
+	"shared/logging"
+
+	"github.com/gocql/gocql"
+	"github.com/gorilla/mux"
+)
+
+// errTemplateNotFound is returned when a template doesn't exist or belongs to another user
+var errTemplateNotFound = errors.New("template not found")
+
+// loadTemplate resolves a template ID to a system template or one of the user's saved templates.
+// System templates have slug IDs; user templates are identified by UUID.
+func loadTemplate(session *gocql.Session, userID, templateID string) (templates.Template, error) {
+	uuid, err := gocql.ParseUUID(templateID)
+	if err != nil {
+		if t, ok := templates.SystemTemplate(templateID); ok {
+			return t, nil
+		}
+		return templates.Template{}, errTemplateNotFound
+	}
+
+	var t templates.Template
+	var sourceCanvasID gocql.UUID
+	var createdAt time.Time
+	var svgData []models.SVGData
+	err = session.Query(
+		`SELECT name, description, source_canvas_id, created_at, svg_data
+		FROM canvas_templates WHERE user_id = ? AND template_id = ?`,
+		userID, uuid,
+	).Consistency(gocql.One).Scan(&t.Name, &t.Description, &sourceCanvasID, &createdAt, &svgData)
+	if err == gocql.ErrNotFound {
+		return templates.Template{}, errTemplateNotFound
+	} else if err != nil {
+		return templates.Template{}, err
+	}
+
+	t.TemplateID = uuid.String()
+	t.SourceCanvasID = &sourceCanvasID
+	t.CreatedAt = &createdAt
+	for _, data := range svgData {
+		t.Elements = append(t.Elements, data.SVGContent)
+	}
+	t.ElementCount = len(t.Elements)
+	return t, nil
+}
+
+// countTemplateElements counts the elements of a template saved before
+// element_count was stored, and stores the count so it is only done once
+func countTemplateElements(session *gocql.Session, userID string, templateID gocql.UUID) (int, error) {
+	var svgData []models.SVGData
+	err := session.Query(
+		`SELECT svg_data FROM canvas_templates WHERE user_id = ? AND template_id = ?`,
+		userID, templateID,
+	).Scan(&svgData)
+	if err != nil {
+		return 0, err
+	}
+	err = session.Query(
+		`UPDATE canvas_templates SET element_count = ? WHERE user_id = ? AND template_id = ?`,
+		len(svgData), userID, templateID,
+	).Exec()
+	return len(svgData), err
+}
+
+// ListTemplates returns the system templates followed by the user's saved templates
+func ListTemplates(session *gocql.Session) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.UserIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			logging.Printf(r.Context(), "User ID not found in context")
+			return
+		}
+
+		var list []templates.Template
+		for _, t := range templates.System() {
+			list = append(list, t.Summary())
+		}
+
+		iter := session.Query(
+			`SELECT template_id, name, description, source_canvas_id, created_at, element_count
+			FROM canvas_templates WHERE user_id = ?`,
+			userID,
+		).Iter()
+
+		var templateID, sourceCanvasID gocql.UUID
+		var name, description string
+		var createdAt time.Time
+		var elementCount *int
+		for iter.Scan(&templateID, &name, &description, &sourceCanvasID, &createdAt, &elementCount) {
+			sourceCanvasID, createdAt := sourceCanvasID, createdAt
+			t := templates.Template{
+				TemplateID:     templateID.String(),
+				Name:           name,
+				Description:    description,
+				SourceCanvasID: &sourceCanvasID,
+				CreatedAt:      &createdAt,
+			}
+			if elementCount != nil {
+				t.ElementCount = *elementCount
+			} else if count, err := countTemplateElements(session, userID, templateID); err != nil {
+				logging.Printf(r.Context(), "Error counting elements of template %s: %v", templateID, err)
+			} else {
+				t.ElementCount = count
+			}
+			list = append(list, t)
+		}
+		if err := iter.Close(); err != nil {
+			http.Error(w, "Failed to fetch templates", http.StatusInternalServerError)
+			logging.Errorf(r.Context(), "Error fetching templates for user %s: %v", userID, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(list); err != nil {
+			logging.Printf(r.Context(), "Error encoding templates for user %s: %v", userID, err)
+		}
+	}
+}
+
+// GetTemplate returns a template including its elements, for previewing
+func GetTemplate(session *gocql.Session) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.UserIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			logging.Printf(r.Context(), "User ID not found in context")
+			return
+		}
+
+		t, err := loadTemplate(session, userID, mux.Vars(r)["template_id"])
+		if err == errTemplateNotFound {
+			http.Error(w, "Template not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to fetch template", http.StatusInternalServerError)
+			logging.Errorf(r.Context(), "Error fetching template: %v", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(t)
+	}
+}
+
+// InstantiateTemplate creates a new canvas seeded with a template's content
+func InstantiateTemplate(session *gocql.Session) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.UserIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			logging.Printf(r.Context(), "User ID not found in context")
+			return
+		}
+
+		var requestData struct {
+			CanvasName string `json:"canvas_name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil && err != io.EOF {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			logging.Printf(r.Context(), "Error decoding request body: %v", err)
+			return
+		}
+
+		t, err := loadTemplate(session, userID, mux.Vars(r)["template_id"])
+		if err == errTemplateNotFound {
+			http.Error(w, "Template not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to fetch template", http.StatusInternalServerError)
+			logging.Errorf(r.Context(), "Error fetching template: %v", err)
+			return
+		}
+
+		canvasName := strings.TrimSpace(requestData.CanvasName)
+		if canvasName == "" {
+			canvasName = t.Name
+		}
+
+		now := time.Now()
+		canvasID := gocql.TimeUUID()
+		err = insertCanvas(session, &canvasRecord{
+			UserID:     userID,
+			CanvasID:   canvasID,
+			CanvasName: canvasName,
+			CreatedAt:  now,
+			SVGData:    t.SVGData(now),
+		})
+		if err != nil {
+			http.Error(w, "Failed to create canvas", http.StatusInternalServerError)
+			logging.Errorf(r.Context(), "Error inserting canvas from template %s: %v", t.TemplateID, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":     "Canvas created successfully",
+			"canvas_id":   canvasID,
+			"template_id": t.TemplateID,
+		})
+	}
+}
+
+// SaveTemplate saves the current content of a canvas the user can read as one of their templates
+func SaveTemplate(session *gocql.Session) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.UserIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			logging.Printf(r.Context(), "User ID not found in context")
+			return
+		}
+
+		canvasID, err := gocql.ParseUUID(mux.Vars(r)["canvas_id"])
+		if err != nil {
+			http.Error(w, "Invalid canvas ID", http.StatusBadRequest)
+			return
+		}
+
+		var requestData struct {
+			Name        string `json:"name"`
+			Description string `json:"description"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil && err != io.EOF {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			logging.Printf(r.Context(), "Error decoding request body: %v", err)
+			return
+		}
+
+		ownerID, _, err := resolveCanvasAccess(session, userID, canvasID)
+		if err == errCanvasNotFound {
+			http.Error(w, "Canvas not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to fetch canvas", http.StatusInternalServerError)
+			logging.Errorf(r.Context(), "Error resolving access to canvas %s: %v", canvasID, err)
+			return
+		}
+
+		var canvasName string
+		var history []models.SVGData
+		err = session.Query(
+			`SELECT canvas_name, svg_data FROM canvases WHERE user_id = ? AND canvas_id = ?`,
+			ownerID, canvasID,
+		).Scan(&canvasName, &history)
+		if err != nil {
+			http.Error(w, "Failed to fetch canvas", http.StatusInternalServerError)
+			logging.Errorf(r.Context(), "Error fetching canvas %s: %v", canvasID, err)
+			return
+		}
+
+		name := strings.TrimSpace(requestData.Name)
+		if name == "" {
+			name = canvasName
+		}
+
+		svgData := currentElements(history)
+		templateID := gocql.TimeUUID()
+		err = session.Query(
+			`INSERT INTO canvas_templates (user_id, template_id, name, description, source_canvas_id, created_at, svg_data, element_count)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			userID, templateID, name, requestData.Description, canvasID, time.Now(), svgData, len(svgData),
+		).Exec()
+		if err != nil {
+			http.Error(w, "Failed to save template", http.StatusInternalServerError)
+			logging.Errorf(r.Context(), "Error saving template from canvas %s: %v", canvasID, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":     "Template saved successfully",
+			"template_id": templateID,
+		})
+	}
+}
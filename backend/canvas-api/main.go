@@ -2,10 +2,13 @@ package main
 
 import (
 	"canvas-api/config"
+	"canvas-api/handlers"
 	"canvas-api/routes"
+	"canvas-api/templates"
 	"log"
 	"net/http"
 	"os"
+	"shared/logging"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/gorilla/mux"
@@ -16,20 +19,20 @@ var drawingRedisClient *redis.Client
 var authRedisClient *redis.Client
 
 func main() {
-	// Load Redis configurations for both instances
-	// For the drawing Redis instance
-	drawingRedisHost := os.Getenv("DRAWING_REDIS_HOST")
-	drawingRedisPort := os.Getenv("DRAWING_REDIS_PORT")
-	drawingRedisPassword := os.Getenv("DRAWING_REDIS_PASSWORD")
+	// Initialize structured, redacting logging
+	logging.Init("canvas-api")
 
-	// For the authentication Redis instance
-	authRedisHost := os.Getenv("AUTH_REDIS_HOST")
-	authRedisPort := os.Getenv("AUTH_REDIS_PORT")
-	authRedisPassword := os.Getenv("AUTH_REDIS_PASSWORD")
+	// Load where the access token keys are published
+	config.InitConfig()
 
-	// Initialize Redis clients
-	drawingRedisClient = config.InitRedis(drawingRedisHost, drawingRedisPort, drawingRedisPassword)
-	authRedisClient = config.InitRedis(authRedisHost, authRedisPort, authRedisPassword)
+	// Parse the built-in templates so a broken one stops the service here
+	if err := templates.Load(); err != nil {
+		log.Fatalf("Failed to load system templates: %v", err)
+	}
+
+	// Initialize Redis clients for the drawing and authentication instances
+	drawingRedisClient = config.InitRedis("DRAWING")
+	authRedisClient = config.InitRedis("AUTH")
 
 	// Initialize Cassandra
 	session, err := config.SetupCassandraSession()
@@ -38,8 +41,18 @@ func main() {
 	}
 	defer session.Close()
 
+	// Index canvases written before the listing indexes existed
+	if config.BackfillIndexes() {
+		go func() {
+			if err := handlers.BackfillCanvasIndexes(session); err != nil {
+				log.Printf("Canvas index backfill failed: %v", err)
+			}
+		}()
+	}
+
 	// Create the router
 	r := mux.NewRouter()
+	r.Use(logging.Middleware)
 
 	// Pass Redis clients to your routes
 	routes.RegisterCanvasRoutes(r, session, drawingRedisClient, authRedisClient)
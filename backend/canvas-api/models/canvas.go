@@ -1,10 +1,32 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"github.com/gocql/gocql"
+)
 
 // Canvas struct represents the canvas creation request body
 type Canvas struct {
 	UserID     string    `json:"user_id"`
 	CanvasName string    `json:"canvas_name"`
 	CreatedAt  time.Time `json:"created_at"`
+	TemplateID string    `json:"template_id,omitempty"` // Optional template to seed the canvas with
+}
+
+// SVGData mirrors the svg_data_type UDT stored in a canvas's svg_data list.
+// Each entry records one action against an element, so the list doubles as
+// the canvas history.
+type SVGData struct {
+	SVGID      gocql.UUID `cql:"svg_id" json:"svg_id"`
+	SVGContent string     `cql:"svg_content" json:"svg_content"`
+	CreatedAt  time.Time  `cql:"created_at" json:"created_at"`
+	Action     string     `cql:"action" json:"action"`
 }
+
+// Actions recorded against an element in svg_data
+const (
+	ActionCreated = "created"
+	ActionUpdated = "updated"
+	ActionDeleted = "deleted"
+)
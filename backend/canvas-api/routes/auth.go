@@ -0,0 +1,46 @@
+package routes
+
+import (
+	"canvas-api/config"
+	"context"
+	"log"
+	"net/http"
+
+	"shared/auth"
+	"shared/jwks"
+	"shared/pat"
+	"shared/session"
+	"shared/token"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/gocql/gocql"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// newAuthMiddleware verifies access tokens against account-api's published
+// keys. In full mode each token's session is looked up in Redis; in stateless
+// mode it is checked against the in-memory revocation list instead. Personal
+// access tokens are looked up in Cassandra.
+func newAuthMiddleware(authRedisClient *redis.Client, cassandra *gocql.Session) func(http.Handler) http.Handler {
+	keys := jwks.New(config.AccountAPIJWKSURL, jwks.Options{})
+	verifier := &token.Verifier{
+		Keyfunc:   keys.Keyfunc,
+		Algorithm: jwt.SigningMethodRS256.Alg(),
+		Issuer:    config.JWT.Issuer,
+		Audience:  config.JWT.Audience,
+		ClockSkew: config.JWT.ClockSkew,
+	}
+
+	var sessions auth.SessionVerifier
+	if config.JWTVerificationMode == config.VerificationStateless {
+		revocations, err := session.NewRevocationList(context.Background(), authRedisClient)
+		if err != nil {
+			log.Fatalf("Failed to load revoked sessions: %v", err)
+		}
+		sessions = revocations
+	} else {
+		// Sessions are only read here, so the lifetime policy is never consulted
+		sessions = session.NewStore(authRedisClient, token.DefaultPolicy())
+	}
+	return auth.Middleware(verifier, sessions, pat.NewStore(cassandra))
+}
@@ -1,33 +1,120 @@
 package routes
 
 import (
-	"canvas-api/auth"
 	"canvas-api/handlers"
 	"github.com/go-redis/redis/v8"
 	"github.com/gocql/gocql"
 	"github.com/gorilla/mux"
 	"net/http"
+	"shared/auth"
+	"shared/pat"
 )
 
 func RegisterCanvasRoutes(r *mux.Router, session *gocql.Session, drawingRedisClient, authRedisClient *redis.Client) {
-	// Middleware with the authRedisClient
-	authMiddleware := auth.JWTMiddleware(authRedisClient)
+	// Middleware with the authRedisClient. Personal access tokens need the
+	// canvas:read scope for reads and canvas:write for everything else.
+	authMiddleware := newAuthMiddleware(authRedisClient, session)
+	canRead := func(next http.Handler) http.Handler {
+		return authMiddleware(auth.RequireScope(pat.ScopeCanvasRead)(next))
+	}
+	canWrite := func(next http.Handler) http.Handler {
+		return authMiddleware(auth.RequireScope(pat.ScopeCanvasWrite)(next))
+	}
 
 	// Route to create a new canvas
-	r.Handle("/create", authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	r.Handle("/create", canWrite(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		handlers.CreateCanvas(session).ServeHTTP(w, r)
 	}))).Methods("POST")
 
-	// Route to get all canvases for a user
-	r.Handle("/canvases", authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	// Route to get a page of canvases for a user, see handlers.GetCanvasesByUserID for query parameters
+	r.Handle("/canvases", canRead(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		handlers.GetCanvasesByUserID(session).ServeHTTP(w, r)
 	}))).Methods("GET")
 
 	// Route to stage a canvas, uses drawingRedisClient
-	r.Handle("/stage", authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	r.Handle("/stage", canWrite(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		handlers.StageCanvas(session, drawingRedisClient).ServeHTTP(w, r)
 	}))).Methods("POST")
 
+	// Route to rename a canvas or change its description and background
+	r.Handle("/canvases/{canvas_id}", canWrite(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlers.UpdateCanvas(session).ServeHTTP(w, r)
+	}))).Methods("PATCH")
+
+	// Route to move a canvas to the trash, uses drawingRedisClient to tear down staged copies
+	r.Handle("/canvases/{canvas_id}", canWrite(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlers.DeleteCanvas(session, drawingRedisClient).ServeHTTP(w, r)
+	}))).Methods("DELETE")
+
+	// Route to list canvases in the trash
+	r.Handle("/trash", canRead(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlers.ListTrash(session).ServeHTTP(w, r)
+	}))).Methods("GET")
+
+	// Route to restore a canvas from the trash
+	r.Handle("/trash/{canvas_id}/restore", canWrite(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlers.RestoreCanvas(session).ServeHTTP(w, r)
+	}))).Methods("POST")
+
+	// Route to permanently delete a canvas from the trash
+	r.Handle("/trash/{canvas_id}", canWrite(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlers.PurgeCanvas(session).ServeHTTP(w, r)
+	}))).Methods("DELETE")
+
+	// Routes to star and unstar a canvas
+	r.Handle("/canvases/{canvas_id}/star", canWrite(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlers.StarCanvas(session).ServeHTTP(w, r)
+	}))).Methods("PUT")
+	r.Handle("/canvases/{canvas_id}/star", canWrite(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlers.UnstarCanvas(session).ServeHTTP(w, r)
+	}))).Methods("DELETE")
+
+	// Routes to list, grant and revoke other users' access to a canvas the caller owns
+	r.Handle("/canvases/{canvas_id}/shares", canRead(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlers.ListCanvasShares(session).ServeHTTP(w, r)
+	}))).Methods("GET")
+	r.Handle("/canvases/{canvas_id}/shares/{user_id}", canWrite(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlers.ShareCanvas(session).ServeHTTP(w, r)
+	}))).Methods("PUT")
+	r.Handle("/canvases/{canvas_id}/shares/{user_id}", canWrite(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlers.UnshareCanvas(session).ServeHTTP(w, r)
+	}))).Methods("DELETE")
+
+	// Route to duplicate a canvas into a new canvas owned by the caller
+	r.Handle("/canvases/{canvas_id}/duplicate", canWrite(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlers.DuplicateCanvas(session).ServeHTTP(w, r)
+	}))).Methods("POST")
+
+	// Route to export a canvas as an Excalidraw file
+	r.Handle("/canvases/{canvas_id}/export/excalidraw", canRead(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlers.ExportExcalidraw(session).ServeHTTP(w, r)
+	}))).Methods("GET")
+
+	// Route to create a canvas from an Excalidraw file
+	r.Handle("/import/excalidraw", canWrite(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlers.ImportExcalidraw(session).ServeHTTP(w, r)
+	}))).Methods("POST")
+
+	// Route to list system and saved templates
+	r.Handle("/templates", canRead(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlers.ListTemplates(session).ServeHTTP(w, r)
+	}))).Methods("GET")
+
+	// Route to preview a template
+	r.Handle("/templates/{template_id}", canRead(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlers.GetTemplate(session).ServeHTTP(w, r)
+	}))).Methods("GET")
+
+	// Route to create a canvas from a template
+	r.Handle("/templates/{template_id}/instantiate", canWrite(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlers.InstantiateTemplate(session).ServeHTTP(w, r)
+	}))).Methods("POST")
+
+	// Route to save a canvas as a template
+	r.Handle("/canvases/{canvas_id}/template", canWrite(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlers.SaveTemplate(session).ServeHTTP(w, r)
+	}))).Methods("POST")
+
 	// Route to get staged canvas by staging ID, no authMiddleware
 	r.Handle("/staged/{staging_id}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		handlers.GetStagedCanvas(drawingRedisClient).ServeHTTP(w, r)
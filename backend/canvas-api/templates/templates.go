@@ -0,0 +1,122 @@
+package templates
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"canvas-api/models"
+
+	"github.com/gocql/gocql"
+)
+
+//go:embed system/*.json
+var systemFiles embed.FS
+
+// Template is a reusable canvas layout. System templates ship with the
+// service; user templates are saved from a canvas and stored in Cassandra.
+type Template struct {
+	TemplateID     string      `json:"template_id"`
+	Name           string      `json:"name"`
+	Description    string      `json:"description"`
+	Category       string      `json:"category,omitempty"`
+	System         bool        `json:"system"`
+	SourceCanvasID *gocql.UUID `json:"source_canvas_id,omitempty"`
+	CreatedAt      *time.Time  `json:"created_at,omitempty"`
+	ElementCount   int         `json:"element_count"`
+	Elements       []string    `json:"elements,omitempty"`
+}
+
+// systemTemplate is the on-disk format of an embedded template
+type systemTemplate struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Category    string   `json:"category"`
+	Elements    []string `json:"elements"`
+}
+
+// system holds the built-in templates once Load has parsed them
+var system []Template
+
+// Load parses the embedded system templates. It is called once at startup,
+// before the server handles requests.
+func Load() error {
+	loaded, err := loadSystem()
+	if err != nil {
+		return err
+	}
+	system = loaded
+	return nil
+}
+
+// System returns the built-in templates, sorted by name
+func System() []Template {
+	return system
+}
+
+// SystemTemplate looks up a built-in template by ID
+func SystemTemplate(id string) (Template, bool) {
+	for _, t := range System() {
+		if t.TemplateID == id {
+			return t, true
+		}
+	}
+	return Template{}, false
+}
+
+func loadSystem() ([]Template, error) {
+	entries, err := systemFiles.ReadDir("system")
+	if err != nil {
+		return nil, err
+	}
+
+	var loaded []Template
+	for _, entry := range entries {
+		raw, err := systemFiles.ReadFile("system/" + entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		var st systemTemplate
+		if err := json.Unmarshal(raw, &st); err != nil {
+			return nil, fmt.Errorf("invalid template %s: %w", entry.Name(), err)
+		}
+		if st.ID == "" {
+			return nil, fmt.Errorf("invalid template %s: missing id", entry.Name())
+		}
+		loaded = append(loaded, Template{
+			TemplateID:   st.ID,
+			Name:         st.Name,
+			Description:  st.Description,
+			Category:     st.Category,
+			System:       true,
+			ElementCount: len(st.Elements),
+			Elements:     st.Elements,
+		})
+	}
+
+	sort.Slice(loaded, func(i, j int) bool { return loaded[i].Name < loaded[j].Name })
+	return loaded, nil
+}
+
+// SVGData turns a template's elements into fresh svg_data entries for a new canvas
+func (t Template) SVGData(now time.Time) []models.SVGData {
+	svgData := make([]models.SVGData, len(t.Elements))
+	for i, content := range t.Elements {
+		svgData[i] = models.SVGData{
+			SVGID:      gocql.TimeUUID(),
+			SVGContent: content,
+			CreatedAt:  now,
+			Action:     models.ActionCreated,
+		}
+	}
+	return svgData
+}
+
+// Summary returns the template without its elements, for listings
+func (t Template) Summary() Template {
+	t.Elements = nil
+	return t
+}
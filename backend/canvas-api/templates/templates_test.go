@@ -0,0 +1,103 @@
+package templates
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"canvas-api/models"
+)
+
+func TestSystemTemplatesParse(t *testing.T) {
+	entries, err := systemFiles.ReadDir("system")
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	if len(entries) == 0 {
+		t.Fatal("no system templates embedded")
+	}
+
+	// Each file on its own, so a broken one is named
+	for _, entry := range entries {
+		t.Run(entry.Name(), func(t *testing.T) {
+			raw, err := systemFiles.ReadFile("system/" + entry.Name())
+			if err != nil {
+				t.Fatalf("ReadFile: %v", err)
+			}
+			var st systemTemplate
+			if err := json.Unmarshal(raw, &st); err != nil {
+				t.Fatalf("invalid JSON: %v", err)
+			}
+			if st.ID == "" || st.Name == "" {
+				t.Fatalf("missing id or name: %+v", st)
+			}
+			if len(st.Elements) == 0 {
+				t.Fatal("no elements")
+			}
+			for i, element := range st.Elements {
+				if !strings.HasPrefix(element, "<") || !strings.HasSuffix(element, ">") {
+					t.Errorf("element %d is not SVG markup: %q", i, element)
+				}
+			}
+		})
+	}
+
+	if err := Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(System()) != len(entries) {
+		t.Fatalf("loaded %d templates from %d files", len(System()), len(entries))
+	}
+	seen := make(map[string]bool)
+	for i, template := range System() {
+		if seen[template.TemplateID] {
+			t.Errorf("duplicate template ID %q", template.TemplateID)
+		}
+		seen[template.TemplateID] = true
+		if i > 0 && System()[i-1].Name > template.Name {
+			t.Errorf("templates not sorted by name: %q before %q", System()[i-1].Name, template.Name)
+		}
+		if _, ok := SystemTemplate(template.TemplateID); !ok {
+			t.Errorf("SystemTemplate(%q) not found", template.TemplateID)
+		}
+	}
+}
+
+func TestInstantiateSystemTemplate(t *testing.T) {
+	if err := Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	template, ok := SystemTemplate("kanban")
+	if !ok {
+		t.Fatal("kanban template not found")
+	}
+
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	svgData := template.SVGData(now)
+	if len(svgData) != template.ElementCount || len(svgData) != len(template.Elements) {
+		t.Fatalf("%d svg_data entries for %d elements", len(svgData), template.ElementCount)
+	}
+	ids := make(map[string]bool)
+	for i, data := range svgData {
+		if data.SVGContent != template.Elements[i] {
+			t.Errorf("entry %d content = %q, want the template's element", i, data.SVGContent)
+		}
+		if data.Action != models.ActionCreated || !data.CreatedAt.Equal(now) {
+			t.Errorf("entry %d = %s at %v, want created at %v", i, data.Action, data.CreatedAt, now)
+		}
+		if ids[data.SVGID.String()] {
+			t.Errorf("entry %d reuses ID %s", i, data.SVGID)
+		}
+		ids[data.SVGID.String()] = true
+	}
+
+	// A second canvas from the same template gets its own element IDs
+	again := template.SVGData(now)
+	if again[0].SVGID == svgData[0].SVGID {
+		t.Fatal("instantiating twice reused element IDs")
+	}
+	if template.Summary().Elements != nil || template.Summary().ElementCount != template.ElementCount {
+		t.Fatal("Summary should drop the elements and keep the count")
+	}
+}
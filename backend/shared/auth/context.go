@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"context"
+)
+
+// Context key type to avoid context key collisions
+type contextKey string
+
+const (
+	userIDKey    contextKey = "userID"
+	sessionIDKey contextKey = "sessionID"
+	scopesKey    contextKey = "scopes"
+)
+
+// SetUserIDInContext adds the userID to the context.
+func SetUserIDInContext(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, userIDKey, userID)
+}
+
+// UserIDFromContext retrieves the userID from the context.
+func UserIDFromContext(ctx context.Context) (string, bool) {
+	userID, ok := ctx.Value(userIDKey).(string)
+	return userID, ok
+}
+
+// SetSessionIDInContext adds the caller's session ID to the context.
+func SetSessionIDInContext(ctx context.Context, sessionID string) context.Context {
+	return context.WithValue(ctx, sessionIDKey, sessionID)
+}
+
+// SessionIDFromContext retrieves the caller's session ID from the context.
+func SessionIDFromContext(ctx context.Context) (string, bool) {
+	sessionID, ok := ctx.Value(sessionIDKey).(string)
+	return sessionID, ok
+}
+
+// setScopesInContext restricts the request to the scopes of the personal
+// access token it was made with.
+func setScopesInContext(ctx context.Context, scopes []string) context.Context {
+	return context.WithValue(ctx, scopesKey, scopes)
+}
+
+// HasScope reports whether the request may use scope. Only personal access
+// tokens are restricted; session JWTs have every scope.
+func HasScope(ctx context.Context, scope string) bool {
+	scopes, restricted := ctx.Value(scopesKey).([]string)
+	if !restricted {
+		return true
+	}
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
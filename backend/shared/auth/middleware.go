@@ -0,0 +1,108 @@
+// Package auth holds the access token middleware every service puts in
+// front of its authenticated routes, and the context helpers handlers use to
+// find the caller.
+package auth
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+
+	"shared/logging"
+	"shared/pat"
+	"shared/token"
+)
+
+// SessionVerifier decides whether the session a token belongs to is still
+// live: session.Store looks it up in Redis, session.RevocationList checks
+// the synced list of revoked sessions
+type SessionVerifier interface {
+	Verify(ctx context.Context, sessionID, userID string) error
+}
+
+// PersonalAccessTokens authenticates personal access tokens; pat.Store
+// implements it
+type PersonalAccessTokens interface {
+	Authenticate(ctx context.Context, raw string) (*pat.Token, error)
+}
+
+// JWTMiddleware verifies the bearer token and its session, then puts the user
+// ID and session ID in the request context
+func JWTMiddleware(verifier *token.Verifier, sessions SessionVerifier) func(http.Handler) http.Handler {
+	return Middleware(verifier, sessions, nil)
+}
+
+// Middleware is JWTMiddleware that also accepts personal access tokens when
+// pats is set. For those the token's scopes are put in the request context
+// for RequireScope to enforce; session JWTs carry every scope.
+func Middleware(verifier *token.Verifier, sessions SessionVerifier, pats PersonalAccessTokens) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authHeader := r.Header.Get("Authorization")
+			if !strings.HasPrefix(authHeader, "Bearer ") {
+				http.Error(w, "Authorization header must start with 'Bearer '", http.StatusUnauthorized)
+				return
+			}
+			tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+
+			if pats != nil && strings.HasPrefix(tokenString, pat.Prefix) {
+				accessToken, err := pats.Authenticate(r.Context(), tokenString)
+				if err == pat.ErrNotFound {
+					w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+					http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+					return
+				} else if err != nil {
+					http.Error(w, "Failed to validate token", http.StatusInternalServerError)
+					log.Printf("Personal access token validation failed: %v", err)
+					return
+				}
+				logging.SetUserID(r.Context(), accessToken.UserID)
+
+				ctx := SetUserIDInContext(r.Context(), accessToken.UserID)
+				ctx = setScopesInContext(ctx, accessToken.Scopes)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+
+			// Verify the signature and claims
+			claims, err := verifier.Verify(r.Context(), tokenString)
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				http.Error(w, token.UnauthorizedMessage(err), http.StatusUnauthorized)
+				log.Printf("JWT validation failed: %v", err)
+				return
+			}
+
+			// The verifier has checked that both are present
+			userID, _ := claims["sub"].(string)
+			sessionID, _ := claims["jti"].(string)
+			logging.SetUserID(r.Context(), userID)
+
+			if err := sessions.Verify(r.Context(), sessionID, userID); err != nil {
+				http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+				log.Printf("Session %s of user %s failed validation: %v", sessionID, userID, err)
+				return
+			}
+
+			ctx := SetUserIDInContext(r.Context(), userID)
+			ctx = SetSessionIDInContext(ctx, sessionID)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequireScope rejects requests made with a personal access token that was
+// not granted scope. Requests authenticated with a session JWT always pass.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !HasScope(r.Context(), scope) {
+				w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+scope+`"`)
+				http.Error(w, "Token is missing the "+scope+" scope", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
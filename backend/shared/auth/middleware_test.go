@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"shared/pat"
+)
+
+// fakePATs accepts a single token with the given scopes
+type fakePATs struct {
+	raw    string
+	scopes []string
+}
+
+func (f fakePATs) Authenticate(ctx context.Context, raw string) (*pat.Token, error) {
+	if raw != f.raw {
+		return nil, pat.ErrNotFound
+	}
+	return &pat.Token{UserID: "user-1", TokenID: "token-1", Scopes: f.scopes}, nil
+}
+
+// serveWithScope runs a request bearing token through Middleware and
+// RequireScope(scope)
+func serveWithScope(t *testing.T, pats PersonalAccessTokens, token, scope string) *httptest.ResponseRecorder {
+	t.Helper()
+	handler := Middleware(nil, nil, pats)(RequireScope(scope)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if userID, _ := UserIDFromContext(r.Context()); userID != "user-1" {
+			t.Errorf("user ID in context = %q", userID)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})))
+	r := httptest.NewRequest(http.MethodGet, "/canvases", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestRequireScope(t *testing.T) {
+	readOnly := fakePATs{raw: pat.Prefix + "read", scopes: []string{pat.ScopeCanvasRead}}
+
+	if w := serveWithScope(t, readOnly, readOnly.raw, pat.ScopeCanvasRead); w.Code != http.StatusNoContent {
+		t.Fatalf("granted scope: status %d, want 204", w.Code)
+	}
+
+	w := serveWithScope(t, readOnly, readOnly.raw, pat.ScopeCanvasWrite)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("missing scope: status %d, want 403", w.Code)
+	}
+	if !strings.Contains(w.Header().Get("WWW-Authenticate"), `scope="`+pat.ScopeCanvasWrite+`"`) {
+		t.Errorf("WWW-Authenticate = %q, want the missing scope named", w.Header().Get("WWW-Authenticate"))
+	}
+
+	if w := serveWithScope(t, readOnly, pat.Prefix+"unknown", pat.ScopeCanvasRead); w.Code != http.StatusUnauthorized {
+		t.Fatalf("unknown token: status %d, want 401", w.Code)
+	}
+}
+
+func TestRequireScopeAllowsSessionTokens(t *testing.T) {
+	// Requests authenticated with a session JWT carry no scope restriction
+	handler := RequireScope(pat.ScopeCanvasWrite)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	r := httptest.NewRequest(http.MethodPost, "/canvases", nil)
+	r = r.WithContext(SetUserIDInContext(r.Context(), "user-1"))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("session request: status %d, want 204", w.Code)
+	}
+}
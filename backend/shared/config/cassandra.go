@@ -0,0 +1,14 @@
+package config
+
+import (
+	"github.com/gocql/gocql"
+)
+
+// NewCassandraSession connects to the cluster at CASSANDRA_HOST (the in-cluster
+// service by default) using the CASSANDRA_KEYSPACE keyspace
+func NewCassandraSession() (*gocql.Session, error) {
+	cluster := gocql.NewCluster(EnvOrDefault("CASSANDRA_HOST", "cassandra.db.svc.cluster.local"))
+	cluster.Keyspace = EnvOrDefault("CASSANDRA_KEYSPACE", "canvas_collab")
+	cluster.Consistency = gocql.Quorum
+	return cluster.CreateSession()
+}
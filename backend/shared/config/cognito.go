@@ -0,0 +1,64 @@
+package config
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider"
+)
+
+// Cognito is the user pool a service talks to
+type Cognito struct {
+	AWSConfig       aws.Config
+	Client          *cognitoidentityprovider.Client
+	Region          string
+	UserPoolID      string
+	AppClientID     string
+	AppClientSecret string
+}
+
+// LoadCognito reads AWS_REGION, COGNITO_USER_POOL_ID, COGNITO_APP_CLIENT_ID and
+// COGNITO_APP_CLIENT_SECRET and creates the Cognito client
+func LoadCognito(ctx context.Context) (*Cognito, error) {
+	cognito := &Cognito{
+		Region:          os.Getenv("AWS_REGION"),
+		UserPoolID:      os.Getenv("COGNITO_USER_POOL_ID"),
+		AppClientID:     os.Getenv("COGNITO_APP_CLIENT_ID"),
+		AppClientSecret: os.Getenv("COGNITO_APP_CLIENT_SECRET"),
+	}
+	if cognito.Region == "" {
+		return nil, errors.New("AWS_REGION environment variable is not set")
+	}
+	if cognito.UserPoolID == "" || cognito.AppClientID == "" || cognito.AppClientSecret == "" {
+		return nil, errors.New("Cognito environment variables are not set. Please set COGNITO_USER_POOL_ID, COGNITO_APP_CLIENT_ID, and COGNITO_APP_CLIENT_SECRET")
+	}
+
+	var err error
+	cognito.AWSConfig, err = awsconfig.LoadDefaultConfig(ctx, awsconfig.WithRegion(cognito.Region))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS configuration: %v", err)
+	}
+	cognito.Client = cognitoidentityprovider.NewFromConfig(cognito.AWSConfig)
+	return cognito, nil
+}
+
+// SecretHash is the SECRET_HASH Cognito requires for every call made with an
+// app client that has a secret: HMAC-SHA256 of username+client ID keyed with
+// the client secret
+func (c *Cognito) SecretHash(username string) string {
+	return CognitoSecretHash(c.AppClientID, c.AppClientSecret, username)
+}
+
+// CognitoSecretHash computes the SECRET_HASH for an app client
+func CognitoSecretHash(clientID, clientSecret, username string) string {
+	mac := hmac.New(sha256.New, []byte(clientSecret))
+	mac.Write([]byte(username + clientID))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,40 @@
+// Package config loads the settings and clients every service shares from
+// the environment. Loaders return errors; the services decide whether a
+// missing setting is fatal.
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// EnvOrDefault returns the variable's value, or fallback when it is unset
+func EnvOrDefault(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// DurationFromEnv reads a Go duration such as "15m", falling back when unset
+func DurationFromEnv(name string, fallback time.Duration) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative duration, got %q", name, value)
+	}
+	return duration, nil
+}
+
+// DevMode reports whether DEV_MODE is true. Shortcuts that are only safe on a
+// developer machine or in CI are gated on it, so none can be switched on in
+// production by leaving a setting out.
+func DevMode() bool {
+	dev, _ := strconv.ParseBool(os.Getenv("DEV_MODE"))
+	return dev
+}
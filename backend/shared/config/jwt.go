@@ -0,0 +1,28 @@
+package config
+
+import (
+	"time"
+)
+
+// JWT holds the claims every access token carries and every verifier checks
+type JWT struct {
+	// Issuer is the iss claim, the service that mints access tokens
+	Issuer string
+	// Audience is the aud claim, the services the tokens are for
+	Audience string
+	// ClockSkew is how far token timestamps may be off from the local clock
+	ClockSkew time.Duration
+}
+
+// LoadJWT reads JWT_ISSUER, JWT_AUDIENCE and JWT_CLOCK_SKEW
+func LoadJWT() (JWT, error) {
+	skew, err := DurationFromEnv("JWT_CLOCK_SKEW", 30*time.Second)
+	if err != nil {
+		return JWT{}, err
+	}
+	return JWT{
+		Issuer:    EnvOrDefault("JWT_ISSUER", "account-api"),
+		Audience:  EnvOrDefault("JWT_AUDIENCE", "canvis-collab"),
+		ClockSkew: skew,
+	}, nil
+}
@@ -0,0 +1,27 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// TrustedProxiesFromEnv reads TRUSTED_PROXIES, the comma-separated CIDRs of
+// the proxies in front of a service whose X-Forwarded-For entries are
+// believed. An empty list means only the connection's own address is used.
+func TrustedProxiesFromEnv() ([]*net.IPNet, error) {
+	var proxies []*net.IPNet
+	for _, cidr := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TRUSTED_PROXIES entry %q: %w", cidr, err)
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies, nil
+}
@@ -0,0 +1,34 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// NewRedisClient connects to Redis and checks the connection with a ping
+func NewRedisClient(ctx context.Context, host, port, password string) (*redis.Client, error) {
+	addr := host + ":" + port
+	client := redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Password: password,
+		DB:       0, // Use default DB
+	})
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to Redis at %s: %v", addr, err)
+	}
+	return client, nil
+}
+
+// RedisFromEnv connects to the Redis instance described by <prefix>_REDIS_HOST,
+// <prefix>_REDIS_PORT and <prefix>_REDIS_PASSWORD, e.g. AUTH or DRAWING
+func RedisFromEnv(ctx context.Context, prefix string) (*redis.Client, error) {
+	return NewRedisClient(ctx,
+		os.Getenv(prefix+"_REDIS_HOST"),
+		os.Getenv(prefix+"_REDIS_PORT"),
+		os.Getenv(prefix+"_REDIS_PASSWORD"),
+	)
+}
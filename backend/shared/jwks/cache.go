@@ -0,0 +1,191 @@
+package jwks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// ErrKeyNotFound is returned when the JWKS has no key with the requested kid
+var ErrKeyNotFound = errors.New("no matching key in JWKS")
+
+// Options tunes a Cache. Zero values fall back to the defaults below.
+type Options struct {
+	// TTL is how long a fetched key set is used before it is refreshed
+	TTL time.Duration
+	// NegativeTTL is how long an unknown kid is remembered as missing
+	NegativeTTL time.Duration
+	// MinRefreshInterval bounds how often an unknown kid can force a refetch
+	MinRefreshInterval time.Duration
+	// HTTPClient fetches the key set; its timeout bounds every refresh
+	HTTPClient *http.Client
+}
+
+const (
+	defaultTTL                = time.Hour
+	defaultNegativeTTL        = 5 * time.Minute
+	defaultMinRefreshInterval = 30 * time.Second
+	defaultFetchTimeout       = 5 * time.Second
+)
+
+// Cache holds the public keys served at a JWKS URL. Keys are refetched when
+// the TTL runs out, in the background so callers keep using the old set, and
+// when a token names a kid the cache has not seen, at most once per
+// MinRefreshInterval.
+type Cache struct {
+	url     string
+	options Options
+
+	mu         sync.RWMutex
+	keys       map[string]interface{}
+	fetchedAt  time.Time
+	attemptAt  time.Time
+	missing    map[string]time.Time
+	refreshing bool
+
+	// fetchMu lets only one caller fetch at a time
+	fetchMu sync.Mutex
+
+	// now is the clock, replaced in tests
+	now func() time.Time
+}
+
+// New creates a cache for the key set at url. Nothing is fetched until the
+// first lookup.
+func New(url string, options Options) *Cache {
+	if options.TTL <= 0 {
+		options.TTL = defaultTTL
+	}
+	if options.NegativeTTL <= 0 {
+		options.NegativeTTL = defaultNegativeTTL
+	}
+	if options.MinRefreshInterval <= 0 {
+		options.MinRefreshInterval = defaultMinRefreshInterval
+	}
+	if options.HTTPClient == nil {
+		options.HTTPClient = &http.Client{Timeout: defaultFetchTimeout}
+	}
+	return &Cache{
+		url:     url,
+		options: options,
+		keys:    make(map[string]interface{}),
+		missing: make(map[string]time.Time),
+		now:     time.Now,
+	}
+}
+
+// Key returns the public key for kid, an *rsa.PublicKey or *ecdsa.PublicKey
+func (c *Cache) Key(ctx context.Context, kid string) (interface{}, error) {
+	now := c.now()
+
+	c.mu.RLock()
+	key, ok := c.keys[kid]
+	stale := now.Sub(c.fetchedAt) > c.options.TTL
+	missingSince, missing := c.missing[kid]
+	c.mu.RUnlock()
+
+	if ok {
+		if stale {
+			c.refreshInBackground()
+		}
+		return key, nil
+	}
+	if missing && now.Sub(missingSince) < c.options.NegativeTTL {
+		return nil, fmt.Errorf("%w: kid %s", ErrKeyNotFound, kid)
+	}
+
+	// An unknown kid usually means the issuer rotated its keys
+	if err := c.refresh(ctx, true); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if key, ok := c.keys[kid]; ok {
+		return key, nil
+	}
+	c.missing[kid] = now
+	return nil, fmt.Errorf("%w: kid %s", ErrKeyNotFound, kid)
+}
+
+// Keyfunc looks up the key named by the token's kid header for jwt.Parse and
+// checks that the token's algorithm matches the key type
+func (c *Cache) Keyfunc(ctx context.Context) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		kid, ok := token.Header["kid"].(string)
+		if !ok || kid == "" {
+			return nil, errors.New("token does not contain a valid kid")
+		}
+		key, err := c.Key(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkAlgorithm(token.Method, key); err != nil {
+			return nil, err
+		}
+		return key, nil
+	}
+}
+
+// refreshInBackground starts a refresh unless one is already running
+func (c *Cache) refreshInBackground() {
+	c.mu.Lock()
+	if c.refreshing {
+		c.mu.Unlock()
+		return
+	}
+	c.refreshing = true
+	c.mu.Unlock()
+
+	go func() {
+		defer func() {
+			c.mu.Lock()
+			c.refreshing = false
+			c.mu.Unlock()
+		}()
+		if err := c.refresh(context.Background(), false); err != nil {
+			log.Printf("Background JWKS refresh from %s failed: %v", c.url, err)
+		}
+	}()
+}
+
+// refresh fetches the key set. A forced refresh for an unknown kid is skipped
+// if another fetch happened within MinRefreshInterval.
+func (c *Cache) refresh(ctx context.Context, forced bool) error {
+	c.fetchMu.Lock()
+	defer c.fetchMu.Unlock()
+
+	c.mu.RLock()
+	sinceAttempt := c.now().Sub(c.attemptAt)
+	loaded := !c.fetchedAt.IsZero()
+	c.mu.RUnlock()
+	if forced && sinceAttempt < c.options.MinRefreshInterval {
+		if loaded {
+			return nil
+		}
+		return fmt.Errorf("JWKS from %s is unavailable, last fetch failed %s ago", c.url, sinceAttempt.Round(time.Second))
+	}
+
+	c.mu.Lock()
+	c.attemptAt = c.now()
+	c.mu.Unlock()
+
+	keys, err := fetch(ctx, c.options.HTTPClient, c.url)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.keys = keys
+	c.fetchedAt = c.now()
+	// Forget misses so kids published by this fetch are found
+	c.missing = make(map[string]time.Time)
+	c.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,361 @@
+package jwks
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// stubJWKS serves a key set that tests can change, counting fetches
+type stubJWKS struct {
+	*httptest.Server
+	fetches atomic.Int32
+
+	mu     sync.Mutex
+	set    KeySet
+	status int
+}
+
+func newStubJWKS(t *testing.T, keys ...JSONWebKey) *stubJWKS {
+	t.Helper()
+	stub := &stubJWKS{set: KeySet{Keys: keys}, status: http.StatusOK}
+	stub.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stub.fetches.Add(1)
+		stub.mu.Lock()
+		defer stub.mu.Unlock()
+		if stub.status != http.StatusOK {
+			w.WriteHeader(stub.status)
+			return
+		}
+		json.NewEncoder(w).Encode(stub.set)
+	}))
+	t.Cleanup(stub.Close)
+	return stub
+}
+
+func (s *stubJWKS) publish(keys ...JSONWebKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.set = KeySet{Keys: keys}
+}
+
+func (s *stubJWKS) fail(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+}
+
+// fakeClock is a settable clock for the cache
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+var testOptions = Options{
+	TTL:                time.Hour,
+	NegativeTTL:        5 * time.Minute,
+	MinRefreshInterval: 30 * time.Second,
+}
+
+func newTestCache(url string) (*Cache, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)}
+	cache := New(url, testOptions)
+	cache.now = clock.Now
+	return cache, clock
+}
+
+func newRSAKey(t *testing.T, kid string) (*rsa.PrivateKey, JSONWebKey) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	return key, FromRSAPublicKey(kid, &key.PublicKey)
+}
+
+func newECKey(t *testing.T, kid string, curve elliptic.Curve, crv string) (*ecdsa.PrivateKey, JSONWebKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	size := (curve.Params().BitSize + 7) / 8
+	return key, JSONWebKey{
+		Kid: kid,
+		Kty: "EC",
+		Use: "sig",
+		Crv: crv,
+		X:   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, size))),
+		Y:   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, size))),
+	}
+}
+
+func assertFetches(t *testing.T, stub *stubJWKS, want int32) {
+	t.Helper()
+	if got := stub.fetches.Load(); got != want {
+		t.Fatalf("JWKS fetched %d times, want %d", got, want)
+	}
+}
+
+func TestKeyIsFetchedOnceAndCached(t *testing.T) {
+	_, jwk := newRSAKey(t, "kid-1")
+	stub := newStubJWKS(t, jwk)
+	cache, _ := newTestCache(stub.URL)
+	ctx := context.Background()
+
+	assertFetches(t, stub, 0)
+	for i := 0; i < 3; i++ {
+		key, err := cache.Key(ctx, "kid-1")
+		if err != nil {
+			t.Fatalf("Key: %v", err)
+		}
+		if _, ok := key.(*rsa.PublicKey); !ok {
+			t.Fatalf("Key returned %T, want *rsa.PublicKey", key)
+		}
+	}
+	assertFetches(t, stub, 1)
+}
+
+func TestStaleKeySetIsRefreshedInBackground(t *testing.T) {
+	_, jwk1 := newRSAKey(t, "kid-1")
+	_, jwk2 := newRSAKey(t, "kid-2")
+	stub := newStubJWKS(t, jwk1)
+	cache, clock := newTestCache(stub.URL)
+	ctx := context.Background()
+
+	if _, err := cache.Key(ctx, "kid-1"); err != nil {
+		t.Fatalf("Key: %v", err)
+	}
+	stub.publish(jwk1, jwk2)
+
+	// Within the TTL the cached set is used as is
+	clock.Advance(testOptions.TTL - time.Second)
+	if _, err := cache.Key(ctx, "kid-1"); err != nil {
+		t.Fatalf("Key: %v", err)
+	}
+	assertFetches(t, stub, 1)
+
+	// Past it, the caller still gets the cached key while a refresh runs
+	clock.Advance(2 * time.Second)
+	if _, err := cache.Key(ctx, "kid-1"); err != nil {
+		t.Fatalf("Key on a stale set: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for stub.fetches.Load() < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("stale key set was never refreshed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// The refresh picked up kid-2, so it is served without another fetch
+	for {
+		cache.mu.RLock()
+		_, ok := cache.keys["kid-2"]
+		cache.mu.RUnlock()
+		if ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("background refresh did not store the new keys")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if _, err := cache.Key(ctx, "kid-2"); err != nil {
+		t.Fatalf("Key for a key published since: %v", err)
+	}
+	assertFetches(t, stub, 2)
+}
+
+func TestUnknownKidTriggersRefetch(t *testing.T) {
+	_, jwk1 := newRSAKey(t, "kid-1")
+	_, jwk2 := newRSAKey(t, "kid-2")
+	stub := newStubJWKS(t, jwk1)
+	cache, clock := newTestCache(stub.URL)
+	ctx := context.Background()
+
+	if _, err := cache.Key(ctx, "kid-1"); err != nil {
+		t.Fatalf("Key: %v", err)
+	}
+
+	// The issuer rotates to kid-2 well within the TTL
+	stub.publish(jwk2)
+	clock.Advance(testOptions.MinRefreshInterval)
+	if _, err := cache.Key(ctx, "kid-2"); err != nil {
+		t.Fatalf("Key for a rotated kid: %v", err)
+	}
+	assertFetches(t, stub, 2)
+}
+
+func TestMinRefreshIntervalThrottlesRefetches(t *testing.T) {
+	_, jwk1 := newRSAKey(t, "kid-1")
+	_, jwk2 := newRSAKey(t, "kid-2")
+	stub := newStubJWKS(t, jwk1)
+	cache, clock := newTestCache(stub.URL)
+	ctx := context.Background()
+
+	if _, err := cache.Key(ctx, "kid-1"); err != nil {
+		t.Fatalf("Key: %v", err)
+	}
+	stub.publish(jwk1, jwk2)
+
+	// Unknown kids right after a fetch cannot force another one, so a flood
+	// of made-up kids cannot be turned into a flood of requests
+	for _, kid := range []string{"kid-2", "made-up-1", "made-up-2"} {
+		if _, err := cache.Key(ctx, kid); !errors.Is(err, ErrKeyNotFound) {
+			t.Fatalf("Key(%s) = %v, want ErrKeyNotFound", kid, err)
+		}
+	}
+	assertFetches(t, stub, 1)
+
+	clock.Advance(testOptions.MinRefreshInterval)
+	if _, err := cache.Key(ctx, "made-up-3"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Key = %v, want ErrKeyNotFound", err)
+	}
+	assertFetches(t, stub, 2)
+	// That fetch also brought in kid-2 and cleared it from the misses
+	if _, err := cache.Key(ctx, "kid-2"); err != nil {
+		t.Fatalf("Key for a kid published before the refetch: %v", err)
+	}
+	assertFetches(t, stub, 2)
+}
+
+func TestNegativeCache(t *testing.T) {
+	_, jwk := newRSAKey(t, "kid-1")
+	stub := newStubJWKS(t, jwk)
+	cache, clock := newTestCache(stub.URL)
+	ctx := context.Background()
+
+	if _, err := cache.Key(ctx, "unknown"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Key = %v, want ErrKeyNotFound", err)
+	}
+	assertFetches(t, stub, 1)
+
+	// Remembered as missing for NegativeTTL, even once refetching is allowed
+	clock.Advance(testOptions.MinRefreshInterval * 2)
+	if _, err := cache.Key(ctx, "unknown"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Key = %v, want ErrKeyNotFound", err)
+	}
+	assertFetches(t, stub, 1)
+
+	clock.Advance(testOptions.NegativeTTL)
+	if _, err := cache.Key(ctx, "unknown"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Key = %v, want ErrKeyNotFound", err)
+	}
+	assertFetches(t, stub, 2)
+}
+
+func TestFailedFetchIsNotRetriedImmediately(t *testing.T) {
+	_, jwk := newRSAKey(t, "kid-1")
+	stub := newStubJWKS(t, jwk)
+	stub.fail(http.StatusInternalServerError)
+	cache, clock := newTestCache(stub.URL)
+	ctx := context.Background()
+
+	if _, err := cache.Key(ctx, "kid-1"); err == nil {
+		t.Fatal("Key succeeded with the JWKS endpoint down")
+	}
+	if _, err := cache.Key(ctx, "kid-1"); err == nil {
+		t.Fatal("Key succeeded with the JWKS endpoint down")
+	}
+	assertFetches(t, stub, 1)
+
+	stub.fail(http.StatusOK)
+	clock.Advance(testOptions.MinRefreshInterval)
+	if _, err := cache.Key(ctx, "kid-1"); err != nil {
+		t.Fatalf("Key after the endpoint recovered: %v", err)
+	}
+	assertFetches(t, stub, 2)
+}
+
+func TestKeyfuncWithECKeys(t *testing.T) {
+	p256, jwk256 := newECKey(t, "ec-256", elliptic.P256(), "P-256")
+	p384, jwk384 := newECKey(t, "ec-384", elliptic.P384(), "P-384")
+	rsaKey, jwkRSA := newRSAKey(t, "rsa")
+	other256, _ := newECKey(t, "unpublished", elliptic.P256(), "P-256")
+	stub := newStubJWKS(t, jwk256, jwk384, jwkRSA)
+	cache, _ := newTestCache(stub.URL)
+	keyfunc := cache.Keyfunc(context.Background())
+
+	sign := func(method jwt.SigningMethod, key interface{}, kid string) string {
+		token := jwt.NewWithClaims(method, jwt.MapClaims{"sub": "user-1"})
+		token.Header["kid"] = kid
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatalf("SignedString: %v", err)
+		}
+		return signed
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{"ES256 with a P-256 key", sign(jwt.SigningMethodES256, p256, "ec-256"), true},
+		{"ES384 with a P-384 key", sign(jwt.SigningMethodES384, p384, "ec-384"), true},
+		{"RS256 with an RSA key", sign(jwt.SigningMethodRS256, rsaKey, "rsa"), true},
+		{"ES256 naming an RSA kid", sign(jwt.SigningMethodES256, p256, "rsa"), false},
+		{"RS256 naming an EC kid", sign(jwt.SigningMethodRS256, rsaKey, "ec-256"), false},
+		{"ES256 signed by another key", sign(jwt.SigningMethodES256, other256, "ec-256"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := jwt.Parse(tt.token, keyfunc)
+			if tt.valid && (err != nil || !token.Valid) {
+				t.Fatalf("Parse = %v, want a valid token", err)
+			}
+			if !tt.valid && err == nil {
+				t.Fatal("Parse accepted the token")
+			}
+		})
+	}
+	assertFetches(t, stub, 1)
+}
+
+func TestFetchSkipsUnusableKeys(t *testing.T) {
+	_, good := newRSAKey(t, "good")
+	_, offCurve := newECKey(t, "off-curve", elliptic.P256(), "P-256")
+	offCurve.Y = offCurve.X
+	stub := newStubJWKS(t,
+		good,
+		offCurve,
+		JSONWebKey{Kid: "encryption", Kty: "RSA", Use: "enc", N: good.N, E: good.E},
+		JSONWebKey{Kid: "octet", Kty: "oct"},
+	)
+	cache, _ := newTestCache(stub.URL)
+
+	if _, err := cache.Key(context.Background(), "good"); err != nil {
+		t.Fatalf("Key: %v", err)
+	}
+	cache.mu.RLock()
+	defer cache.mu.RUnlock()
+	if len(cache.keys) != 1 {
+		t.Errorf("cached %d keys, want only the usable one", len(cache.keys))
+	}
+}
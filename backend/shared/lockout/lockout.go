@@ -0,0 +1,163 @@
+// Package lockout slows down and then locks out password guessing. Failed
+// logins are counted per account and per client IP in the auth Redis, so
+// every service that checks passwords enforces the same limits.
+package lockout
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Limits is when failed logins start to be delayed, and when they lock out,
+// along one dimension
+type Limits struct {
+	// BackoffAfter failures, each further failure blocks logins for twice as
+	// long as the last, starting at a second
+	BackoffAfter int64
+	// LockoutAfter failures, logins are blocked for LockoutDuration
+	LockoutAfter    int64
+	LockoutDuration time.Duration
+}
+
+var (
+	// AccountLimits protects a single account from password guessing
+	AccountLimits = Limits{BackoffAfter: 3, LockoutAfter: 10, LockoutDuration: 15 * time.Minute}
+	// IPLimits is looser, since many users can share an address behind NAT
+	IPLimits = Limits{BackoffAfter: 10, LockoutAfter: 50, LockoutDuration: 15 * time.Minute}
+)
+
+// failureWindow is how long failures are remembered after the last one
+const failureWindow = time.Hour
+
+// Block returns how long logins are blocked after failures failed attempts
+func (l Limits) Block(failures int64) time.Duration {
+	switch {
+	case failures >= l.LockoutAfter:
+		return l.LockoutDuration
+	case failures >= l.BackoffAfter:
+		doublings := failures - l.BackoffAfter
+		if doublings > 30 {
+			return l.LockoutDuration
+		}
+		block := time.Second << uint(doublings)
+		if block > l.LockoutDuration {
+			return l.LockoutDuration
+		}
+		return block
+	default:
+		return 0
+	}
+}
+
+func failuresKey(dimension, value string) string {
+	return "login-failures:" + dimension + ":" + value
+}
+
+func blockedKey(dimension, value string) string {
+	return "login-blocked:" + dimension + ":" + value
+}
+
+// Store keeps the failure counts and blocks in the auth Redis. Accounts are
+// identified by their normalized email address.
+type Store struct {
+	Client *redis.Client
+}
+
+// NewStore returns a store on client
+func NewStore(client *redis.Client) *Store {
+	return &Store{Client: client}
+}
+
+// Blocked returns how long logins for the account or from the IP are still
+// blocked, or 0 if they are allowed
+func (s *Store) Blocked(ctx context.Context, email, ip string) (time.Duration, error) {
+	pipe := s.Client.Pipeline()
+	accountTTL := pipe.PTTL(ctx, blockedKey("account", email))
+	ipTTL := pipe.PTTL(ctx, blockedKey("ip", ip))
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Failed to check login lockout: %v", err)
+		return 0, err
+	}
+
+	// PTTL is negative for keys that do not exist
+	blocked := accountTTL.Val()
+	if ipTTL.Val() > blocked {
+		blocked = ipTTL.Val()
+	}
+	if blocked < 0 {
+		return 0, nil
+	}
+	return blocked, nil
+}
+
+// RecordFailure counts a failed login against the account and the IP and
+// blocks further attempts as their limits require. It returns how long logins
+// are now blocked.
+func (s *Store) RecordFailure(ctx context.Context, email, ip string) (time.Duration, error) {
+	var blocked time.Duration
+	for _, dimension := range []struct {
+		name   string
+		value  string
+		limits Limits
+	}{
+		{"account", email, AccountLimits},
+		{"ip", ip, IPLimits},
+	} {
+		var failures *redis.IntCmd
+		_, err := s.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			failures = pipe.Incr(ctx, failuresKey(dimension.name, dimension.value))
+			pipe.Expire(ctx, failuresKey(dimension.name, dimension.value), failureWindow)
+			return nil
+		})
+		if err != nil {
+			log.Printf("Failed to record login failure: %v", err)
+			return 0, err
+		}
+
+		block := dimension.limits.Block(failures.Val())
+		if block == 0 {
+			continue
+		}
+		if err := s.Client.Set(ctx, blockedKey(dimension.name, dimension.value), failures.Val(), block).Err(); err != nil {
+			log.Printf("Failed to block logins: %v", err)
+			return 0, err
+		}
+		if failures.Val() == dimension.limits.LockoutAfter {
+			log.Printf("Locked out logins for %s %s after %d failures", dimension.name, dimension.value, failures.Val())
+		}
+		if block > blocked {
+			blocked = block
+		}
+	}
+	return blocked, nil
+}
+
+// ClearFailures resets the account's count after a successful login. The
+// IP's count is kept, so logging in to one account does not buy more guesses
+// at others.
+func (s *Store) ClearFailures(ctx context.Context, email string) error {
+	return s.Client.Del(ctx, failuresKey("account", email)).Err()
+}
+
+// Unlock lifts any lockout of the account or the IP and resets their counts;
+// either may be empty
+func (s *Store) Unlock(ctx context.Context, email, ip string) error {
+	var keys []string
+	if email != "" {
+		keys = append(keys, failuresKey("account", email), blockedKey("account", email))
+	}
+	if ip != "" {
+		keys = append(keys, failuresKey("ip", ip), blockedKey("ip", ip))
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	if err := s.Client.Del(ctx, keys...).Err(); err != nil {
+		log.Printf("Failed to unlock logins: %v", err)
+		return err
+	}
+	return nil
+}
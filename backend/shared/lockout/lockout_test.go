@@ -0,0 +1,197 @@
+package lockout
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+// newTestStore returns a store on an in-memory Redis
+func newTestStore(t *testing.T) (*Store, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewStore(client), server
+}
+
+func recordFailures(t *testing.T, store *Store, n int, email func(i int) string, ip func(i int) string) time.Duration {
+	t.Helper()
+	var blocked time.Duration
+	for i := 0; i < n; i++ {
+		var err error
+		blocked, err = store.RecordFailure(context.Background(), email(i), ip(i))
+		if err != nil {
+			t.Fatalf("RecordFailure: %v", err)
+		}
+	}
+	return blocked
+}
+
+func same(value string) func(int) string {
+	return func(int) string { return value }
+}
+
+func distinct(prefix string) func(int) string {
+	return func(i int) string { return prefix + strconv.Itoa(i) }
+}
+
+func TestLimitsBlock(t *testing.T) {
+	limits := Limits{BackoffAfter: 3, LockoutAfter: 10, LockoutDuration: 15 * time.Minute}
+	tests := []struct {
+		failures int64
+		want     time.Duration
+	}{
+		{0, 0},
+		{2, 0},
+		{3, time.Second},
+		{4, 2 * time.Second},
+		{6, 8 * time.Second},
+		{9, 64 * time.Second},
+		{10, 15 * time.Minute},
+		{1000, 15 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := limits.Block(tt.failures); got != tt.want {
+			t.Errorf("Block(%d) = %s, want %s", tt.failures, got, tt.want)
+		}
+	}
+
+	// Backoff never exceeds the lockout, even when the doublings would
+	short := Limits{BackoffAfter: 1, LockoutAfter: 100, LockoutDuration: time.Minute}
+	if got := short.Block(50); got != time.Minute {
+		t.Errorf("Block(50) = %s, want the lockout duration", got)
+	}
+}
+
+func TestAccountBackoffAndLockout(t *testing.T) {
+	store, _ := newTestStore(t)
+	const email = "user@example.com"
+
+	// Failures from different addresses still count against the account
+	blocked := recordFailures(t, store, int(AccountLimits.BackoffAfter)-1, same(email), distinct("198.51.100."))
+	if blocked != 0 {
+		t.Fatalf("blocked for %s before reaching the backoff threshold", blocked)
+	}
+	if wait, _ := store.Blocked(context.Background(), email, "203.0.113.1"); wait != 0 {
+		t.Fatalf("LoginBlocked = %s before reaching the backoff threshold", wait)
+	}
+
+	blocked = recordFailures(t, store, 1, same(email), same("198.51.100.99"))
+	if blocked != time.Second {
+		t.Fatalf("first backoff = %s, want 1s", blocked)
+	}
+	if wait, _ := store.Blocked(context.Background(), email, "203.0.113.1"); wait <= 0 {
+		t.Fatal("account not blocked from a fresh address after backoff started")
+	}
+	if wait, _ := store.Blocked(context.Background(), "other@example.com", "203.0.113.1"); wait != 0 {
+		t.Fatalf("unrelated account blocked for %s", wait)
+	}
+
+	remaining := int(AccountLimits.LockoutAfter - AccountLimits.BackoffAfter)
+	blocked = recordFailures(t, store, remaining, same(email), distinct("192.0.2."))
+	if blocked != AccountLimits.LockoutDuration {
+		t.Fatalf("blocked for %s after %d failures, want lockout of %s",
+			blocked, AccountLimits.LockoutAfter, AccountLimits.LockoutDuration)
+	}
+	if wait, _ := store.Blocked(context.Background(), email, "203.0.113.1"); wait <= AccountLimits.LockoutDuration-time.Second {
+		t.Fatalf("LoginBlocked = %s, want about %s", wait, AccountLimits.LockoutDuration)
+	}
+}
+
+func TestIPBackoffAndLockout(t *testing.T) {
+	store, _ := newTestStore(t)
+	const ip = "198.51.100.7"
+
+	// Guessing at many accounts from one address is throttled by the IP
+	blocked := recordFailures(t, store, int(IPLimits.BackoffAfter)-1, distinct("victim-"), same(ip))
+	if blocked != 0 {
+		t.Fatalf("blocked for %s before reaching the IP backoff threshold", blocked)
+	}
+	blocked = recordFailures(t, store, 1, same("last@example.com"), same(ip))
+	if blocked != time.Second {
+		t.Fatalf("first IP backoff = %s, want 1s", blocked)
+	}
+	if wait, _ := store.Blocked(context.Background(), "fresh@example.com", ip); wait <= 0 {
+		t.Fatal("fresh account not blocked from a throttled address")
+	}
+	if wait, _ := store.Blocked(context.Background(), "fresh@example.com", "203.0.113.1"); wait != 0 {
+		t.Fatalf("other address blocked for %s", wait)
+	}
+
+	remaining := int(IPLimits.LockoutAfter - IPLimits.BackoffAfter)
+	blocked = recordFailures(t, store, remaining, distinct("spray-"), same(ip))
+	if blocked != IPLimits.LockoutDuration {
+		t.Fatalf("blocked for %s after %d failures, want lockout of %s",
+			blocked, IPLimits.LockoutAfter, IPLimits.LockoutDuration)
+	}
+}
+
+func TestBlockExpires(t *testing.T) {
+	store, server := newTestStore(t)
+	const email, ip = "user@example.com", "198.51.100.7"
+
+	recordFailures(t, store, int(AccountLimits.BackoffAfter), same(email), same(ip))
+	server.FastForward(2 * time.Second)
+	if wait, _ := store.Blocked(context.Background(), email, ip); wait != 0 {
+		t.Fatalf("still blocked for %s after the backoff passed", wait)
+	}
+}
+
+func TestClearFailuresResetsAccountOnly(t *testing.T) {
+	store, _ := newTestStore(t)
+	const email, ip = "user@example.com", "198.51.100.7"
+
+	recordFailures(t, store, int(AccountLimits.BackoffAfter)-1, same(email), same(ip))
+	if err := store.ClearFailures(context.Background(), email); err != nil {
+		t.Fatalf("ClearFailures: %v", err)
+	}
+
+	// The account starts counting from zero again after a successful login
+	blocked := recordFailures(t, store, int(AccountLimits.BackoffAfter)-1, same(email), same(ip))
+	if blocked != 0 {
+		t.Fatalf("blocked for %s, the account count was not reset", blocked)
+	}
+
+	// but the address keeps its count, so one good login does not buy more
+	// guesses at other accounts
+	failures := 2 * (AccountLimits.BackoffAfter - 1)
+	remaining := int(IPLimits.BackoffAfter - failures)
+	blocked = recordFailures(t, store, remaining, distinct("other-"), same(ip))
+	if blocked != time.Second {
+		t.Fatalf("IP backoff = %s after %d failures, want 1s", blocked, IPLimits.BackoffAfter)
+	}
+}
+
+func TestUnlock(t *testing.T) {
+	store, _ := newTestStore(t)
+	const email, ip = "user@example.com", "198.51.100.7"
+
+	recordFailures(t, store, int(AccountLimits.LockoutAfter), same(email), distinct("192.0.2."))
+	recordFailures(t, store, int(IPLimits.LockoutAfter), distinct("spray-"), same(ip))
+
+	if err := store.Unlock(context.Background(), email, ""); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	if wait, _ := store.Blocked(context.Background(), email, "203.0.113.1"); wait != 0 {
+		t.Fatalf("account still blocked for %s after unlock", wait)
+	}
+	if wait, _ := store.Blocked(context.Background(), "fresh@example.com", ip); wait <= 0 {
+		t.Fatal("unlocking the account also unlocked the address")
+	}
+
+	if err := store.Unlock(context.Background(), "", ip); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	if wait, _ := store.Blocked(context.Background(), "fresh@example.com", ip); wait != 0 {
+		t.Fatalf("address still blocked for %s after unlock", wait)
+	}
+	// Counts are reset too, so the next failure does not lock out again
+	if blocked := recordFailures(t, store, 1, same(email), same(ip)); blocked != 0 {
+		t.Fatalf("blocked for %s right after unlock", blocked)
+	}
+}
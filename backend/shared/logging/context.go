@@ -0,0 +1,61 @@
+package logging
+
+import (
+	"context"
+	"sync"
+)
+
+type contextKey struct{}
+
+// RequestFields holds the identifiers logged with every record made during a
+// request. The user ID is filled in later by the auth middleware, so the
+// struct is shared by pointer and guarded by a mutex.
+type RequestFields struct {
+	mu        sync.RWMutex
+	requestID string
+	userID    string
+}
+
+// RequestID returns the request's ID
+func (f *RequestFields) RequestID() string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.requestID
+}
+
+// UserID returns the authenticated user, if any
+func (f *RequestFields) UserID() string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.userID
+}
+
+// WithRequestID returns a context carrying fields for the request ID
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, contextKey{}, &RequestFields{requestID: requestID})
+}
+
+// SetUserID records the authenticated user for the rest of the request's logs
+func SetUserID(ctx context.Context, userID string) {
+	if fields := fieldsFromContext(ctx); fields != nil {
+		fields.mu.Lock()
+		fields.userID = userID
+		fields.mu.Unlock()
+	}
+}
+
+// RequestIDFromContext returns the request ID, or "" outside a request
+func RequestIDFromContext(ctx context.Context) string {
+	if fields := fieldsFromContext(ctx); fields != nil {
+		return fields.RequestID()
+	}
+	return ""
+}
+
+func fieldsFromContext(ctx context.Context) *RequestFields {
+	if ctx == nil {
+		return nil
+	}
+	fields, _ := ctx.Value(contextKey{}).(*RequestFields)
+	return fields
+}
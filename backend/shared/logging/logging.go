@@ -0,0 +1,107 @@
+// Package logging sets up the structured logger shared by the Go services.
+// Records are written as JSON (or text) through log/slog, credentials are
+// redacted before they reach the output, and request-scoped fields such as
+// the request ID and user ID are added from the context.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Init installs the service's logger as the slog and log package default.
+// LOG_LEVEL (debug, info, warn, error) and LOG_FORMAT (json, text) come from
+// the environment; the defaults are info and json. Calls to the standard log
+// package go through the same handler at info level.
+func Init(service string) *slog.Logger {
+	logger := New(os.Stdout, service, ParseLevel(os.Getenv("LOG_LEVEL")), os.Getenv("LOG_FORMAT"))
+	slog.SetDefault(logger)
+	// slog.SetDefault routes the log package through the handler; drop its
+	// own timestamp since the handler adds one
+	log.SetFlags(0)
+	return logger
+}
+
+// New builds a redacting logger writing to w
+func New(w io.Writer, service string, level slog.Level, format string) *slog.Logger {
+	options := &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redactAttr,
+	}
+	var handler slog.Handler
+	if strings.EqualFold(format, "text") {
+		handler = slog.NewTextHandler(w, options)
+	} else {
+		handler = slog.NewJSONHandler(w, options)
+	}
+	return slog.New(&contextHandler{Handler: handler}).With("service", service)
+}
+
+// Printf logs a formatted message at info level, adding the request ID and
+// user ID carried by ctx. Handlers use it in place of log.Printf.
+func Printf(ctx context.Context, format string, args ...any) {
+	logf(ctx, slog.LevelInfo, format, args...)
+}
+
+// Errorf logs a formatted message at error level with the request's fields
+func Errorf(ctx context.Context, format string, args ...any) {
+	logf(ctx, slog.LevelError, format, args...)
+}
+
+func logf(ctx context.Context, level slog.Level, format string, args ...any) {
+	logger := slog.Default()
+	if !logger.Enabled(ctx, level) {
+		return
+	}
+	logger.Log(ctx, level, fmt.Sprintf(format, args...))
+}
+
+// ParseLevel reads a level name, falling back to info
+func ParseLevel(name string) slog.Level {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// contextHandler adds the request fields stored in the context and redacts
+// the message before passing records on
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	redacted := slog.NewRecord(record.Time, record.Level, Redact(record.Message), record.PC)
+	record.Attrs(func(attr slog.Attr) bool {
+		redacted.AddAttrs(attr)
+		return true
+	})
+	if fields := fieldsFromContext(ctx); fields != nil {
+		if requestID := fields.RequestID(); requestID != "" {
+			redacted.AddAttrs(slog.String("request_id", requestID))
+		}
+		if userID := fields.UserID(); userID != "" {
+			redacted.AddAttrs(slog.String("user_id", userID))
+		}
+	}
+	return h.Handler.Handle(ctx, redacted)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
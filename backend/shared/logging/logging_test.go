@@ -0,0 +1,54 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+// useLogger makes a JSON logger writing to the returned buffer the default
+// for the rest of the test
+func useLogger(t *testing.T, level slog.Level) *bytes.Buffer {
+	t.Helper()
+	previous := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	var out bytes.Buffer
+	slog.SetDefault(New(&out, "test-api", level, "json"))
+	return &out
+}
+
+func TestErrorfAddsRequestFields(t *testing.T) {
+	out := useLogger(t, slog.LevelInfo)
+
+	ctx := WithRequestID(context.Background(), "req-1")
+	SetUserID(ctx, "user-1")
+	Errorf(ctx, "Error fetching canvas %s: %v", "canvas-1", "Bearer abc123")
+
+	var record map[string]any
+	if err := json.Unmarshal(out.Bytes(), &record); err != nil {
+		t.Fatalf("decoding %q: %v", out.String(), err)
+	}
+	want := map[string]any{
+		"level":      "ERROR",
+		"msg":        "Error fetching canvas canvas-1: Bearer [REDACTED]",
+		"service":    "test-api",
+		"request_id": "req-1",
+		"user_id":    "user-1",
+	}
+	for key, value := range want {
+		if record[key] != value {
+			t.Errorf("%s = %v, want %v", key, record[key], value)
+		}
+	}
+}
+
+func TestPrintfRespectsLevel(t *testing.T) {
+	out := useLogger(t, slog.LevelError)
+
+	Printf(context.Background(), "User ID not found in context")
+	if out.Len() != 0 {
+		t.Fatalf("info line logged at error level: %s", out.String())
+	}
+}
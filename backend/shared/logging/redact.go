@@ -0,0 +1,75 @@
+package logging
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// redacted replaces credential values in log output
+const redacted = "[REDACTED]"
+
+// sensitiveKeys are attribute names whose values are never logged. Keys are
+// compared case-insensitively after removing "-" and "_".
+var sensitiveKeys = []string{
+	"authorization",
+	"password",
+	"secret",
+	"token",
+	"cookie",
+	"apikey",
+	"session",
+}
+
+// codeKeys name status and classification codes, which are logged even though
+// keys ending in "code" (mfa_code, confirmation_code) are otherwise redacted
+var codeKeys = map[string]bool{
+	"status":   true,
+	"error":    true,
+	"exit":     true,
+	"response": true,
+	"http":     true,
+	"country":  true,
+	"language": true,
+}
+
+var (
+	bearerPattern = regexp.MustCompile(`(?i)\b(bearer|basic)\s+[A-Za-z0-9\-._~+/]+=*`)
+	// Three base64url segments starting with an encoded JSON header
+	jwtPattern = regexp.MustCompile(`\beyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+)
+
+// Redact masks bearer credentials and JWTs embedded in free text
+func Redact(text string) string {
+	text = bearerPattern.ReplaceAllString(text, "$1 "+redacted)
+	return jwtPattern.ReplaceAllString(text, redacted)
+}
+
+// IsSensitiveKey reports whether an attribute with this name holds a credential
+func IsSensitiveKey(key string) bool {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", "_", "").Replace(key))
+	for _, sensitive := range sensitiveKeys {
+		if strings.Contains(normalized, sensitive) {
+			return true
+		}
+	}
+	if prefix, ok := strings.CutSuffix(normalized, "code"); ok {
+		return !codeKeys[prefix]
+	}
+	return false
+}
+
+// redactAttr is the slog ReplaceAttr hook: it drops the values of sensitive
+// attributes and scrubs credentials out of the rest
+func redactAttr(groups []string, attr slog.Attr) slog.Attr {
+	if attr.Key == "session_id" || attr.Key == "request_id" {
+		return attr
+	}
+	if IsSensitiveKey(attr.Key) {
+		return slog.String(attr.Key, redacted)
+	}
+	if attr.Value.Kind() == slog.KindString {
+		return slog.String(attr.Key, Redact(attr.Value.String()))
+	}
+	return attr
+}
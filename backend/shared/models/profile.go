@@ -0,0 +1,27 @@
+package models
+
+// Preferences are the user's drawing defaults
+type Preferences struct {
+	DefaultBrush string `json:"default_brush"`
+	DefaultColor string `json:"default_color"`
+	Theme        string `json:"theme"`
+}
+
+// Profile is what a user sees and edits about themselves at /me
+type Profile struct {
+	UserID      string      `json:"user_id"`
+	Email       string      `json:"email"`
+	DisplayName string      `json:"display_name"`
+	AvatarURL   string      `json:"avatar_url,omitempty"`
+	Timezone    string      `json:"timezone"`
+	Preferences Preferences `json:"preferences"`
+	// Discoverable users can be found by display name in the user search
+	Discoverable bool `json:"discoverable"`
+}
+
+// PublicProfile is what other users and services may see about a user
+type PublicProfile struct {
+	UserID      string `json:"user_id"`
+	DisplayName string `json:"display_name"`
+	AvatarURL   string `json:"avatar_url,omitempty"`
+}
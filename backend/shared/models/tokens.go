@@ -0,0 +1,13 @@
+package models
+
+// TokenResponse is the body of a successful login or refresh. The refresh
+// token is single use; every refresh returns a new one.
+type TokenResponse struct {
+	Message      string `json:"message"`
+	UserID       string `json:"user_id"`
+	JWTToken     string `json:"jwt_token"`
+	ExpiresAt    int64  `json:"expires_at"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	SessionID    string `json:"session_id"`
+}
@@ -0,0 +1,109 @@
+package pat
+
+import (
+	"context"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// cassandraTable keeps tokens in the personal_access_tokens table, listed per
+// user, and personal_access_tokens_by_hash, which authentication looks them
+// up in. Rows carry a TTL, so expired tokens clean themselves up.
+type cassandraTable struct {
+	session *gocql.Session
+}
+
+func (t *cassandraTable) insert(ctx context.Context, token *Token, tokenHash string) error {
+	ttl := ttlSeconds(token.CreatedAt, token.ExpiresAt)
+	batch := t.session.NewBatch(gocql.LoggedBatch).WithContext(ctx)
+	batch.Query(`INSERT INTO personal_access_tokens (user_id, token_id, name, scopes, token_hash, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?) USING TTL ?`,
+		token.UserID, token.TokenID, token.Name, token.Scopes, tokenHash, token.CreatedAt, token.ExpiresAt, ttl)
+	batch.Query(`INSERT INTO personal_access_tokens_by_hash (token_hash, user_id, token_id, scopes, expires_at)
+		VALUES (?, ?, ?, ?, ?) USING TTL ?`,
+		tokenHash, token.UserID, token.TokenID, token.Scopes, token.ExpiresAt, ttl)
+	return t.session.ExecuteBatch(batch)
+}
+
+func (t *cassandraTable) lookup(ctx context.Context, tokenHash string) (*Token, error) {
+	var token Token
+	err := t.session.Query(`SELECT user_id, token_id, scopes, expires_at, last_used_at
+		FROM personal_access_tokens_by_hash WHERE token_hash = ?`, tokenHash).WithContext(ctx).
+		Scan(&token.UserID, &token.TokenID, &token.Scopes, &token.ExpiresAt, &token.LastUsedAt)
+	if err == gocql.ErrNotFound {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (t *cassandraTable) list(ctx context.Context, userID string) ([]Token, error) {
+	iter := t.session.Query(`SELECT token_id, name, scopes, created_at, expires_at, last_used_at
+		FROM personal_access_tokens WHERE user_id = ?`, userID).WithContext(ctx).Iter()
+
+	tokens := []Token{}
+	var token Token
+	for iter.Scan(&token.TokenID, &token.Name, &token.Scopes, &token.CreatedAt, &token.ExpiresAt, &token.LastUsedAt) {
+		token.UserID = userID
+		tokens = append(tokens, token)
+		token = Token{}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (t *cassandraTable) hash(ctx context.Context, userID, tokenID string) (string, error) {
+	var tokenHash string
+	err := t.session.Query(`SELECT token_hash FROM personal_access_tokens WHERE user_id = ? AND token_id = ?`,
+		userID, tokenID).WithContext(ctx).Scan(&tokenHash)
+	if err == gocql.ErrNotFound {
+		return "", ErrNotFound
+	}
+	return tokenHash, err
+}
+
+func (t *cassandraTable) remove(ctx context.Context, userID, tokenID, tokenHash string) error {
+	batch := t.session.NewBatch(gocql.LoggedBatch).WithContext(ctx)
+	batch.Query(`DELETE FROM personal_access_tokens WHERE user_id = ? AND token_id = ?`, userID, tokenID)
+	batch.Query(`DELETE FROM personal_access_tokens_by_hash WHERE token_hash = ?`, tokenHash)
+	return t.session.ExecuteBatch(batch)
+}
+
+func (t *cassandraTable) removeAll(ctx context.Context, userID string) (int, error) {
+	iter := t.session.Query(`SELECT token_hash FROM personal_access_tokens WHERE user_id = ?`,
+		userID).WithContext(ctx).Iter()
+
+	batch := t.session.NewBatch(gocql.LoggedBatch).WithContext(ctx)
+	var tokenHash string
+	for iter.Scan(&tokenHash) {
+		batch.Query(`DELETE FROM personal_access_tokens_by_hash WHERE token_hash = ?`, tokenHash)
+	}
+	if err := iter.Close(); err != nil {
+		return 0, err
+	}
+	revoked := batch.Size()
+	batch.Query(`DELETE FROM personal_access_tokens WHERE user_id = ?`, userID)
+	return revoked, t.session.ExecuteBatch(batch)
+}
+
+// touch uses conditional updates: an UPDATE is an upsert in Cassandra, and an
+// unconditional one racing a revoke would bring the deleted row back
+func (t *cassandraTable) touch(ctx context.Context, token *Token, tokenHash string, usedAt time.Time) (bool, error) {
+	ttl := ttlSeconds(usedAt, token.ExpiresAt)
+	for _, query := range []*gocql.Query{
+		t.session.Query(`UPDATE personal_access_tokens USING TTL ? SET last_used_at = ? WHERE user_id = ? AND token_id = ? IF EXISTS`,
+			ttl, usedAt, token.UserID, token.TokenID),
+		t.session.Query(`UPDATE personal_access_tokens_by_hash USING TTL ? SET last_used_at = ? WHERE token_hash = ? IF EXISTS`,
+			ttl, usedAt, tokenHash),
+	} {
+		applied, err := query.WithContext(ctx).ScanCAS()
+		if err != nil || !applied {
+			return false, err
+		}
+	}
+	return true, nil
+}
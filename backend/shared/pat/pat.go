@@ -0,0 +1,242 @@
+// Package pat stores personal access tokens: named, scoped, expiring bearer
+// tokens users create for scripts. Only a SHA-256 hash of each token is kept.
+// account-api creates, lists and revokes them; any service can accept them
+// through the auth middleware.
+package pat
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// Prefix starts every personal access token, so they are easy to tell apart
+// from JWTs and to spot in leaked text
+const Prefix = "pat_"
+
+// Scopes a token can be granted
+const (
+	ScopeCanvasRead  = "canvas:read"
+	ScopeCanvasWrite = "canvas:write"
+)
+
+// Scopes lists every valid scope
+var Scopes = []string{ScopeCanvasRead, ScopeCanvasWrite}
+
+const (
+	// MaxLifetime is the longest a token can be created for
+	MaxLifetime = 365 * 24 * time.Hour
+	// lastUsedResolution limits how often last_used_at is written for a busy token
+	lastUsedResolution = time.Minute
+)
+
+var (
+	// ErrNotFound is returned for unknown, revoked or expired tokens
+	ErrNotFound = errors.New("personal access token not found")
+	// ErrInvalidScope is returned when creating a token with an unknown scope
+	ErrInvalidScope = errors.New("invalid scope")
+)
+
+// Token describes a personal access token. The token itself is only ever
+// returned by Create.
+type Token struct {
+	TokenID    string     `json:"token_id"`
+	UserID     string     `json:"-"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"` // nil until first used
+}
+
+// Store creates, lists, revokes and authenticates tokens. Only a hash of each
+// token is handed to its table.
+type Store struct {
+	table table
+}
+
+// table is where tokens are kept: Cassandra in the services, memory in tests.
+// Lookups of missing tokens return ErrNotFound.
+type table interface {
+	// insert stores a new token until it expires
+	insert(ctx context.Context, token *Token, tokenHash string) error
+	// lookup finds a token by the hash of its secret
+	lookup(ctx context.Context, tokenHash string) (*Token, error)
+	// list returns the user's unexpired tokens
+	list(ctx context.Context, userID string) ([]Token, error)
+	// hash returns the stored hash of one of the user's tokens
+	hash(ctx context.Context, userID, tokenID string) (string, error)
+	// remove deletes a token
+	remove(ctx context.Context, userID, tokenID, tokenHash string) error
+	// removeAll deletes every token of the user and returns how many there were
+	removeAll(ctx context.Context, userID string) (int, error)
+	// touch records that the token was used, reporting false when it no
+	// longer exists. It must never bring back a revoked token.
+	touch(ctx context.Context, token *Token, tokenHash string, usedAt time.Time) (bool, error)
+}
+
+// NewStore returns a store on the Cassandra session
+func NewStore(session *gocql.Session) *Store {
+	return &Store{table: &cassandraTable{session: session}}
+}
+
+// ValidateScopes checks every scope is known and returns them without duplicates
+func ValidateScopes(scopes []string) ([]string, error) {
+	seen := map[string]bool{}
+	var valid []string
+	for _, scope := range scopes {
+		known := false
+		for _, s := range Scopes {
+			known = known || s == scope
+		}
+		if !known {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidScope, scope)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			valid = append(valid, scope)
+		}
+	}
+	if len(valid) == 0 {
+		return nil, fmt.Errorf("%w: at least one scope is required", ErrInvalidScope)
+	}
+	return valid, nil
+}
+
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// ttlSeconds is the Cassandra TTL for rows of a token expiring at expiresAt,
+// so expired tokens clean themselves up
+func ttlSeconds(now, expiresAt time.Time) int {
+	ttl := int(expiresAt.Sub(now).Seconds())
+	if ttl < 1 {
+		return 1
+	}
+	return ttl
+}
+
+// Create generates a token for the user and returns it with its description
+func (s *Store) Create(ctx context.Context, userID, name string, scopes []string, lifetime time.Duration) (string, *Token, error) {
+	scopes, err := ValidateScopes(scopes)
+	if err != nil {
+		return "", nil, err
+	}
+	if lifetime <= 0 || lifetime > MaxLifetime {
+		return "", nil, fmt.Errorf("token lifetime must be between 1s and %s", MaxLifetime)
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, err
+	}
+	raw := Prefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	token := &Token{
+		TokenID:   gocql.MustRandomUUID().String(),
+		UserID:    userID,
+		Name:      name,
+		Scopes:    scopes,
+		CreatedAt: now,
+		ExpiresAt: now.Add(lifetime),
+	}
+	if err := s.table.insert(ctx, token, hashToken(raw)); err != nil {
+		log.Printf("Failed to store personal access token for user %s: %v", userID, err)
+		return "", nil, err
+	}
+
+	log.Printf("Created personal access token %s for user %s", token.TokenID, userID)
+	return raw, token, nil
+}
+
+// List returns the user's unexpired tokens
+func (s *Store) List(ctx context.Context, userID string) ([]Token, error) {
+	tokens, err := s.table.list(ctx, userID)
+	if err != nil {
+		log.Printf("Failed to list personal access tokens for user %s: %v", userID, err)
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// Revoke deletes one of the user's tokens
+func (s *Store) Revoke(ctx context.Context, userID, tokenID string) error {
+	if _, err := gocql.ParseUUID(tokenID); err != nil {
+		return ErrNotFound
+	}
+	tokenHash, err := s.table.hash(ctx, userID, tokenID)
+	if err == ErrNotFound {
+		return err
+	} else if err != nil {
+		log.Printf("Failed to look up personal access token %s: %v", tokenID, err)
+		return err
+	}
+
+	if err := s.table.remove(ctx, userID, tokenID, tokenHash); err != nil {
+		log.Printf("Failed to revoke personal access token %s for user %s: %v", tokenID, userID, err)
+		return err
+	}
+
+	log.Printf("Revoked personal access token %s for user %s", tokenID, userID)
+	return nil
+}
+
+// RevokeAll deletes every token belonging to the user, for when their
+// password may have been known to someone else
+func (s *Store) RevokeAll(ctx context.Context, userID string) error {
+	revoked, err := s.table.removeAll(ctx, userID)
+	if err != nil {
+		log.Printf("Failed to revoke personal access tokens for user %s: %v", userID, err)
+		return err
+	}
+
+	log.Printf("Revoked %d personal access tokens for user %s", revoked, userID)
+	return nil
+}
+
+// Authenticate looks up the token and records that it was used
+func (s *Store) Authenticate(ctx context.Context, raw string) (*Token, error) {
+	if !strings.HasPrefix(raw, Prefix) {
+		return nil, ErrNotFound
+	}
+	tokenHash := hashToken(raw)
+
+	token, err := s.table.lookup(ctx, tokenHash)
+	if err == ErrNotFound {
+		return nil, err
+	} else if err != nil {
+		log.Printf("Failed to look up personal access token: %v", err)
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	if now.After(token.ExpiresAt) {
+		return nil, ErrNotFound
+	}
+
+	// A failed write only loses the timestamp, so it does not fail the request
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= lastUsedResolution {
+		exists, err := s.table.touch(ctx, token, tokenHash, now)
+		if err != nil {
+			log.Printf("Failed to record use of personal access token %s: %v", token.TokenID, err)
+		} else if !exists {
+			// Revoked since it was looked up
+			return nil, ErrNotFound
+		} else {
+			token.LastUsedAt = &now
+		}
+	}
+	return token, nil
+}
@@ -0,0 +1,309 @@
+package pat
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryTable keeps tokens in memory the way cassandraTable does, keyed by hash
+type memoryTable struct {
+	mu      sync.Mutex
+	tokens  map[string]Token // by hash
+	touches int
+}
+
+func newMemoryTable() *memoryTable {
+	return &memoryTable{tokens: make(map[string]Token)}
+}
+
+func (t *memoryTable) insert(ctx context.Context, token *Token, tokenHash string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tokens[tokenHash] = *token
+	return nil
+}
+
+func (t *memoryTable) lookup(ctx context.Context, tokenHash string) (*Token, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	token, ok := t.tokens[tokenHash]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &token, nil
+}
+
+func (t *memoryTable) list(ctx context.Context, userID string) ([]Token, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tokens := []Token{}
+	for _, token := range t.tokens {
+		if token.UserID == userID {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens, nil
+}
+
+func (t *memoryTable) hash(ctx context.Context, userID, tokenID string) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for tokenHash, token := range t.tokens {
+		if token.UserID == userID && token.TokenID == tokenID {
+			return tokenHash, nil
+		}
+	}
+	return "", ErrNotFound
+}
+
+func (t *memoryTable) remove(ctx context.Context, userID, tokenID, tokenHash string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.tokens, tokenHash)
+	return nil
+}
+
+func (t *memoryTable) removeAll(ctx context.Context, userID string) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	removed := 0
+	for tokenHash, token := range t.tokens {
+		if token.UserID == userID {
+			delete(t.tokens, tokenHash)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+func (t *memoryTable) touch(ctx context.Context, token *Token, tokenHash string, usedAt time.Time) (bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.touches++
+	stored, ok := t.tokens[tokenHash]
+	if !ok {
+		return false, nil
+	}
+	stored.LastUsedAt = &usedAt
+	t.tokens[tokenHash] = stored
+	return true, nil
+}
+
+func newTestStore() (*Store, *memoryTable) {
+	table := newMemoryTable()
+	return &Store{table: table}, table
+}
+
+func createToken(t *testing.T, store *Store, userID string, scopes ...string) (string, *Token) {
+	t.Helper()
+	raw, token, err := store.Create(context.Background(), userID, "script", scopes, time.Hour)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	return raw, token
+}
+
+func TestCreateStoresOnlyTheHash(t *testing.T) {
+	store, table := newTestStore()
+	raw, token := createToken(t, store, "user-1", ScopeCanvasRead)
+
+	if !strings.HasPrefix(raw, Prefix) || len(raw) < len(Prefix)+40 {
+		t.Fatalf("token %q is not a prefixed 32 byte secret", raw)
+	}
+	if len(table.tokens) != 1 {
+		t.Fatalf("%d rows stored, want 1", len(table.tokens))
+	}
+	for tokenHash, stored := range table.tokens {
+		if tokenHash != hashToken(raw) {
+			t.Errorf("stored under %q, want the SHA-256 of the token", tokenHash)
+		}
+		if strings.Contains(tokenHash, raw) || stored.Name == raw {
+			t.Error("the token itself was stored")
+		}
+		if stored.TokenID != token.TokenID || stored.UserID != "user-1" {
+			t.Errorf("stored %+v, want token %s of user-1", stored, token.TokenID)
+		}
+	}
+}
+
+func TestValidateScopes(t *testing.T) {
+	tests := []struct {
+		name    string
+		scopes  []string
+		want    []string
+		wantErr bool
+	}{
+		{"one", []string{ScopeCanvasRead}, []string{ScopeCanvasRead}, false},
+		{"duplicates dropped", []string{ScopeCanvasWrite, ScopeCanvasRead, ScopeCanvasWrite}, []string{ScopeCanvasWrite, ScopeCanvasRead}, false},
+		{"unknown", []string{ScopeCanvasRead, "canvas:admin"}, nil, true},
+		{"none", nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ValidateScopes(tt.scopes)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidScope) {
+					t.Fatalf("err = %v, want ErrInvalidScope", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ValidateScopes: %v", err)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Fatalf("ValidateScopes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateRejectsBadScopesAndLifetimes(t *testing.T) {
+	store, table := newTestStore()
+	ctx := context.Background()
+
+	if _, _, err := store.Create(ctx, "user-1", "script", []string{"everything"}, time.Hour); !errors.Is(err, ErrInvalidScope) {
+		t.Errorf("unknown scope: err = %v, want ErrInvalidScope", err)
+	}
+	for _, lifetime := range []time.Duration{0, -time.Hour, MaxLifetime + time.Hour} {
+		if _, _, err := store.Create(ctx, "user-1", "script", []string{ScopeCanvasRead}, lifetime); err == nil {
+			t.Errorf("lifetime %s accepted", lifetime)
+		}
+	}
+	if len(table.tokens) != 0 {
+		t.Fatalf("%d rejected tokens were stored", len(table.tokens))
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	store, _ := newTestStore()
+	ctx := context.Background()
+	raw, created := createToken(t, store, "user-1", ScopeCanvasRead, ScopeCanvasWrite)
+
+	token, err := store.Authenticate(ctx, raw)
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if token.UserID != "user-1" || token.TokenID != created.TokenID || len(token.Scopes) != 2 {
+		t.Fatalf("authenticated as %+v", token)
+	}
+
+	for _, bad := range []string{"", "not-a-pat", Prefix + "unknown", strings.TrimPrefix(raw, Prefix)} {
+		if _, err := store.Authenticate(ctx, bad); err != ErrNotFound {
+			t.Errorf("Authenticate(%q) = %v, want ErrNotFound", bad, err)
+		}
+	}
+}
+
+func TestExpiredTokenIsRejected(t *testing.T) {
+	store, table := newTestStore()
+	raw, _ := createToken(t, store, "user-1", ScopeCanvasRead)
+
+	// Cassandra has not dropped the row yet, but the token's time is up
+	stored := table.tokens[hashToken(raw)]
+	stored.ExpiresAt = time.Now().Add(-time.Second)
+	table.tokens[hashToken(raw)] = stored
+
+	if _, err := store.Authenticate(context.Background(), raw); err != ErrNotFound {
+		t.Fatalf("expired token: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestRevokedTokensAreRejected(t *testing.T) {
+	store, _ := newTestStore()
+	ctx := context.Background()
+	first, firstToken := createToken(t, store, "user-1", ScopeCanvasRead)
+	second, _ := createToken(t, store, "user-1", ScopeCanvasRead)
+	third, _ := createToken(t, store, "user-1", ScopeCanvasRead)
+	other, _ := createToken(t, store, "user-2", ScopeCanvasRead)
+
+	if err := store.Revoke(ctx, "user-2", firstToken.TokenID); err != ErrNotFound {
+		t.Fatalf("revoking another user's token: err = %v, want ErrNotFound", err)
+	}
+	if err := store.Revoke(ctx, "user-1", "not-a-uuid"); err != ErrNotFound {
+		t.Fatalf("revoking a malformed ID: err = %v, want ErrNotFound", err)
+	}
+	if err := store.Revoke(ctx, "user-1", firstToken.TokenID); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if _, err := store.Authenticate(ctx, first); err != ErrNotFound {
+		t.Fatalf("revoked token: err = %v, want ErrNotFound", err)
+	}
+	if _, err := store.Authenticate(ctx, second); err != nil {
+		t.Fatalf("revoking one token broke another: %v", err)
+	}
+
+	if err := store.RevokeAll(ctx, "user-1"); err != nil {
+		t.Fatalf("RevokeAll: %v", err)
+	}
+	for _, raw := range []string{second, third} {
+		if _, err := store.Authenticate(ctx, raw); err != ErrNotFound {
+			t.Errorf("token survived RevokeAll: %v", err)
+		}
+	}
+	if _, err := store.Authenticate(ctx, other); err != nil {
+		t.Fatalf("RevokeAll revoked another user's token: %v", err)
+	}
+}
+
+func TestAuthenticateRecordsLastUsed(t *testing.T) {
+	store, table := newTestStore()
+	ctx := context.Background()
+	raw, _ := createToken(t, store, "user-1", ScopeCanvasRead)
+
+	before := time.Now().UTC()
+	token, err := store.Authenticate(ctx, raw)
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	stored := table.tokens[hashToken(raw)]
+	if stored.LastUsedAt == nil || stored.LastUsedAt.Before(before) || token.LastUsedAt == nil {
+		t.Fatalf("last_used_at = %v after first use", stored.LastUsedAt)
+	}
+
+	// A busy token is not written on every request
+	if _, err := store.Authenticate(ctx, raw); err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if table.touches != 1 {
+		t.Fatalf("%d writes for two uses within %s, want 1", table.touches, lastUsedResolution)
+	}
+
+	// but is once the last recorded use is old enough
+	old := time.Now().UTC().Add(-2 * lastUsedResolution)
+	stored.LastUsedAt = &old
+	table.tokens[hashToken(raw)] = stored
+	if _, err := store.Authenticate(ctx, raw); err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if table.touches != 2 || !table.tokens[hashToken(raw)].LastUsedAt.After(old) {
+		t.Fatalf("last_used_at not updated from %v", old)
+	}
+}
+
+// touchRevokes deletes the token just before its use is recorded, as a
+// revoke racing authentication would
+type touchRevokes struct {
+	*memoryTable
+}
+
+func (t touchRevokes) touch(ctx context.Context, token *Token, tokenHash string, usedAt time.Time) (bool, error) {
+	t.remove(ctx, token.UserID, token.TokenID, tokenHash)
+	return t.memoryTable.touch(ctx, token, tokenHash, usedAt)
+}
+
+func TestTokenRevokedDuringAuthentication(t *testing.T) {
+	store, table := newTestStore()
+	raw, _ := createToken(t, store, "user-1", ScopeCanvasRead)
+	store.table = touchRevokes{table}
+
+	if _, err := store.Authenticate(context.Background(), raw); err != ErrNotFound {
+		t.Fatalf("token revoked mid-request: err = %v, want ErrNotFound", err)
+	}
+	if len(table.tokens) != 0 {
+		t.Fatal("recording the use brought the revoked token back")
+	}
+}
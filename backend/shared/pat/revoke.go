@@ -0,0 +1,46 @@
+package pat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"shared/session"
+)
+
+var (
+	// ErrSessionsNotRevoked is returned by RevokeCredentials when the user's
+	// sessions could not be revoked; their tokens were left alone
+	ErrSessionsNotRevoked = errors.New("sessions not revoked")
+	// ErrTokensNotRevoked is returned by RevokeCredentials when the sessions
+	// were revoked but the personal access tokens were not
+	ErrTokensNotRevoked = errors.New("access tokens not revoked")
+)
+
+// RevokeCredentials logs the user out everywhere: it revokes their sessions,
+// all of them or all but keepSessionID, then their personal access tokens.
+// Every service that does this on logout-all, a password change or reset, or
+// an email change goes through here so none of them forgets the tokens.
+//
+// Sessions go first since they live in Redis, which is there even when
+// Cassandra is not. tokens is nil without Cassandra; the sessions are still
+// revoked and ErrTokensNotRevoked is returned.
+func RevokeCredentials(ctx context.Context, sessions *session.Store, tokens *Store, userID, keepSessionID string) error {
+	var err error
+	if keepSessionID == "" {
+		err = sessions.RevokeAll(ctx, userID)
+	} else {
+		err = sessions.RevokeOthers(ctx, userID, keepSessionID)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSessionsNotRevoked, err)
+	}
+
+	if tokens == nil {
+		return fmt.Errorf("%w: Cassandra session not available", ErrTokensNotRevoked)
+	}
+	if err := tokens.RevokeAll(ctx, userID); err != nil {
+		return fmt.Errorf("%w: %v", ErrTokensNotRevoked, err)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package pat
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"shared/session"
+	"shared/token"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func newSessionStore(t *testing.T) *session.Store {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return session.NewStore(client, token.DefaultPolicy())
+}
+
+func createSession(t *testing.T, sessions *session.Store, sessionID, userID string) {
+	t.Helper()
+	now := time.Now()
+	err := sessions.Create(context.Background(), &session.Session{
+		SessionID: sessionID,
+		UserID:    userID,
+		CreatedAt: now.Unix(),
+		ExpiresAt: sessions.Policy.SessionExpiry(now).Unix(),
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+}
+
+func TestRevokeCredentials(t *testing.T) {
+	ctx := context.Background()
+	sessions := newSessionStore(t)
+	tokens, _ := newTestStore()
+	createSession(t, sessions, "session-1", "user-1")
+	createSession(t, sessions, "session-2", "user-1")
+	raw, _ := createToken(t, tokens, "user-1", ScopeCanvasRead)
+
+	if err := RevokeCredentials(ctx, sessions, tokens, "user-1", ""); err != nil {
+		t.Fatalf("RevokeCredentials: %v", err)
+	}
+	for _, sessionID := range []string{"session-1", "session-2"} {
+		if _, err := sessions.Get(ctx, sessionID); err != session.ErrNotFound {
+			t.Errorf("%s survived: err = %v", sessionID, err)
+		}
+	}
+	if _, err := tokens.Authenticate(ctx, raw); err != ErrNotFound {
+		t.Fatalf("token survived: err = %v", err)
+	}
+}
+
+func TestRevokeCredentialsKeepsCurrentSession(t *testing.T) {
+	ctx := context.Background()
+	sessions := newSessionStore(t)
+	tokens, _ := newTestStore()
+	createSession(t, sessions, "current", "user-1")
+	createSession(t, sessions, "other", "user-1")
+	raw, _ := createToken(t, tokens, "user-1", ScopeCanvasRead)
+
+	if err := RevokeCredentials(ctx, sessions, tokens, "user-1", "current"); err != nil {
+		t.Fatalf("RevokeCredentials: %v", err)
+	}
+	if _, err := sessions.Get(ctx, "current"); err != nil {
+		t.Fatalf("current session revoked: %v", err)
+	}
+	if _, err := sessions.Get(ctx, "other"); err != session.ErrNotFound {
+		t.Fatalf("other session survived: err = %v", err)
+	}
+	if _, err := tokens.Authenticate(ctx, raw); err != ErrNotFound {
+		t.Fatalf("token survived: err = %v", err)
+	}
+}
+
+func TestRevokeCredentialsWithoutCassandra(t *testing.T) {
+	ctx := context.Background()
+	sessions := newSessionStore(t)
+	createSession(t, sessions, "session-1", "user-1")
+
+	err := RevokeCredentials(ctx, sessions, nil, "user-1", "")
+	if !errors.Is(err, ErrTokensNotRevoked) {
+		t.Fatalf("err = %v, want ErrTokensNotRevoked", err)
+	}
+	if _, err := sessions.Get(ctx, "session-1"); err != session.ErrNotFound {
+		t.Fatalf("sessions were not revoked first: err = %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var (
+	// ErrRefreshTokenInvalid is returned for unknown or expired refresh tokens
+	ErrRefreshTokenInvalid = errors.New("invalid refresh token")
+
+	// ErrRefreshTokenReused is returned when an already rotated refresh token
+	// is presented again; its session has been revoked
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+)
+
+// RefreshTokenData is stored in Redis under refresh:<sha256 of the token>.
+// Only the hash is kept, so a Redis dump cannot be replayed as refresh tokens.
+type RefreshTokenData struct {
+	SessionID string `json:"session_id"`
+	UserID    string `json:"user_id"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func refreshTokenKey(hash string) string {
+	return "refresh:" + hash
+}
+
+// refreshRotatedKey marks a refresh token as used. It is claimed with SETNX so
+// only one of two concurrent refreshes with the same token can win.
+func refreshRotatedKey(hash string) string {
+	return "refresh-rotated:" + hash
+}
+
+// IssueRefreshToken creates a new refresh token for the session
+func (s *Store) IssueRefreshToken(ctx context.Context, session *Session) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	data, err := json.Marshal(RefreshTokenData{
+		SessionID: session.SessionID,
+		UserID:    session.UserID,
+		ExpiresAt: session.ExpiresAt,
+	})
+	if err != nil {
+		log.Printf("Failed to marshal refresh token data: %v", err)
+		return "", err
+	}
+
+	// Rotated tokens are kept until the session ends so reuse can still be detected
+	ttl := time.Until(time.Unix(session.ExpiresAt, 0))
+	err = s.Client.Set(ctx, refreshTokenKey(hashRefreshToken(token)), data, ttl).Err()
+	if err != nil {
+		log.Printf("Failed to store refresh token for session %s: %v", session.SessionID, err)
+		return "", err
+	}
+	return token, nil
+}
+
+// RotateRefreshToken exchanges a refresh token for a new one, returning the
+// session it belongs to. Presenting a token that was already rotated revokes
+// the whole session, since either the client or an attacker holds a stolen copy.
+func (s *Store) RotateRefreshToken(ctx context.Context, token string) (*Session, string, error) {
+	hash := hashRefreshToken(token)
+
+	dataJson, err := s.Client.Get(ctx, refreshTokenKey(hash)).Result()
+	if err == redis.Nil {
+		return nil, "", ErrRefreshTokenInvalid
+	} else if err != nil {
+		log.Printf("Failed to retrieve refresh token from Redis: %v", err)
+		return nil, "", err
+	}
+
+	var data RefreshTokenData
+	if err := json.Unmarshal([]byte(dataJson), &data); err != nil {
+		log.Printf("Failed to unmarshal refresh token data: %v", err)
+		return nil, "", err
+	}
+
+	ttl := time.Until(time.Unix(data.ExpiresAt, 0))
+	if ttl <= 0 {
+		return nil, "", ErrRefreshTokenInvalid
+	}
+
+	claimed, err := s.Client.SetNX(ctx, refreshRotatedKey(hash), time.Now().Unix(), ttl).Result()
+	if err != nil {
+		log.Printf("Failed to mark refresh token as rotated: %v", err)
+		return nil, "", err
+	}
+	if !claimed {
+		log.Printf("Refresh token reuse detected for session %s of user %s, revoking session", data.SessionID, data.UserID)
+		if err := s.Revoke(ctx, data.UserID, data.SessionID); err != nil && err != ErrNotFound {
+			return nil, "", err
+		}
+		return nil, "", ErrRefreshTokenReused
+	}
+
+	// The session may have been logged out since the token was issued
+	session, err := s.Check(ctx, data.SessionID, data.UserID)
+	if err == ErrNotFound {
+		return nil, "", ErrRefreshTokenInvalid
+	} else if err != nil {
+		return nil, "", err
+	}
+
+	if err := s.Extend(ctx, session); err == ErrNotFound {
+		return nil, "", ErrRefreshTokenInvalid
+	} else if err != nil {
+		return nil, "", err
+	}
+
+	newToken, err := s.IssueRefreshToken(ctx, session)
+	if err != nil {
+		return nil, "", err
+	}
+	return session, newToken, nil
+}
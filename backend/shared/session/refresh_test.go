@@ -0,0 +1,178 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+)
+
+func issueRefreshToken(t *testing.T, store *Store, session *Session) string {
+	t.Helper()
+	token, err := store.IssueRefreshToken(context.Background(), session)
+	if err != nil {
+		t.Fatalf("IssueRefreshToken: %v", err)
+	}
+	return token
+}
+
+func TestRotateRefreshToken(t *testing.T) {
+	store, _ := newTestStore(t)
+	ctx := context.Background()
+	created := createSession(t, store, "session-1", "user-1")
+	token := issueRefreshToken(t, store, created)
+
+	session, rotated, err := store.RotateRefreshToken(ctx, token)
+	if err != nil {
+		t.Fatalf("RotateRefreshToken: %v", err)
+	}
+	if session.SessionID != "session-1" || session.UserID != "user-1" {
+		t.Errorf("rotated into session %s of %s", session.SessionID, session.UserID)
+	}
+	if rotated == "" || rotated == token {
+		t.Fatalf("rotation returned %q for %q", rotated, token)
+	}
+
+	// The new token keeps the session going
+	if _, _, err := store.RotateRefreshToken(ctx, rotated); err != nil {
+		t.Fatalf("rotating the new token: %v", err)
+	}
+}
+
+func TestRefreshTokenReuseRevokesSession(t *testing.T) {
+	store, _ := newTestStore(t)
+	ctx := context.Background()
+	created := createSession(t, store, "session-1", "user-1")
+	createSession(t, store, "session-2", "user-1")
+	stolen := issueRefreshToken(t, store, created)
+
+	_, rotated, err := store.RotateRefreshToken(ctx, stolen)
+	if err != nil {
+		t.Fatalf("RotateRefreshToken: %v", err)
+	}
+
+	if _, _, err := store.RotateRefreshToken(ctx, stolen); err != ErrRefreshTokenReused {
+		t.Fatalf("replayed token: err = %v, want ErrRefreshTokenReused", err)
+	}
+	if err := store.Verify(ctx, "session-1", "user-1"); err != ErrNotFound {
+		t.Fatalf("session survived refresh token reuse: %v", err)
+	}
+	// The legitimate holder's token dies with the session
+	if _, _, err := store.RotateRefreshToken(ctx, rotated); err != ErrRefreshTokenInvalid {
+		t.Fatalf("token of a revoked session: err = %v, want ErrRefreshTokenInvalid", err)
+	}
+	if err := store.Verify(ctx, "session-2", "user-1"); err != nil {
+		t.Fatalf("reuse revoked an unrelated session: %v", err)
+	}
+}
+
+// Only one of several concurrent rotations can claim the token; the rest count
+// as reuse and take the session down, even from under the one that won
+func TestConcurrentRotationIsReuse(t *testing.T) {
+	store, _ := newTestStore(t)
+	created := createSession(t, store, "session-1", "user-1")
+	token := issueRefreshToken(t, store, created)
+
+	const attempts = 8
+	errs := make(chan error, attempts)
+	var wg sync.WaitGroup
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, err := store.RotateRefreshToken(context.Background(), token)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	reused := 0
+	for err := range errs {
+		switch err {
+		case ErrRefreshTokenReused:
+			reused++
+		case nil, ErrRefreshTokenInvalid:
+		default:
+			t.Errorf("RotateRefreshToken: %v", err)
+		}
+	}
+	if reused != attempts-1 {
+		t.Fatalf("%d rotations were flagged as reuse, want %d", reused, attempts-1)
+	}
+	if err := store.Verify(context.Background(), "session-1", "user-1"); err != ErrNotFound {
+		t.Fatalf("session survived concurrent reuse: %v", err)
+	}
+}
+
+func TestRefreshTokenInvalid(t *testing.T) {
+	store, _ := newTestStore(t)
+	ctx := context.Background()
+
+	if _, _, err := store.RotateRefreshToken(ctx, "never-issued"); err != ErrRefreshTokenInvalid {
+		t.Errorf("unknown token: err = %v, want ErrRefreshTokenInvalid", err)
+	}
+
+	// A token whose session was logged out
+	created := createSession(t, store, "session-1", "user-1")
+	token := issueRefreshToken(t, store, created)
+	if err := store.Revoke(ctx, "user-1", "session-1"); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if _, _, err := store.RotateRefreshToken(ctx, token); err != ErrRefreshTokenInvalid {
+		t.Errorf("token of a logged out session: err = %v, want ErrRefreshTokenInvalid", err)
+	}
+}
+
+func TestRefreshTokenExpiresWithSession(t *testing.T) {
+	store, _ := newTestStore(t)
+	ctx := context.Background()
+	created := createSession(t, store, "session-1", "user-1")
+	token := issueRefreshToken(t, store, created)
+
+	// Redis has not evicted the token yet, but the session's absolute end has passed
+	data, _ := json.Marshal(RefreshTokenData{
+		SessionID: "session-1",
+		UserID:    "user-1",
+		ExpiresAt: time.Now().Add(-time.Second).Unix(),
+	})
+	key := refreshTokenKey(hashRefreshToken(token))
+	if err := store.Client.Set(ctx, key, data, time.Hour).Err(); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if _, _, err := store.RotateRefreshToken(ctx, token); err != ErrRefreshTokenInvalid {
+		t.Fatalf("expired token: err = %v, want ErrRefreshTokenInvalid", err)
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	store, server := newTestStore(t)
+	ctx := context.Background()
+	created := createSession(t, store, "session-1", "user-1")
+	token := issueRefreshToken(t, store, created)
+	idle := store.Policy.IdleTimeout
+
+	if ttl := server.TTL(sessionKey("session-1")); ttl != idle {
+		t.Fatalf("new session TTL = %s, want the idle timeout %s", ttl, idle)
+	}
+
+	// A refresh just before the timeout starts it over
+	server.FastForward(idle - time.Hour)
+	_, token, err := store.RotateRefreshToken(ctx, token)
+	if err != nil {
+		t.Fatalf("RotateRefreshToken: %v", err)
+	}
+	if ttl := server.TTL(sessionKey("session-1")); ttl != idle {
+		t.Fatalf("refreshed session TTL = %s, want %s", ttl, idle)
+	}
+
+	// Left alone for the whole timeout, the session ends and its token with it
+	server.FastForward(idle + time.Second)
+	if err := store.Verify(ctx, "session-1", "user-1"); err != ErrNotFound {
+		t.Fatalf("idle session: Verify = %v, want ErrNotFound", err)
+	}
+	if _, _, err := store.RotateRefreshToken(ctx, token); err != ErrRefreshTokenInvalid {
+		t.Fatalf("token of an idle session: err = %v, want ErrRefreshTokenInvalid", err)
+	}
+}
@@ -0,0 +1,161 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Revoked sessions are announced for services that verify access tokens
+// without looking up the session. Each revocation is published on
+// RevocationChannel and added to the revoked-sessions sorted set, scored by
+// when the last access token for the session expires, so a service that
+// starts up or reconnects can load the list it missed.
+const (
+	RevocationChannel  = "session-revocations"
+	revokedSessionsKey = "revoked-sessions"
+)
+
+// revocationResyncInterval bounds how long a revocation missed while the
+// subscription was reconnecting can go unnoticed
+var revocationResyncInterval = time.Minute
+
+// Revocation is the message published for a revoked session
+type Revocation struct {
+	SessionID string `json:"session_id"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+// announceRevocations queues the revocation of the sessions on pipe. Entries
+// stay listed until every access token issued for them has expired.
+func (s *Store) announceRevocations(ctx context.Context, pipe redis.Pipeliner, sessionIDs ...string) {
+	now := time.Now()
+	expiresAt := now.Add(s.Policy.AccessTokenLifetime).Unix()
+
+	for _, sessionID := range sessionIDs {
+		pipe.ZAdd(ctx, revokedSessionsKey, &redis.Z{Score: float64(expiresAt), Member: sessionID})
+		message, _ := json.Marshal(Revocation{SessionID: sessionID, ExpiresAt: expiresAt})
+		pipe.Publish(ctx, RevocationChannel, message)
+	}
+	pipe.ZRemRangeByScore(ctx, revokedSessionsKey, "-inf", strconv.FormatInt(now.Unix(), 10))
+}
+
+// RevocationList is an in-memory copy of the sessions account-api has
+// revoked, kept until the last access token for each of them expires. It is
+// filled from the revoked-sessions sorted set and kept current through the
+// session-revocations channel.
+type RevocationList struct {
+	redisClient    *redis.Client
+	resyncInterval time.Duration
+
+	mu      sync.RWMutex
+	revoked map[string]int64
+}
+
+// NewRevocationList subscribes to revocations, loads the current list and
+// keeps it in sync until ctx is cancelled
+func NewRevocationList(ctx context.Context, redisClient *redis.Client) (*RevocationList, error) {
+	list := &RevocationList{
+		redisClient:    redisClient,
+		resyncInterval: revocationResyncInterval,
+		revoked:        make(map[string]int64),
+	}
+
+	// Subscribe before loading so nothing published in between is lost
+	pubsub := redisClient.Subscribe(ctx, RevocationChannel)
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, err
+	}
+	if err := list.load(ctx); err != nil {
+		pubsub.Close()
+		return nil, err
+	}
+
+	go list.run(ctx, pubsub)
+	return list, nil
+}
+
+// Verify rejects revoked sessions, for the auth middleware in stateless mode
+func (l *RevocationList) Verify(ctx context.Context, sessionID, userID string) error {
+	if l.IsRevoked(sessionID) {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// IsRevoked reports whether the session has been revoked
+func (l *RevocationList) IsRevoked(sessionID string) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	_, ok := l.revoked[sessionID]
+	return ok
+}
+
+func (l *RevocationList) run(ctx context.Context, pubsub *redis.PubSub) {
+	defer pubsub.Close()
+
+	messages := pubsub.Channel()
+	ticker := time.NewTicker(l.resyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case message, ok := <-messages:
+			if !ok {
+				return
+			}
+			var r Revocation
+			if err := json.Unmarshal([]byte(message.Payload), &r); err != nil || r.SessionID == "" {
+				log.Printf("Ignoring malformed revocation message: %v", err)
+				continue
+			}
+			l.mu.Lock()
+			l.revoked[r.SessionID] = r.ExpiresAt
+			l.mu.Unlock()
+		case <-ticker.C:
+			// The subscription reconnects on its own but drops messages sent
+			// while it was down, so reload the list every so often
+			if err := l.load(ctx); err != nil {
+				log.Printf("Failed to reload revoked sessions: %v", err)
+			}
+		}
+	}
+}
+
+// load replaces the list with the revocations still in effect
+func (l *RevocationList) load(ctx context.Context) error {
+	now := time.Now().Unix()
+	entries, err := l.redisClient.ZRangeByScoreWithScores(ctx, revokedSessionsKey, &redis.ZRangeBy{
+		Min: strconv.FormatInt(now, 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return err
+	}
+
+	revoked := make(map[string]int64, len(entries))
+	for _, entry := range entries {
+		if sessionID, ok := entry.Member.(string); ok {
+			revoked[sessionID] = int64(entry.Score)
+		}
+	}
+
+	l.mu.Lock()
+	// Keep revocations that arrived over the channel after the range was read
+	for sessionID, expiresAt := range l.revoked {
+		if _, ok := revoked[sessionID]; !ok && expiresAt >= now {
+			revoked[sessionID] = expiresAt
+		}
+	}
+	l.revoked = revoked
+	l.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,206 @@
+package session
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"shared/token"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+// newTestStore returns a store on an in-memory Redis
+func newTestStore(t *testing.T) (*Store, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewStore(client, token.DefaultPolicy()), server
+}
+
+// createSession stores a session for userID that started now
+func createSession(t *testing.T, store *Store, sessionID, userID string) *Session {
+	t.Helper()
+	now := time.Now()
+	session := &Session{
+		SessionID: sessionID,
+		UserID:    userID,
+		CreatedAt: now.Unix(),
+		ExpiresAt: store.Policy.SessionExpiry(now).Unix(),
+	}
+	if err := store.Create(context.Background(), session); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	return session
+}
+
+func newTestRevocationList(t *testing.T, store *Store) *RevocationList {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	list, err := NewRevocationList(ctx, store.Client)
+	if err != nil {
+		t.Fatalf("NewRevocationList: %v", err)
+	}
+	return list
+}
+
+// waitForRevocation polls until the list has caught up with a revocation
+func waitForRevocation(t *testing.T, list *RevocationList, sessionID string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !list.IsRevoked(sessionID) {
+		if time.Now().After(deadline) {
+			t.Fatalf("session %s never showed up as revoked", sessionID)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestFullModeRejectsRevokedSession(t *testing.T) {
+	store, _ := newTestStore(t)
+	ctx := context.Background()
+	createSession(t, store, "session-1", "user-1")
+	createSession(t, store, "session-2", "user-1")
+
+	if err := store.Verify(ctx, "session-1", "user-1"); err != nil {
+		t.Fatalf("live session rejected: %v", err)
+	}
+	if err := store.Verify(ctx, "session-1", "user-2"); err != ErrNotFound {
+		t.Fatalf("session accepted for another user: %v", err)
+	}
+
+	if err := store.Revoke(ctx, "user-1", "session-1"); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if err := store.Verify(ctx, "session-1", "user-1"); err != ErrNotFound {
+		t.Fatalf("revoked session: Verify = %v, want ErrNotFound", err)
+	}
+	if err := store.Verify(ctx, "session-2", "user-1"); err != nil {
+		t.Fatalf("other session rejected after revoking one: %v", err)
+	}
+
+	if err := store.RevokeAll(ctx, "user-1"); err != nil {
+		t.Fatalf("RevokeAll: %v", err)
+	}
+	if err := store.Verify(ctx, "session-2", "user-1"); err != ErrNotFound {
+		t.Fatalf("session survived RevokeAll: %v", err)
+	}
+}
+
+func TestStatelessModeRejectsRevokedSession(t *testing.T) {
+	store, _ := newTestStore(t)
+	ctx := context.Background()
+	createSession(t, store, "session-1", "user-1")
+	createSession(t, store, "session-2", "user-1")
+	createSession(t, store, "session-3", "user-1")
+
+	list := newTestRevocationList(t, store)
+	if err := list.Verify(ctx, "session-1", "user-1"); err != nil {
+		t.Fatalf("live session rejected: %v", err)
+	}
+
+	// Revocations reach the list over the channel
+	if err := store.Revoke(ctx, "user-1", "session-1"); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	waitForRevocation(t, list, "session-1")
+	if err := list.Verify(ctx, "session-1", "user-1"); err != ErrNotFound {
+		t.Fatalf("revoked session: Verify = %v, want ErrNotFound", err)
+	}
+	if err := list.Verify(ctx, "session-2", "user-1"); err != nil {
+		t.Fatalf("other session rejected: %v", err)
+	}
+
+	if err := store.RevokeOthers(ctx, "user-1", "session-3"); err != nil {
+		t.Fatalf("RevokeOthers: %v", err)
+	}
+	waitForRevocation(t, list, "session-2")
+	if list.IsRevoked("session-3") {
+		t.Fatal("RevokeOthers revoked the session it was asked to keep")
+	}
+}
+
+// Logging out everywhere must not take down a login made in the same second,
+// as a comparison of whole-second issue times would
+func TestRevokeAllSparesLoginInSameSecond(t *testing.T) {
+	store, _ := newTestStore(t)
+	ctx := context.Background()
+	list := newTestRevocationList(t, store)
+	createSession(t, store, "session-1", "user-1")
+
+	if err := store.RevokeAll(ctx, "user-1"); err != nil {
+		t.Fatalf("RevokeAll: %v", err)
+	}
+	createSession(t, store, "session-2", "user-1")
+	waitForRevocation(t, list, "session-1")
+
+	if err := store.Verify(ctx, "session-1", "user-1"); err != ErrNotFound {
+		t.Fatalf("revoked session: Verify = %v, want ErrNotFound", err)
+	}
+	if err := store.Verify(ctx, "session-2", "user-1"); err != nil {
+		t.Fatalf("new login rejected: %v", err)
+	}
+	if list.IsRevoked("session-2") {
+		t.Fatal("new login listed as revoked")
+	}
+	sessions, err := store.List(ctx, "user-1")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].SessionID != "session-2" {
+		t.Fatalf("List = %v, want only session-2", sessions)
+	}
+}
+
+func TestRevocationListLoadsExistingRevocations(t *testing.T) {
+	store, _ := newTestStore(t)
+	ctx := context.Background()
+	createSession(t, store, "session-1", "user-1")
+	if err := store.Revoke(ctx, "user-1", "session-1"); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+
+	// A service starting after the revocation still sees it
+	list := newTestRevocationList(t, store)
+	if !list.IsRevoked("session-1") {
+		t.Fatal("revocation made before startup was not loaded")
+	}
+}
+
+func TestRevocationListResyncsMissedRevocations(t *testing.T) {
+	previous := revocationResyncInterval
+	revocationResyncInterval = 20 * time.Millisecond
+	t.Cleanup(func() { revocationResyncInterval = previous })
+
+	store, _ := newTestStore(t)
+	ctx := context.Background()
+	list := newTestRevocationList(t, store)
+
+	// Listed without being published, as if the message was sent while the
+	// subscription was reconnecting
+	expiresAt := time.Now().Add(store.Policy.AccessTokenLifetime).Unix()
+	err := store.Client.ZAdd(ctx, revokedSessionsKey, &redis.Z{Score: float64(expiresAt), Member: "missed"}).Err()
+	if err != nil {
+		t.Fatalf("ZAdd: %v", err)
+	}
+	waitForRevocation(t, list, "missed")
+}
+
+func TestRevocationListDropsExpiredEntries(t *testing.T) {
+	store, _ := newTestStore(t)
+	ctx := context.Background()
+
+	// Every token for this session expired a minute ago
+	expired := float64(time.Now().Add(-time.Minute).Unix())
+	if err := store.Client.ZAdd(ctx, revokedSessionsKey, &redis.Z{Score: expired, Member: "old"}).Err(); err != nil {
+		t.Fatalf("ZAdd: %v", err)
+	}
+
+	list := newTestRevocationList(t, store)
+	if list.IsRevoked("old") {
+		t.Fatal("revocation kept after its tokens expired")
+	}
+}
@@ -0,0 +1,261 @@
+// Package session is the Redis store of logged-in devices. account-api
+// creates and revokes sessions; every service checks them when it accepts
+// an access token.
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"shared/token"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ErrNotFound is returned when a session does not exist, has expired or was revoked
+var ErrNotFound = errors.New("session not found")
+
+// lastSeenResolution limits how often last_seen is written for a busy session
+const lastSeenResolution = time.Minute
+
+// Session represents a single logged-in device. It is stored in Redis under
+// session:<session_id>, and the IDs of a user's sessions are kept in the
+// user-sessions:<user_id> set. ExpiresAt is the absolute end of the session;
+// the Redis entry itself also lapses after the idle timeout without a refresh.
+type Session struct {
+	SessionID string `json:"session_id"`
+	UserID    string `json:"user_id"`
+	Device    string `json:"device"`
+	UserAgent string `json:"user_agent"`
+	IPAddress string `json:"ip_address"`
+	CreatedAt int64  `json:"created_at"`
+	ExpiresAt int64  `json:"expires_at"`
+	LastSeen  int64  `json:"last_seen"`
+}
+
+func sessionKey(sessionID string) string {
+	return "session:" + sessionID
+}
+
+func userSessionsKey(userID string) string {
+	return "user-sessions:" + userID
+}
+
+// Store reads and writes sessions in the auth Redis
+type Store struct {
+	Client *redis.Client
+	Policy token.Policy
+	// TrackLastSeen makes Check record when a session was last used. Only
+	// account-api, which shows it in the session list, turns it on; the other
+	// services check sessions on every request and would only add writes.
+	TrackLastSeen bool
+}
+
+// NewStore returns a store on client using policy for session lifetimes
+func NewStore(client *redis.Client, policy token.Policy) *Store {
+	return &Store{Client: client, Policy: policy}
+}
+
+// Create stores a new session and adds it to the user's session set
+func (s *Store) Create(ctx context.Context, session *Session) error {
+	sessionJson, err := json.Marshal(session)
+	if err != nil {
+		log.Printf("Failed to marshal session data: %v", err)
+		return err
+	}
+
+	ttl := s.Policy.SessionTTL(time.Now(), time.Unix(session.ExpiresAt, 0))
+	_, err = s.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, sessionKey(session.SessionID), sessionJson, ttl)
+		pipe.SAdd(ctx, userSessionsKey(session.UserID), session.SessionID)
+		// The set lives as long as the longest possible session; stale members are pruned by List
+		pipe.Expire(ctx, userSessionsKey(session.UserID), s.Policy.RefreshTokenLifetime)
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to store session in Redis: %v", err)
+		return err
+	}
+
+	log.Printf("Created session %s for user %s", session.SessionID, session.UserID)
+	return nil
+}
+
+// Get retrieves a session by ID
+func (s *Store) Get(ctx context.Context, sessionID string) (*Session, error) {
+	sessionJson, err := s.Client.Get(ctx, sessionKey(sessionID)).Result()
+	if err == redis.Nil {
+		return nil, ErrNotFound
+	} else if err != nil {
+		log.Printf("Failed to retrieve session %s from Redis: %v", sessionID, err)
+		return nil, err
+	}
+
+	var session Session
+	if err := json.Unmarshal([]byte(sessionJson), &session); err != nil {
+		log.Printf("Failed to unmarshal session data: %v", err)
+		return nil, err
+	}
+	return &session, nil
+}
+
+// Check validates that the session exists, belongs to the given user and has
+// not expired. With TrackLastSeen it also records the time it was last used,
+// to within lastSeenResolution.
+func (s *Store) Check(ctx context.Context, sessionID, userID string) (*Session, error) {
+	session, err := s.Get(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if session.UserID != userID {
+		log.Printf("Session %s does not belong to user %s", sessionID, userID)
+		return nil, ErrNotFound
+	}
+	if time.Now().Unix() > session.ExpiresAt {
+		log.Printf("Session %s for user %s is expired", sessionID, userID)
+		return nil, ErrNotFound
+	}
+
+	now := time.Now()
+	if s.TrackLastSeen && now.Sub(time.Unix(session.LastSeen, 0)) >= lastSeenResolution {
+		session.LastSeen = now.Unix()
+		if sessionJson, err := json.Marshal(session); err == nil {
+			// XX so a concurrent revoke is never undone by the touch
+			s.Client.SetXX(ctx, sessionKey(sessionID), sessionJson, redis.KeepTTL)
+		}
+	}
+	return session, nil
+}
+
+// Verify is Check for the auth middleware, which only needs to know the
+// session is live
+func (s *Store) Verify(ctx context.Context, sessionID, userID string) error {
+	_, err := s.Check(ctx, sessionID, userID)
+	return err
+}
+
+// Extend restarts the session's idle timeout after a refresh
+func (s *Store) Extend(ctx context.Context, session *Session) error {
+	ttl := s.Policy.SessionTTL(time.Now(), time.Unix(session.ExpiresAt, 0))
+	if ttl <= 0 {
+		return ErrNotFound
+	}
+	extended, err := s.Client.Expire(ctx, sessionKey(session.SessionID), ttl).Result()
+	if err != nil {
+		log.Printf("Failed to extend session %s: %v", session.SessionID, err)
+		return err
+	}
+	if !extended {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// List returns the user's active sessions, dropping IDs whose session has expired
+func (s *Store) List(ctx context.Context, userID string) ([]Session, error) {
+	sessionIDs, err := s.Client.SMembers(ctx, userSessionsKey(userID)).Result()
+	if err != nil {
+		log.Printf("Failed to list sessions for user %s: %v", userID, err)
+		return nil, err
+	}
+
+	sessions := []Session{}
+	for _, sessionID := range sessionIDs {
+		session, err := s.Get(ctx, sessionID)
+		if err == ErrNotFound {
+			s.Client.SRem(ctx, userSessionsKey(userID), sessionID)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+	return sessions, nil
+}
+
+// Revoke deletes one of the user's sessions
+func (s *Store) Revoke(ctx context.Context, userID, sessionID string) error {
+	session, err := s.Get(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	if session.UserID != userID {
+		return ErrNotFound
+	}
+
+	_, err = s.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, sessionKey(sessionID))
+		pipe.SRem(ctx, userSessionsKey(userID), sessionID)
+		s.announceRevocations(ctx, pipe, sessionID)
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to revoke session %s for user %s: %v", sessionID, userID, err)
+		return err
+	}
+
+	log.Printf("Revoked session %s for user %s", sessionID, userID)
+	return nil
+}
+
+// RevokeAll deletes every session belonging to the user. Revocation is by
+// session ID, never by issue time, so a login completing in the same instant
+// is not caught by it; only the sessions listed are removed from the set, so
+// such a login stays listed too.
+func (s *Store) RevokeAll(ctx context.Context, userID string) error {
+	sessionIDs, err := s.Client.SMembers(ctx, userSessionsKey(userID)).Result()
+	if err != nil {
+		log.Printf("Failed to list sessions for user %s: %v", userID, err)
+		return err
+	}
+
+	_, err = s.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, sessionID := range sessionIDs {
+			pipe.Del(ctx, sessionKey(sessionID))
+			pipe.SRem(ctx, userSessionsKey(userID), sessionID)
+		}
+		s.announceRevocations(ctx, pipe, sessionIDs...)
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to revoke sessions for user %s: %v", userID, err)
+		return err
+	}
+
+	log.Printf("Revoked %d sessions for user %s", len(sessionIDs), userID)
+	return nil
+}
+
+// RevokeOthers deletes every session of the user except the one given, so
+// the device making a sensitive change stays logged in
+func (s *Store) RevokeOthers(ctx context.Context, userID, keepSessionID string) error {
+	sessionIDs, err := s.Client.SMembers(ctx, userSessionsKey(userID)).Result()
+	if err != nil {
+		log.Printf("Failed to list sessions for user %s: %v", userID, err)
+		return err
+	}
+
+	var revoked []string
+	_, err = s.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, sessionID := range sessionIDs {
+			if sessionID == keepSessionID {
+				continue
+			}
+			pipe.Del(ctx, sessionKey(sessionID))
+			pipe.SRem(ctx, userSessionsKey(userID), sessionID)
+			revoked = append(revoked, sessionID)
+		}
+		s.announceRevocations(ctx, pipe, revoked...)
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to revoke sessions for user %s: %v", userID, err)
+		return err
+	}
+
+	log.Printf("Revoked %d other sessions for user %s", len(revoked), userID)
+	return nil
+}
@@ -0,0 +1,44 @@
+package session
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCheckTracksLastSeen(t *testing.T) {
+	store, _ := newTestStore(t)
+	ctx := context.Background()
+	created := createSession(t, store, "session-1", "user-1")
+
+	// Without tracking, checks only read
+	if _, err := store.Check(ctx, "session-1", "user-1"); err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	if stored, _ := store.Get(ctx, "session-1"); stored.LastSeen != 0 {
+		t.Fatalf("LastSeen = %d without TrackLastSeen", stored.LastSeen)
+	}
+
+	store.TrackLastSeen = true
+	before := time.Now().Unix()
+	if _, err := store.Check(ctx, "session-1", "user-1"); err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	stored, _ := store.Get(ctx, "session-1")
+	if stored.LastSeen < before {
+		t.Fatalf("LastSeen = %d, want at least %d", stored.LastSeen, before)
+	}
+
+	// A recent last use is not rewritten on every request
+	recent := time.Now().Add(-lastSeenResolution / 2).Unix()
+	created.LastSeen = recent
+	if err := store.Create(ctx, created); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := store.Check(ctx, "session-1", "user-1"); err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	if stored, _ := store.Get(ctx, "session-1"); stored.LastSeen != recent {
+		t.Fatalf("LastSeen = %d, want the recent %d left alone", stored.LastSeen, recent)
+	}
+}
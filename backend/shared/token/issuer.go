@@ -0,0 +1,41 @@
+package token
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Issuer mints access tokens signed with the key ring's current key
+type Issuer struct {
+	Keys     *KeyRing
+	Issuer   string
+	Audience string
+}
+
+// Issue generates an access token for the user's session. The session ID is
+// carried in the jti claim so each device's token can be validated and
+// revoked on its own.
+func (i *Issuer) Issue(userID, sessionID string, issuedAt, expiresAt time.Time) (string, error) {
+	claims := jwt.MapClaims{
+		"iss": i.Issuer,         // Issuer - the service minting the token
+		"aud": i.Audience,       // Audience - the services the token is for
+		"sub": userID,           // Subject - the user ID
+		"jti": sessionID,        // Token ID - the session the token belongs to
+		"iat": issuedAt.Unix(),  // Issued at time
+		"nbf": issuedAt.Unix(),  // Not valid before
+		"exp": expiresAt.Unix(), // Expiration time
+	}
+
+	// Sign with the current private key (RS256); the kid tells verifiers
+	// which published key to check it against
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = i.Keys.signingKID
+
+	tokenString, err := token.SignedString(i.Keys.signingKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token: %v", err)
+	}
+	return tokenString, nil
+}
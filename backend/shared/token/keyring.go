@@ -0,0 +1,157 @@
+package token
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+
+	"shared/jwks"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// KeyRing holds the key access tokens are signed with and every public key
+// that is still accepted. Rotating keeps the old public key in the ring until
+// the tokens it signed have expired.
+type KeyRing struct {
+	signingKID string
+	signingKey *rsa.PrivateKey
+	publicKeys map[string]*rsa.PublicKey
+	// order keeps the JWKS output stable, signing key first
+	order []string
+}
+
+// ErrNoSigningKey is returned by LoadKeyRing when there is no private key and
+// an ephemeral one is not allowed
+var ErrNoSigningKey = errors.New("JWT_PRIVATE_KEY is not set")
+
+// LoadKeyRing builds the key ring from PEM data: the current private key and
+// any retired public keys. A missing private key is an error unless
+// allowEphemeral is set, for development only: the generated key only works
+// for a single replica and invalidates tokens on restart.
+func LoadKeyRing(privateKeyPEM, retiredPublicKeysPEM string, allowEphemeral bool) (*KeyRing, error) {
+	var signingKey *rsa.PrivateKey
+	if privateKeyPEM == "" {
+		if !allowEphemeral {
+			return nil, ErrNoSigningKey
+		}
+		log.Println("JWT_PRIVATE_KEY is not set, generating an ephemeral signing key")
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate signing key: %v", err)
+		}
+		signingKey = key
+	} else {
+		key, err := parsePrivateKey([]byte(privateKeyPEM))
+		if err != nil {
+			return nil, err
+		}
+		signingKey = key
+	}
+
+	ring := &KeyRing{
+		signingKID: jwks.Thumbprint(&signingKey.PublicKey),
+		signingKey: signingKey,
+		publicKeys: make(map[string]*rsa.PublicKey),
+	}
+	ring.add(ring.signingKID, &signingKey.PublicKey)
+
+	rest := []byte(retiredPublicKeysPEM)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		key, err := parsePublicKey(block)
+		if err != nil {
+			return nil, err
+		}
+		ring.add(jwks.Thumbprint(key), key)
+	}
+
+	log.Printf("JWT signing key %s loaded, %d verification keys published", ring.signingKID, len(ring.order))
+	return ring, nil
+}
+
+func (k *KeyRing) add(kid string, key *rsa.PublicKey) {
+	if _, ok := k.publicKeys[kid]; ok {
+		return
+	}
+	k.publicKeys[kid] = key
+	k.order = append(k.order, kid)
+}
+
+// PublicKey returns the verification key for kid
+func (k *KeyRing) PublicKey(kid string) (*rsa.PublicKey, bool) {
+	key, ok := k.publicKeys[kid]
+	return key, ok
+}
+
+// Keyfunc looks up the public key named by the token's kid, for Verifier
+func (k *KeyRing) Keyfunc(ctx context.Context) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := k.PublicKey(kid)
+		if !ok {
+			return nil, errors.New("no key with the token's kid")
+		}
+		return key, nil
+	}
+}
+
+// KeySet returns the public keys as a JWKS document
+func (k *KeyRing) KeySet() jwks.KeySet {
+	set := jwks.KeySet{Keys: make([]jwks.JSONWebKey, 0, len(k.order))}
+	for _, kid := range k.order {
+		set.Keys = append(set.Keys, jwks.FromRSAPublicKey(kid, k.publicKeys[kid]))
+	}
+	return set
+}
+
+func parsePrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("JWT private key is not PEM encoded")
+	}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		rsaKey, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("JWT private key is not an RSA key")
+		}
+		return rsaKey, nil
+	default:
+		return nil, fmt.Errorf("unsupported private key PEM type %q", block.Type)
+	}
+}
+
+func parsePublicKey(block *pem.Block) (*rsa.PublicKey, error) {
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return nil, errors.New("retired JWT public key is not an RSA key")
+		}
+		return rsaKey, nil
+	default:
+		return nil, fmt.Errorf("unsupported public key PEM type %q", block.Type)
+	}
+}
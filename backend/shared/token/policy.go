@@ -0,0 +1,87 @@
+package token
+
+import (
+	"fmt"
+	"time"
+
+	"shared/config"
+)
+
+// Policy holds the lifetimes every token and session expiry is derived from
+type Policy struct {
+	// AccessTokenLifetime is how long a JWT stays valid
+	AccessTokenLifetime time.Duration
+	// RefreshTokenLifetime is the absolute lifetime of a session and its refresh tokens
+	RefreshTokenLifetime time.Duration
+	// IdleTimeout ends a session that has not been refreshed for this long
+	IdleTimeout time.Duration
+}
+
+// DefaultPolicy returns the lifetimes used when nothing is configured
+func DefaultPolicy() Policy {
+	return Policy{
+		AccessTokenLifetime:  15 * time.Minute,
+		RefreshTokenLifetime: 30 * 24 * time.Hour,
+		IdleTimeout:          7 * 24 * time.Hour,
+	}
+}
+
+// LoadPolicy reads ACCESS_TOKEN_TTL, REFRESH_TOKEN_TTL and
+// SESSION_IDLE_TIMEOUT (Go durations such as "15m" or "720h"), falling back
+// to the defaults for any that are unset
+func LoadPolicy() (Policy, error) {
+	policy := DefaultPolicy()
+	for _, setting := range []struct {
+		name  string
+		value *time.Duration
+	}{
+		{"ACCESS_TOKEN_TTL", &policy.AccessTokenLifetime},
+		{"REFRESH_TOKEN_TTL", &policy.RefreshTokenLifetime},
+		{"SESSION_IDLE_TIMEOUT", &policy.IdleTimeout},
+	} {
+		duration, err := config.DurationFromEnv(setting.name, *setting.value)
+		if err != nil {
+			return Policy{}, err
+		}
+		if duration == 0 {
+			return Policy{}, fmt.Errorf("%s must be a positive duration", setting.name)
+		}
+		*setting.value = duration
+	}
+
+	if policy.AccessTokenLifetime > policy.RefreshTokenLifetime {
+		return Policy{}, fmt.Errorf("ACCESS_TOKEN_TTL (%s) must not exceed REFRESH_TOKEN_TTL (%s)", policy.AccessTokenLifetime, policy.RefreshTokenLifetime)
+	}
+	if policy.IdleTimeout < policy.AccessTokenLifetime {
+		return Policy{}, fmt.Errorf("SESSION_IDLE_TIMEOUT (%s) must be at least ACCESS_TOKEN_TTL (%s)", policy.IdleTimeout, policy.AccessTokenLifetime)
+	}
+	return policy, nil
+}
+
+// AccessExpiry returns when an access token issued at now expires. It never
+// outlives the session it belongs to.
+func (p Policy) AccessExpiry(now, sessionExpiresAt time.Time) time.Time {
+	expiresAt := now.Add(p.AccessTokenLifetime)
+	if expiresAt.After(sessionExpiresAt) {
+		return sessionExpiresAt
+	}
+	return expiresAt
+}
+
+// SessionExpiry returns the absolute end of a session started at now
+func (p Policy) SessionExpiry(now time.Time) time.Time {
+	return now.Add(p.RefreshTokenLifetime)
+}
+
+// SessionTTL returns how long a session should be kept after activity at now:
+// the idle timeout, capped at the session's absolute expiry
+func (p Policy) SessionTTL(now, sessionExpiresAt time.Time) time.Duration {
+	ttl := p.IdleTimeout
+	if remaining := sessionExpiresAt.Sub(now); remaining < ttl {
+		ttl = remaining
+	}
+	if ttl < 0 {
+		return 0
+	}
+	return ttl
+}
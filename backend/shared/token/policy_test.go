@@ -0,0 +1,110 @@
+package token
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoadPolicyDefaults(t *testing.T) {
+	for _, name := range []string{"ACCESS_TOKEN_TTL", "REFRESH_TOKEN_TTL", "SESSION_IDLE_TIMEOUT"} {
+		t.Setenv(name, "")
+	}
+	policy, err := LoadPolicy()
+	if err != nil {
+		t.Fatalf("LoadPolicy: %v", err)
+	}
+	if policy != DefaultPolicy() {
+		t.Errorf("LoadPolicy = %+v, want the defaults %+v", policy, DefaultPolicy())
+	}
+}
+
+func TestLoadPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		access  string
+		refresh string
+		idle    string
+		want    Policy
+		wantErr bool
+	}{
+		{
+			name:   "configured",
+			access: "5m", refresh: "24h", idle: "1h",
+			want: Policy{AccessTokenLifetime: 5 * time.Minute, RefreshTokenLifetime: 24 * time.Hour, IdleTimeout: time.Hour},
+		},
+		{
+			name:   "partly configured",
+			access: "10m",
+			want:   Policy{AccessTokenLifetime: 10 * time.Minute, RefreshTokenLifetime: 30 * 24 * time.Hour, IdleTimeout: 7 * 24 * time.Hour},
+		},
+		{name: "not a duration", access: "fifteen", wantErr: true},
+		{name: "negative", refresh: "-1h", wantErr: true},
+		{name: "zero", idle: "0s", wantErr: true},
+		{name: "access outlives the session", access: "2h", refresh: "1h", idle: "2h", wantErr: true},
+		{name: "idle timeout shorter than an access token", access: "15m", idle: "5m", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ACCESS_TOKEN_TTL", tt.access)
+			t.Setenv("REFRESH_TOKEN_TTL", tt.refresh)
+			t.Setenv("SESSION_IDLE_TIMEOUT", tt.idle)
+
+			policy, err := LoadPolicy()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("LoadPolicy = %+v, want an error", policy)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadPolicy: %v", err)
+			}
+			if policy != tt.want {
+				t.Errorf("LoadPolicy = %+v, want %+v", policy, tt.want)
+			}
+		})
+	}
+}
+
+func TestAccessExpiry(t *testing.T) {
+	policy := DefaultPolicy()
+
+	sessionEnd := testNow.Add(policy.RefreshTokenLifetime)
+	if got, want := policy.AccessExpiry(testNow, sessionEnd), testNow.Add(15*time.Minute); !got.Equal(want) {
+		t.Errorf("AccessExpiry = %s, want %s", got, want)
+	}
+
+	// A token issued near the end of its session stops with the session
+	sessionEnd = testNow.Add(5 * time.Minute)
+	if got := policy.AccessExpiry(testNow, sessionEnd); !got.Equal(sessionEnd) {
+		t.Errorf("AccessExpiry = %s, want the session end %s", got, sessionEnd)
+	}
+}
+
+func TestSessionExpiry(t *testing.T) {
+	policy := DefaultPolicy()
+	if got, want := policy.SessionExpiry(testNow), testNow.Add(30*24*time.Hour); !got.Equal(want) {
+		t.Errorf("SessionExpiry = %s, want %s", got, want)
+	}
+}
+
+func TestSessionTTL(t *testing.T) {
+	policy := DefaultPolicy()
+	tests := []struct {
+		name       string
+		sessionEnd time.Time
+		want       time.Duration
+	}{
+		{"idle timeout", testNow.Add(policy.RefreshTokenLifetime), policy.IdleTimeout},
+		{"capped at the session end", testNow.Add(time.Hour), time.Hour},
+		{"session over", testNow.Add(-time.Minute), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.SessionTTL(testNow, tt.sessionEnd); got != tt.want {
+				t.Errorf("SessionTTL = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package token
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Errors returned by Verifier.Verify. Each one maps to its own 401 response
+// through UnauthorizedMessage.
+var (
+	ErrMalformedToken      = errors.New("malformed token")
+	ErrUnexpectedAlgorithm = errors.New("unexpected signing algorithm")
+	ErrInvalidSignature    = errors.New("invalid token signature")
+	ErrUnknownKey          = errors.New("unknown signing key")
+	ErrTokenExpired        = errors.New("token has expired")
+	ErrTokenNotYetValid    = errors.New("token is not valid yet")
+	ErrTokenIssuedInFuture = errors.New("token issued in the future")
+	ErrInvalidIssuer       = errors.New("invalid token issuer")
+	ErrInvalidAudience     = errors.New("invalid token audience")
+	ErrMissingClaim        = errors.New("missing required claim")
+)
+
+// Verifier checks access tokens issued by account-api: an RS256 signature
+// from a published key, exp, nbf and iat with some clock skew allowed, the
+// iss and aud claims, and the sub and jti naming the user and session
+type Verifier struct {
+	// Keyfunc returns the key lookup for a request, e.g. (*jwks.Cache).Keyfunc
+	Keyfunc   func(ctx context.Context) jwt.Keyfunc
+	Algorithm string
+	Issuer    string
+	Audience  string
+	ClockSkew time.Duration
+	// Now is the clock used for time checks, time.Now when nil
+	Now func() time.Time
+}
+
+// Verify parses the token and returns its claims if every check passes
+func (v *Verifier) Verify(ctx context.Context, tokenString string) (jwt.MapClaims, error) {
+	parser := &jwt.Parser{
+		// Time claims are checked below with the allowed clock skew
+		SkipClaimsValidation: true,
+		UseJSONNumber:        true,
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := parser.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		// Checked before the key is chosen, so an HMAC or "none" token can
+		// never be verified with something it should not be
+		if token.Method.Alg() != v.Algorithm {
+			return nil, ErrUnexpectedAlgorithm
+		}
+		key, err := v.Keyfunc(ctx)(token)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrUnknownKey, err)
+		}
+		return key, nil
+	})
+	if err != nil {
+		return nil, classifyParseError(err)
+	}
+
+	if err := v.verifyClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// classifyParseError turns the jwt library's validation error into one of
+// the typed errors
+func classifyParseError(err error) error {
+	switch {
+	case errors.Is(err, ErrUnexpectedAlgorithm):
+		return ErrUnexpectedAlgorithm
+	case errors.Is(err, ErrUnknownKey):
+		return fmt.Errorf("%w: %v", ErrUnknownKey, err)
+	}
+
+	var validationErr *jwt.ValidationError
+	if errors.As(err, &validationErr) {
+		switch {
+		case validationErr.Errors&jwt.ValidationErrorMalformed != 0:
+			return fmt.Errorf("%w: %v", ErrMalformedToken, err)
+		case validationErr.Errors&jwt.ValidationErrorSignatureInvalid != 0:
+			return ErrInvalidSignature
+		case validationErr.Errors&jwt.ValidationErrorUnverifiable != 0:
+			// The alg header names a method the library does not know
+			return ErrUnexpectedAlgorithm
+		}
+	}
+	return fmt.Errorf("%w: %v", ErrMalformedToken, err)
+}
+
+func (v *Verifier) verifyClaims(claims jwt.MapClaims) error {
+	now := time.Now()
+	if v.Now != nil {
+		now = v.Now()
+	}
+
+	exp, ok, err := timeClaim(claims, "exp")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: exp", ErrMissingClaim)
+	}
+	if !now.Before(exp.Add(v.ClockSkew)) {
+		return ErrTokenExpired
+	}
+
+	nbf, ok, err := timeClaim(claims, "nbf")
+	if err != nil {
+		return err
+	}
+	if ok && now.Add(v.ClockSkew).Before(nbf) {
+		return ErrTokenNotYetValid
+	}
+
+	iat, ok, err := timeClaim(claims, "iat")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: iat", ErrMissingClaim)
+	}
+	if now.Add(v.ClockSkew).Before(iat) {
+		return ErrTokenIssuedInFuture
+	}
+
+	// Every access token belongs to a user's session
+	for _, name := range []string{"sub", "jti"} {
+		if value, _ := claims[name].(string); value == "" {
+			return fmt.Errorf("%w: %s", ErrMissingClaim, name)
+		}
+	}
+
+	if iss, _ := claims["iss"].(string); iss == "" || iss != v.Issuer {
+		return ErrInvalidIssuer
+	}
+	if !hasAudience(claims["aud"], v.Audience) {
+		return ErrInvalidAudience
+	}
+	return nil
+}
+
+// timeClaim reads a NumericDate claim, reporting whether it was present
+func timeClaim(claims jwt.MapClaims, name string) (time.Time, bool, error) {
+	value, ok := claims[name]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	var seconds float64
+	switch number := value.(type) {
+	case json.Number:
+		parsed, err := number.Float64()
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("%w: %s is not a number", ErrMalformedToken, name)
+		}
+		seconds = parsed
+	case float64:
+		seconds = number
+	default:
+		return time.Time{}, false, fmt.Errorf("%w: %s is not a number", ErrMalformedToken, name)
+	}
+	return time.Unix(int64(seconds), 0), true, nil
+}
+
+// hasAudience reports whether the aud claim, a string or a list of strings,
+// contains audience
+func hasAudience(aud interface{}, audience string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == audience
+	case []interface{}:
+		for _, entry := range aud {
+			if s, ok := entry.(string); ok && s == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// UnauthorizedMessage is the 401 response body for a verification error
+func UnauthorizedMessage(err error) string {
+	switch {
+	case errors.Is(err, ErrTokenExpired):
+		return "Token has expired"
+	case errors.Is(err, ErrTokenNotYetValid), errors.Is(err, ErrTokenIssuedInFuture):
+		return "Token is not valid yet"
+	case errors.Is(err, ErrUnexpectedAlgorithm):
+		return "Token uses an unsupported signing algorithm"
+	case errors.Is(err, ErrInvalidSignature), errors.Is(err, ErrUnknownKey):
+		return "Token signature is invalid"
+	case errors.Is(err, ErrInvalidIssuer):
+		return "Token was not issued by a trusted issuer"
+	case errors.Is(err, ErrInvalidAudience):
+		return "Token is not intended for this service"
+	case errors.Is(err, ErrMissingClaim):
+		return "Token is missing required claims"
+	default:
+		return "Token is malformed"
+	}
+}
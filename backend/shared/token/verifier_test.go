@@ -0,0 +1,326 @@
+package token
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	testIssuer   = "https://account.example.com"
+	testAudience = "canvas-collab"
+)
+
+// testNow is the fixed clock every verifier test runs at
+var testNow = time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// newTestKey generates an RSA key and returns it with its PEM encoding
+func newTestKey(t *testing.T) (*rsa.PrivateKey, string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	block := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+	return key, string(pem.EncodeToMemory(block))
+}
+
+// newTestKeyRing returns a key ring signing with a freshly generated key
+func newTestKeyRing(t *testing.T) *KeyRing {
+	t.Helper()
+	_, keyPEM := newTestKey(t)
+	ring, err := LoadKeyRing(keyPEM, "", false)
+	if err != nil {
+		t.Fatalf("LoadKeyRing: %v", err)
+	}
+	return ring
+}
+
+func newTestVerifier(ring *KeyRing) *Verifier {
+	return &Verifier{
+		Keyfunc:   ring.Keyfunc,
+		Algorithm: jwt.SigningMethodRS256.Alg(),
+		Issuer:    testIssuer,
+		Audience:  testAudience,
+		ClockSkew: 30 * time.Second,
+		Now:       func() time.Time { return testNow },
+	}
+}
+
+// validClaims are what the issuer puts in a token minted a minute before testNow
+func validClaims() jwt.MapClaims {
+	issuedAt := testNow.Add(-time.Minute)
+	return jwt.MapClaims{
+		"iss": testIssuer,
+		"aud": testAudience,
+		"sub": "user-1",
+		"jti": "session-1",
+		"iat": issuedAt.Unix(),
+		"nbf": issuedAt.Unix(),
+		"exp": issuedAt.Add(15 * time.Minute).Unix(),
+	}
+}
+
+func withClaims(change func(jwt.MapClaims)) jwt.MapClaims {
+	claims := validClaims()
+	change(claims)
+	return claims
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, key interface{}, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+	return signed
+}
+
+func TestVerifier(t *testing.T) {
+	ring := newTestKeyRing(t)
+	verifier := newTestVerifier(ring)
+	forgedKey, _ := newTestKey(t)
+	publicKeyDER := x509.MarshalPKCS1PublicKey(&ring.signingKey.PublicKey)
+
+	signValid := func(claims jwt.MapClaims) string {
+		return sign(t, jwt.SigningMethodRS256, ring.signingKey, ring.signingKID, claims)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+		wantMsg string
+	}{
+		{
+			name:  "valid",
+			token: signValid(validClaims()),
+		},
+		{
+			name:  "audience list containing ours",
+			token: signValid(withClaims(func(c jwt.MapClaims) { c["aud"] = []string{"other", testAudience} })),
+		},
+		{
+			name:  "expired within clock skew",
+			token: signValid(withClaims(func(c jwt.MapClaims) { c["exp"] = testNow.Add(-10 * time.Second).Unix() })),
+		},
+		{
+			name:    "expired",
+			token:   signValid(withClaims(func(c jwt.MapClaims) { c["exp"] = testNow.Add(-time.Minute).Unix() })),
+			wantErr: ErrTokenExpired,
+			wantMsg: "Token has expired",
+		},
+		{
+			name:    "not valid yet",
+			token:   signValid(withClaims(func(c jwt.MapClaims) { c["nbf"] = testNow.Add(time.Minute).Unix() })),
+			wantErr: ErrTokenNotYetValid,
+			wantMsg: "Token is not valid yet",
+		},
+		{
+			name:    "issued in the future",
+			token:   signValid(withClaims(func(c jwt.MapClaims) { c["iat"] = testNow.Add(time.Minute).Unix() })),
+			wantErr: ErrTokenIssuedInFuture,
+			wantMsg: "Token is not valid yet",
+		},
+		{
+			name:    "forged with another key under our kid",
+			token:   sign(t, jwt.SigningMethodRS256, forgedKey, ring.signingKID, validClaims()),
+			wantErr: ErrInvalidSignature,
+			wantMsg: "Token signature is invalid",
+		},
+		{
+			name: "payload tampered after signing",
+			token: func() string {
+				parts := strings.Split(signValid(validClaims()), ".")
+				other := strings.Split(signValid(withClaims(func(c jwt.MapClaims) { c["sub"] = "admin" })), ".")
+				return parts[0] + "." + other[1] + "." + parts[2]
+			}(),
+			wantErr: ErrInvalidSignature,
+			wantMsg: "Token signature is invalid",
+		},
+		{
+			name:    "unknown kid",
+			token:   sign(t, jwt.SigningMethodRS256, forgedKey, "not-a-published-key", validClaims()),
+			wantErr: ErrUnknownKey,
+			wantMsg: "Token signature is invalid",
+		},
+		{
+			name:    "missing kid",
+			token:   sign(t, jwt.SigningMethodRS256, ring.signingKey, "", validClaims()),
+			wantErr: ErrUnknownKey,
+			wantMsg: "Token signature is invalid",
+		},
+		{
+			name:    "HS256 keyed with our public key",
+			token:   sign(t, jwt.SigningMethodHS256, publicKeyDER, ring.signingKID, validClaims()),
+			wantErr: ErrUnexpectedAlgorithm,
+			wantMsg: "Token uses an unsupported signing algorithm",
+		},
+		{
+			name:    "RS512 instead of RS256",
+			token:   sign(t, jwt.SigningMethodRS512, ring.signingKey, ring.signingKID, validClaims()),
+			wantErr: ErrUnexpectedAlgorithm,
+			wantMsg: "Token uses an unsupported signing algorithm",
+		},
+		{
+			name:    "alg none",
+			token:   sign(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, ring.signingKID, validClaims()),
+			wantErr: ErrUnexpectedAlgorithm,
+			wantMsg: "Token uses an unsupported signing algorithm",
+		},
+		{
+			name: "alg the library does not know",
+			token: func() string {
+				parts := strings.Split(signValid(validClaims()), ".")
+				header := jwt.EncodeSegment([]byte(`{"alg":"XS999","kid":"` + ring.signingKID + `","typ":"JWT"}`))
+				return header + "." + parts[1] + "." + parts[2]
+			}(),
+			wantErr: ErrUnexpectedAlgorithm,
+			wantMsg: "Token uses an unsupported signing algorithm",
+		},
+		{
+			name:    "missing exp",
+			token:   signValid(withClaims(func(c jwt.MapClaims) { delete(c, "exp") })),
+			wantErr: ErrMissingClaim,
+			wantMsg: "Token is missing required claims",
+		},
+		{
+			name:    "missing iat",
+			token:   signValid(withClaims(func(c jwt.MapClaims) { delete(c, "iat") })),
+			wantErr: ErrMissingClaim,
+			wantMsg: "Token is missing required claims",
+		},
+		{
+			name:    "missing jti",
+			token:   signValid(withClaims(func(c jwt.MapClaims) { delete(c, "jti") })),
+			wantErr: ErrMissingClaim,
+			wantMsg: "Token is missing required claims",
+		},
+		{
+			name:    "empty sub",
+			token:   signValid(withClaims(func(c jwt.MapClaims) { c["sub"] = "" })),
+			wantErr: ErrMissingClaim,
+			wantMsg: "Token is missing required claims",
+		},
+		{
+			name:    "wrong issuer",
+			token:   signValid(withClaims(func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" })),
+			wantErr: ErrInvalidIssuer,
+			wantMsg: "Token was not issued by a trusted issuer",
+		},
+		{
+			name:    "wrong audience",
+			token:   signValid(withClaims(func(c jwt.MapClaims) { c["aud"] = "some-other-service" })),
+			wantErr: ErrInvalidAudience,
+			wantMsg: "Token is not intended for this service",
+		},
+		{
+			name:    "exp is not a number",
+			token:   signValid(withClaims(func(c jwt.MapClaims) { c["exp"] = "tomorrow" })),
+			wantErr: ErrMalformedToken,
+			wantMsg: "Token is malformed",
+		},
+		{
+			name:    "not a JWT",
+			token:   "not-a-token",
+			wantErr: ErrMalformedToken,
+			wantMsg: "Token is malformed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := verifier.Verify(context.Background(), tt.token)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("Verify returned %v, want success", err)
+				}
+				if claims["sub"] != "user-1" {
+					t.Errorf("sub = %v, want user-1", claims["sub"])
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify returned %v, want %v", err, tt.wantErr)
+			}
+			if claims != nil {
+				t.Errorf("Verify returned claims alongside %v", err)
+			}
+			if got := UnauthorizedMessage(err); got != tt.wantMsg {
+				t.Errorf("UnauthorizedMessage = %q, want %q", got, tt.wantMsg)
+			}
+		})
+	}
+}
+
+func TestVerifierAcceptsRetiredKey(t *testing.T) {
+	oldKey, _ := newTestKey(t)
+	oldKID := ""
+	_, newKeyPEM := newTestKey(t)
+	retiredPEM := string(pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PUBLIC KEY",
+		Bytes: x509.MarshalPKCS1PublicKey(&oldKey.PublicKey),
+	}))
+
+	ring, err := LoadKeyRing(newKeyPEM, retiredPEM, false)
+	if err != nil {
+		t.Fatalf("LoadKeyRing: %v", err)
+	}
+	for _, kid := range ring.order {
+		if kid != ring.signingKID {
+			oldKID = kid
+		}
+	}
+	if oldKID == "" {
+		t.Fatal("retired key was not added to the ring")
+	}
+
+	token := sign(t, jwt.SigningMethodRS256, oldKey, oldKID, validClaims())
+	if _, err := newTestVerifier(ring).Verify(context.Background(), token); err != nil {
+		t.Fatalf("token signed with a retired key was rejected: %v", err)
+	}
+}
+
+func TestLoadKeyRingWithoutPrivateKey(t *testing.T) {
+	if _, err := LoadKeyRing("", "", false); err != ErrNoSigningKey {
+		t.Fatalf("missing key: err = %v, want ErrNoSigningKey", err)
+	}
+
+	ring, err := LoadKeyRing("", "", true)
+	if err != nil {
+		t.Fatalf("LoadKeyRing with an ephemeral key: %v", err)
+	}
+	if ring.signingKey == nil || len(ring.order) != 1 {
+		t.Fatalf("ephemeral ring has %d keys", len(ring.order))
+	}
+}
+
+func TestIssuedTokensVerify(t *testing.T) {
+	ring := newTestKeyRing(t)
+	issuer := &Issuer{Keys: ring, Issuer: testIssuer, Audience: testAudience}
+	issuedAt := testNow.Add(-time.Minute)
+
+	token, err := issuer.Issue("user-1", "session-1", issuedAt, issuedAt.Add(15*time.Minute))
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	claims, err := newTestVerifier(ring).Verify(context.Background(), token)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if claims["sub"] != "user-1" || claims["jti"] != "session-1" {
+		t.Errorf("claims = %v, want sub user-1 and jti session-1", claims)
+	}
+}
@@ -10,6 +10,25 @@ const axiosInstance = axios.create({
   timeout: 5000,
 });
 
+// The refresh currently in flight, shared by every caller that needs one
+let refreshInFlight = null;
+
+const refreshTokens = async () => {
+  try {
+    const userData = cookieService.getCookie('user_data');
+    if (!userData || !userData.refresh_token) {
+      throw new Error('No refresh token available');
+    }
+    const response = await axiosInstance.post(`/refresh`, { refresh_token: userData.refresh_token });
+    cookieService.setCookie('user_data', { ...userData, ...response.data });
+    return response.data;
+  } catch (error) {
+    console.error('Refresh error:', error);
+    cookieService.deleteCookie('user_data');
+    throw error;
+  }
+};
+
 export const authService = {
   // Register user with email and password
   register: async (email, password) => {
@@ -45,11 +64,40 @@ export const authService = {
     }
   },
 
+  // Complete a login that returned mfa_required, using the TOTP code from the
+  // authenticator app
+  loginMFA: async (mfa_token, code) => {
+    try {
+      const response = await axiosInstance.post(`/login/mfa`, { mfa_token, code });
+      if (response.data.jwt_token) {
+        cookieService.setCookie('user_data', response.data);
+      }
+      return response.data;
+    } catch (error) {
+      console.error('MFA login error:', error);
+      throw error;
+    }
+  },
+
+  // Exchange the refresh token for a new access token.
+  // The refresh token is rotated on every use, so the stored one is replaced.
+  // Calls made while a refresh is in flight wait for it instead of sending
+  // the same refresh token again, which the server treats as reuse and
+  // answers by revoking the whole session.
+  refresh: () => {
+    if (!refreshInFlight) {
+      refreshInFlight = refreshTokens().finally(() => {
+        refreshInFlight = null;
+      });
+    }
+    return refreshInFlight;
+  },
+
   // Confirm user registration (could be email verification)
-  confirm: async (confirmation_code) => {
+  confirm: async (email, confirmation_code) => {
     try {
 
-      const response = await axiosInstance.post(`/confirm`, {confirmation_code });
+      const response = await axiosInstance.post(`/confirm`, { email, confirmation_code });
       console.log('Confirmation response:', response.data);
 
       return response.data;
@@ -59,6 +107,28 @@ export const authService = {
     }
   },
 
+  // Send a new confirmation code if the first one never arrived
+  resendConfirmation: async (email) => {
+    try {
+      const response = await axiosInstance.post(`/confirm/resend`, { email });
+      return response.data;
+    } catch (error) {
+      console.error('Resend confirmation error:', error);
+      throw error;
+    }
+  },
+
+  // Check whether an account is still pending confirmation
+  confirmationStatus: async (email) => {
+    try {
+      const response = await axiosInstance.get(`/confirm/status`, { params: { email } });
+      return response.data.status;
+    } catch (error) {
+      console.error('Confirmation status error:', error);
+      throw error;
+    }
+  },
+
   // Log out the user
   logout: async () => {
     try {
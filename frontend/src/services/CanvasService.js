@@ -1,5 +1,6 @@
 import axios from 'axios';
 import { cookieService } from './CookieService';
+import { authService } from './AuthService';
 
 const backendURL = "http://localhost:8080/";
 
@@ -8,6 +9,26 @@ const axiosInstance = axios.create({
   timeout: 5000,
 });
 
+// Access tokens are short-lived: on a 401, refresh once and retry the request.
+// Requests failing together all wait for the same refresh, and one that was
+// sent with a token replaced since is just retried with the new one.
+axiosInstance.interceptors.response.use(
+    (response) => response,
+    async (error) => {
+      const request = error.config;
+      if (error.response?.status !== 401 || !request || request._retried) {
+        throw error;
+      }
+      request._retried = true;
+      const sentWith = request.headers?.Authorization;
+      if (!sentWith || sentWith === getAuthHeader().Authorization) {
+        await authService.refresh();
+      }
+      request.headers = { ...request.headers, ...getAuthHeader() };
+      return axiosInstance(request);
+    }
+);
+
 // Utility function to retrieve the authentication header
 const getAuthHeader = () => {
   const userData = cookieService.getCookie('user_data');
@@ -34,15 +55,32 @@ export const canvasService = {
     }
   },
 
-  // Get all canvases for the current user
-  getUserCanvases: async () => {
+  // Get a page of canvases for the current user.
+  // options: { sort, order, filter, q, limit, cursor }; pass the returned next_cursor to fetch the next page
+  listCanvases: async (options = {}) => {
     try {
-      console.log(`Fetching all canvases for the user.`);
       const response = await axiosInstance.get(`/canvases`, {
         headers: getAuthHeader(),
+        params: options,
       });
-      console.log('Get user canvases response:', response.data);
+      console.log('List canvases response:', response.data);
       return response.data;
+    } catch (error) {
+      console.error('List canvases error:', error.response?.data || error.message);
+      throw error;
+    }
+  },
+
+  // Get the first page of canvases for the current user
+  getUserCanvases: async (options = {}) => {
+    try {
+      console.log(`Fetching canvases for the user.`);
+      const response = await axiosInstance.get(`/canvases`, {
+        headers: getAuthHeader(),
+        params: options,
+      });
+      console.log('Get user canvases response:', response.data);
+      return response.data.canvases;
     } catch (error) {
       console.error('Get user canvases error:', error.response?.data || error.message);
       throw error;
@@ -68,7 +106,7 @@ export const canvasService = {
   updateCanvas: async (canvasId, canvasName) => {
     try {
       console.log(`Updating canvas with ID: ${canvasId}`);
-      const response = await axiosInstance.put(
+      const response = await axiosInstance.patch(
           `/canvases/${canvasId}`,
           { canvas_name: canvasName },
           { headers: getAuthHeader() }
@@ -4,12 +4,15 @@
 NAMESPACE="db"  # Namespace where Cassandra is deployed
 CONFIGMAP_NAME="cassandra-schema"  # Name of the ConfigMap
 SCHEMA_FILE="schema.cql"  # Path to the schema file
+MIGRATIONS_FILE="migrations.cql"  # Columns added to existing tables
 
-# Check if the schema file exists
-if [ ! -f "$SCHEMA_FILE" ]; then
-  echo "Error: Schema file '$SCHEMA_FILE' not found. Please ensure it exists in the current directory."
-  exit 1
-fi
+# Check if the schema files exist
+for FILE in "$SCHEMA_FILE" "$MIGRATIONS_FILE"; do
+  if [ ! -f "$FILE" ]; then
+    echo "Error: Schema file '$FILE' not found. Please ensure it exists in the current directory."
+    exit 1
+  fi
+done
 
 # Create the namespace if it doesn't exist
 kubectl get namespace $NAMESPACE >/dev/null 2>&1
@@ -22,6 +25,7 @@ fi
 echo "Creating ConfigMap '$CONFIGMAP_NAME' in namespace '$NAMESPACE'..."
 kubectl create configmap $CONFIGMAP_NAME \
   --from-file=$SCHEMA_FILE \
+  --from-file=$MIGRATIONS_FILE \
   --namespace=$NAMESPACE \
   --dry-run=client -o yaml | kubectl apply -f -
 
@@ -57,12 +57,14 @@ if [[ ! -f "$ENV_FILE" ]]; then
 fi
 
 # 3. Extract sensitive data from the ENV_FILE
-JWT_SECRET_KEY=$(grep -w "JWT_SECRET_KEY" "$ENV_FILE" | cut -d '=' -f2)
+JWT_PRIVATE_KEY_FILE=$(grep -w "JWT_PRIVATE_KEY_FILE" "$ENV_FILE" | cut -d '=' -f2)
+JWT_RETIRED_PUBLIC_KEYS_FILE=$(grep -w "JWT_RETIRED_PUBLIC_KEYS_FILE" "$ENV_FILE" | cut -d '=' -f2)
 AUTH_REDIS_PASSWORD=$(grep -w "AUTH_REDIS_PASSWORD" "$ENV_FILE" | cut -d '=' -f2)
 COGNITO_USER_POOL_ID=$(grep -w "COGNITO_USER_POOL_ID" "$ENV_FILE" | cut -d '=' -f2)
 COGNITO_APP_CLIENT_ID=$(grep -w "COGNITO_APP_CLIENT_ID" "$ENV_FILE" | cut -d '=' -f2)
 COGNITO_APP_CLIENT_SECRET=$(grep -w "COGNITO_APP_CLIENT_SECRET" "$ENV_FILE" | cut -d '=' -f2)
 AWS_REGION=$(grep -w "AWS_REGION" "$ENV_FILE" | cut -d '=' -f2)
+ADMIN_API_TOKEN=$(grep -w "ADMIN_API_TOKEN" "$ENV_FILE" | cut -d '=' -f2)
 
 # New drawing Redis variables
 DRAWING_REDIS_HOST=$(grep -w "DRAWING_REDIS_HOST" "$ENV_FILE" | cut -d '=' -f2)
@@ -70,8 +72,9 @@ DRAWING_REDIS_PORT=$(grep -w "DRAWING_REDIS_PORT" "$ENV_FILE" | cut -d '=' -f2)
 DRAWING_REDIS_PASSWORD=$(grep -w "DRAWING_REDIS_PASSWORD" "$ENV_FILE" | cut -d '=' -f2)
 
 # Check for missing required sensitive variables and print specific error messages
-if [[ -z "$JWT_SECRET_KEY" ]]; then
-  echo "Error: JWT_SECRET_KEY is missing in $ENV_FILE."
+if [[ -z "$JWT_PRIVATE_KEY_FILE" || ! -f "$JWT_PRIVATE_KEY_FILE" ]]; then
+  echo "Error: JWT_PRIVATE_KEY_FILE is missing in $ENV_FILE or does not point to a PEM file."
+  echo "Generate one with: openssl genrsa -out jwt-private.pem 2048"
   exit 1
 fi
 
@@ -103,7 +106,14 @@ apply_configmap "cassandra-config" "$BACKEND_NAMESPACE" "$ENV_FILE"
 
 # 6. Apply Secrets (for sensitive data)
 echo "Creating Secrets for sensitive values..."
-apply_secret "jwt-secret" "$BACKEND_NAMESPACE" --from-literal=JWT_SECRET_KEY="$JWT_SECRET_KEY"
+JWT_KEY_ARGS=(--from-file=JWT_PRIVATE_KEY="$JWT_PRIVATE_KEY_FILE")
+if [[ -n "$JWT_RETIRED_PUBLIC_KEYS_FILE" ]]; then
+  JWT_KEY_ARGS+=(--from-file=JWT_RETIRED_PUBLIC_KEYS="$JWT_RETIRED_PUBLIC_KEYS_FILE")
+fi
+apply_secret "jwt-signing-keys" "$BACKEND_NAMESPACE" "${JWT_KEY_ARGS[@]}"
+if [[ -n "$ADMIN_API_TOKEN" ]]; then
+  apply_secret "account-api-admin" "$BACKEND_NAMESPACE" --from-literal=ADMIN_API_TOKEN="$ADMIN_API_TOKEN"
+fi
 apply_secret "backend-redis-secret" "$BACKEND_NAMESPACE" --from-literal=REDIS_PASSWORD="$AUTH_REDIS_PASSWORD"
 apply_secret "cognito-secret" "$BACKEND_NAMESPACE" \
   --from-literal=COGNITO_USER_POOL_ID="$COGNITO_USER_POOL_ID" \